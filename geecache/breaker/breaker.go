@@ -0,0 +1,191 @@
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+	Breaker 熔断器，用于保护对某个远程节点的调用：
+	+-----------------------------------------------------------------------------------+
+	|  Closed ---- 窗口内错误率达到阈值 ----> Open ---- 经过 OpenTimeout ----> HalfOpen      |
+	|    ↑                                  ↑                                  |         |
+	|    |                                  +-------- 试探请求失败 ------------+         |
+	|    +---------------------------------- 试探请求成功 ---------------------+         |
+	+-----------------------------------------------------------------------------------+
+*/
+
+// State 熔断器状态
+type State int
+
+const (
+	Closed   State = iota // 正常放行请求，同时统计错误率
+	Open                  // 熔断，拒绝所有请求
+	HalfOpen              // 放行少量试探请求，根据结果决定恢复或再次熔断
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+type NowFunc func() time.Time
+
+// Options 熔断器配置，零值字段使用默认值
+type Options struct {
+	// Window 统计错误率的时间窗口，默认 10s
+	Window time.Duration
+
+	// MinRequests 窗口内的请求数达到该值后才计算错误率，避免少量请求误判，默认 5
+	MinRequests int
+
+	// ErrorRate 窗口内错误率达到该值时熔断，默认 0.5
+	ErrorRate float64
+
+	// OpenTimeout 熔断后经过多长时间进入半开状态，默认 10s
+	OpenTimeout time.Duration
+
+	// HalfOpenRequests 半开状态下允许同时进行的试探请求数，默认 1
+	HalfOpenRequests int
+}
+
+type Breaker struct {
+	mu    sync.Mutex
+	opts  Options
+	state State
+
+	windowStart time.Time // 当前统计窗口的开始时间
+	requests    int       // 当前窗口内的请求数
+	failures    int       // 当前窗口内的失败数
+
+	openedAt time.Time // 最近一次熔断的时间
+	trials   int       // 半开状态下正在进行的试探请求数
+
+	// Now 用于获取当前时间，默认为 time.Now，测试时可以替换
+	Now NowFunc
+}
+
+// New 实例化 Breaker
+func New(o Options) *Breaker {
+	if o.Window <= 0 {
+		o.Window = 10 * time.Second
+	}
+	if o.MinRequests <= 0 {
+		o.MinRequests = 5
+	}
+	if o.ErrorRate <= 0 {
+		o.ErrorRate = 0.5
+	}
+	if o.OpenTimeout <= 0 {
+		o.OpenTimeout = 10 * time.Second
+	}
+	if o.HalfOpenRequests <= 0 {
+		o.HalfOpenRequests = 1
+	}
+	return &Breaker{opts: o, Now: time.Now}
+}
+
+// State 返回熔断器当前状态。熔断时间超过 OpenTimeout 后，视为进入半开状态
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+	return b.state
+}
+
+// Allow 判断是否放行一次请求。放行后调用方必须调用 Success 或 Failure 报告结果
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+	switch b.state {
+	case Open:
+		return false
+	case HalfOpen:
+		if b.trials >= b.opts.HalfOpenRequests {
+			return false
+		}
+		b.trials++
+	}
+	return true
+}
+
+// Success 报告一次成功的请求
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == HalfOpen { // 试探成功，恢复正常
+		b.reset()
+		return
+	}
+	b.record(false)
+}
+
+// Failure 报告一次失败的请求
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == HalfOpen { // 试探失败，再次熔断
+		b.trip()
+		return
+	}
+	b.record(true)
+	if b.state == Closed && b.requests >= b.opts.MinRequests &&
+		float64(b.failures)/float64(b.requests) >= b.opts.ErrorRate {
+		b.trip()
+	}
+}
+
+// Trip 立即熔断，例如健康检查发现节点不可用时
+func (b *Breaker) Trip() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trip()
+}
+
+// Reset 立即恢复到 Closed 状态并清空统计，例如健康检查发现节点恢复时
+func (b *Breaker) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reset()
+}
+
+// advance 熔断时间超过 OpenTimeout 后进入半开状态
+func (b *Breaker) advance() {
+	if b.state == Open && b.Now().Sub(b.openedAt) >= b.opts.OpenTimeout {
+		b.state = HalfOpen
+		b.trials = 0
+	}
+}
+
+// record 在当前窗口内记录一次请求结果，窗口过期则重新开始统计
+func (b *Breaker) record(failed bool) {
+	now := b.Now()
+	if now.Sub(b.windowStart) >= b.opts.Window {
+		b.windowStart = now
+		b.requests, b.failures = 0, 0
+	}
+	b.requests++
+	if failed {
+		b.failures++
+	}
+}
+
+func (b *Breaker) trip() {
+	b.state = Open
+	b.openedAt = b.Now()
+	b.trials = 0
+}
+
+func (b *Breaker) reset() {
+	b.state = Closed
+	b.windowStart = b.Now()
+	b.requests, b.failures, b.trials = 0, 0, 0
+}
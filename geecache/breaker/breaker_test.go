@@ -0,0 +1,89 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock 手动推进的时钟
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func TestBreakerTrip(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	b := New(Options{MinRequests: 4, ErrorRate: 0.5, OpenTimeout: time.Second})
+	b.Now = clock.Now
+
+	// 请求数不足 MinRequests 时不熔断
+	for i := 0; i < 3; i++ {
+		if !b.Allow() {
+			t.Fatalf("closed breaker should allow requests")
+		}
+		b.Failure()
+	}
+	if b.State() != Closed {
+		t.Fatalf("breaker should stay closed below MinRequests, got %v", b.State())
+	}
+
+	// 第 4 个请求失败，错误率 4/4 >= 0.5，熔断
+	b.Allow()
+	b.Failure()
+	if b.State() != Open || b.Allow() {
+		t.Fatalf("breaker should be open and reject requests, got %v", b.State())
+	}
+
+	// 经过 OpenTimeout 后半开，只放行一个试探请求
+	clock.now = clock.now.Add(time.Second)
+	if b.State() != HalfOpen {
+		t.Fatalf("breaker should be half-open after OpenTimeout, got %v", b.State())
+	}
+	if !b.Allow() || b.Allow() {
+		t.Fatalf("half-open breaker should allow exactly one trial request")
+	}
+
+	// 试探失败，再次熔断
+	b.Failure()
+	if b.State() != Open {
+		t.Fatalf("failed trial should reopen the breaker, got %v", b.State())
+	}
+
+	// 再次半开，试探成功后恢复
+	clock.now = clock.now.Add(time.Second)
+	b.Allow()
+	b.Success()
+	if b.State() != Closed || !b.Allow() {
+		t.Fatalf("successful trial should close the breaker, got %v", b.State())
+	}
+}
+
+func TestBreakerErrorRate(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	b := New(Options{Window: time.Second, MinRequests: 4, ErrorRate: 0.5})
+	b.Now = clock.Now
+
+	// 错误率 1/4 低于阈值
+	b.Failure()
+	b.Success()
+	b.Success()
+	b.Success()
+	if b.State() != Closed {
+		t.Fatalf("breaker should stay closed below ErrorRate")
+	}
+
+	// 窗口过期后重新统计，之前的成功请求不再计入
+	clock.now = clock.now.Add(time.Second)
+	for i := 0; i < 4; i++ {
+		b.Failure()
+	}
+	if b.State() != Open {
+		t.Fatalf("breaker should open when ErrorRate is reached in a new window")
+	}
+
+	b.Reset()
+	if b.State() != Closed {
+		t.Fatalf("Reset should close the breaker")
+	}
+}
@@ -2,27 +2,232 @@ package geecache
 
 import (
 	"bytes"
+	"errors"
+	"geecache/compress"
+	"io"
+	"strings"
 	"time"
 )
 
 // 抽象了一个只读数据结构 ByteView 用来表示缓存值
 
+/*
+	ByteView 的值保存在 b 或 s 中，两者只使用一个：StringGetter 加载的值直接保存为 string，不需要拷贝。
+	At、Slice、ReadAt、WriteTo、Reader、Equal 等方法直接读取底层数据，不会分配内存，
+	调用方借此将大的值直接写出；返回的切片与 Reader 共享缓存中的数据，不能修改。
+	压缩的值（z 为 true）由 Group.Query 在返回前解压一次，解压失败时 Query 返回错误；解压后的数据保存在 d 中，
+	由该 ByteView 的各个拷贝共享，这些方法此后直接读取 d，不会重复解压。缓存中的条目不保存 d，不占用额外的内存。
+	其他来源的压缩值没有 d，每次调用都要解压，解压失败时视为空值；需要区分时调用 Decompressed。
+*/
+
 // ByteView 只读数据结构，用来表示缓存值
 type ByteView struct {
 	b []byte // 选择 byte 类型是为了能够支持任意的数据类型的存储，例如字符串、图片等。
+	s string // b 为 nil 时使用 s
 	e time.Time
+	v uint64    // 版本号，由 key 的所有者在值进入 mainCache 时分配，每次写入都会改变
+	t []string  // 标签，用于 Group.RemoveByTag
+	z bool      // b 以 compress 包的头部开始，读取时需要解压
+	d *ByteView // z 为 true 时解压后的值，由 Query 设置
 }
 
-// Len 实现 lru 中 Value 接口
+// Len 实现 lru 中 Value 接口，压缩的值按压缩后的大小计算
 func (bv ByteView) Len() int64 {
-	return int64(len(bv.b))
+	if bv.b != nil {
+		return int64(len(bv.b))
+	}
+	return int64(len(bv.s))
+}
+
+// raw 返回解压后的值，未压缩时直接返回 b，以 s 保存时返回其拷贝
+func (bv ByteView) raw() ([]byte, error) {
+	if bv.z {
+		if bv.d != nil {
+			return bv.d.b, nil
+		}
+		return compress.Decode(bv.b)
+	}
+	if bv.b != nil {
+		return bv.b, nil
+	}
+	return []byte(bv.s), nil
+}
+
+// encoded 返回节点之间传输的数据，压缩的值原样返回，不会拷贝 b
+func (bv ByteView) encoded() []byte {
+	if bv.b != nil {
+		return bv.b
+	}
+	return []byte(bv.s)
+}
+
+// Decompressed 返回解压后的 ByteView，保留过期时间、版本号与标签；未压缩或已经解压过时不会再次解压
+func (bv ByteView) Decompressed() (ByteView, error) {
+	if !bv.z {
+		return bv, nil
+	}
+	if bv.d != nil {
+		return *bv.d, nil
+	}
+	b, err := compress.Decode(bv.b)
+	if err != nil {
+		return ByteView{}, err
+	}
+	return ByteView{b: b, e: bv.e, v: bv.v, t: bv.t}, nil
+}
+
+// decompressOnce 解压压缩的值并保存在 d 中，返回的 ByteView 及其拷贝读取时不再解压
+func (bv ByteView) decompressOnce() (ByteView, error) {
+	if !bv.z || bv.d != nil {
+		return bv, nil
+	}
+	d, err := bv.Decompressed()
+	if err != nil {
+		return ByteView{}, err
+	}
+	bv.d = &d
+	return bv, nil
+}
+
+// data 返回用于读取的解压后的值，解压失败时返回空值
+func (bv ByteView) data() ByteView {
+	d, _ := bv.Decompressed()
+	return d
+}
+
+// Version 返回值的版本号，用于 Group.CompareAndSet。为 0 表示值不来自所有者的 mainCache，例如代为查询的结果
+func (bv ByteView) Version() uint64 {
+	return bv.v
+}
+
+// Tags 返回值的标签
+func (bv ByteView) Tags() []string {
+	return append([]string(nil), bv.t...)
 }
 
 // ByteSlice 返回一个拷贝，防止缓存值被外部程序修改
 func (bv ByteView) ByteSlice() []byte {
-	return bytes.Clone(bv.b)
+	if bv.z && bv.d == nil && len(bv.b) > 0 && compress.Algorithm(bv.b[0]) != compress.None {
+		b, _ := compress.Decode(bv.b) // 解压得到的已经是新的切片
+		return b
+	}
+	d := bv.data()
+	if d.b != nil {
+		return bytes.Clone(d.b)
+	}
+	return []byte(d.s)
 }
 
 func (bv ByteView) String() string {
-	return string(bv.b)
+	d := bv.data()
+	if d.b != nil {
+		return string(d.b)
+	}
+	return d.s
+}
+
+// At 返回下标 i 处的字节
+func (bv ByteView) At(i int) byte {
+	d := bv.data()
+	if d.b != nil {
+		return d.b[i]
+	}
+	return d.s[i]
+}
+
+// Slice 返回 [from, to) 之间的数据，与 bv 共享底层数据
+func (bv ByteView) Slice(from, to int) ByteView {
+	d := bv.data()
+	if d.b != nil {
+		return ByteView{b: d.b[from:to]}
+	}
+	return ByteView{s: d.s[from:to]}
+}
+
+// SliceFrom 返回从 from 开始的数据，与 bv 共享底层数据
+func (bv ByteView) SliceFrom(from int) ByteView {
+	d := bv.data()
+	if d.b != nil {
+		return ByteView{b: d.b[from:]}
+	}
+	return ByteView{s: d.s[from:]}
+}
+
+// Copy 将数据拷贝到 dest，返回拷贝的字节数
+func (bv ByteView) Copy(dest []byte) int {
+	d := bv.data()
+	if d.b != nil {
+		return copy(dest, d.b)
+	}
+	return copy(dest, d.s)
+}
+
+// Equal 判断两个值的数据是否相同，不比较过期时间、版本号与标签
+func (bv ByteView) Equal(b2 ByteView) bool {
+	d := b2.data()
+	if d.b == nil {
+		return bv.EqualString(d.s)
+	}
+	return bv.EqualBytes(d.b)
+}
+
+// EqualString 判断数据是否与 s 相同
+func (bv ByteView) EqualString(s string) bool {
+	d := bv.data()
+	if d.b == nil {
+		return d.s == s
+	}
+	return string(d.b) == s // 编译器优化为直接比较，不会分配内存
+}
+
+// EqualBytes 判断数据是否与 b2 相同
+func (bv ByteView) EqualBytes(b2 []byte) bool {
+	d := bv.data()
+	if d.b != nil {
+		return bytes.Equal(d.b, b2)
+	}
+	return d.s == string(b2)
+}
+
+// Reader 返回读取数据的 io.ReadSeeker，与 bv 共享底层数据
+func (bv ByteView) Reader() io.ReadSeeker {
+	d := bv.data()
+	if d.b != nil {
+		return bytes.NewReader(d.b)
+	}
+	return strings.NewReader(d.s)
+}
+
+// ReadAt 实现 io.ReaderAt 接口
+func (bv ByteView) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("view: invalid offset")
+	}
+	d := bv.data()
+	if off >= d.Len() {
+		return 0, io.EOF
+	}
+	n := d.SliceFrom(int(off)).Copy(p)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// WriteTo 实现 io.WriterTo 接口，将数据直接写入 w
+func (bv ByteView) WriteTo(w io.Writer) (int64, error) {
+	d := bv.data()
+	var (
+		m   int
+		err error
+	)
+	if d.b != nil {
+		m, err = w.Write(d.b)
+	} else {
+		m, err = io.WriteString(w, d.s)
+	}
+	if err == nil && m < int(d.Len()) {
+		err = io.ErrShortWrite
+	}
+	return int64(m), err
 }
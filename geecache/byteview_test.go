@@ -0,0 +1,145 @@
+package geecache
+
+import (
+	"bytes"
+	"fmt"
+	"geecache/compress"
+	"io"
+	"testing"
+)
+
+func views(s string) map[string]ByteView {
+	enc, _ := compress.Encode(compress.Snappy, []byte(s))
+	once, _ := ByteView{b: enc, z: true}.decompressOnce()
+	return map[string]ByteView{
+		"bytes":             {b: []byte(s)},
+		"string":            {s: s},
+		"compressed":        {b: enc, z: true},
+		"decompressed once": once,
+	}
+}
+
+func TestByteView(t *testing.T) {
+	const s = "hello, geecache"
+	for name, v := range views(s) {
+		if v.String() != s || !bytes.Equal(v.ByteSlice(), []byte(s)) {
+			t.Fatalf("%s: String = %q", name, v)
+		}
+		if v.At(7) != 'g' || v.Slice(7, 15).String() != "geecache" || v.SliceFrom(7).String() != "geecache" {
+			t.Fatalf("%s: At/Slice mismatch", name)
+		}
+		if !v.EqualString(s) || !v.EqualBytes([]byte(s)) || v.EqualString("hello") {
+			t.Fatalf("%s: EqualString/EqualBytes mismatch", name)
+		}
+		for other, v2 := range views(s) {
+			if !v.Equal(v2) {
+				t.Fatalf("%s should equal %s", name, other)
+			}
+		}
+
+		var buf bytes.Buffer
+		if n, err := v.WriteTo(&buf); err != nil || n != int64(len(s)) || buf.String() != s {
+			t.Fatalf("%s: WriteTo = %d, %v, wrote %q", name, n, err, buf.String())
+		}
+		if got, err := io.ReadAll(v.Reader()); err != nil || string(got) != s {
+			t.Fatalf("%s: Reader read %q, %v", name, got, err)
+		}
+
+		p := make([]byte, 8)
+		if n, err := v.ReadAt(p, 7); n != 8 || err != nil || string(p) != "geecache" {
+			t.Fatalf("%s: ReadAt = %d, %v, %q", name, n, err, p)
+		}
+		if n, err := v.ReadAt(p, 10); n != 5 || err != io.EOF {
+			t.Fatalf("%s: ReadAt past the end = %d, %v, want 5, EOF", name, n, err)
+		}
+		if _, err := v.ReadAt(p, -1); err == nil {
+			t.Fatalf("%s: ReadAt with negative offset should fail", name)
+		}
+	}
+}
+
+func TestByteViewZeroCopy(t *testing.T) {
+	v := ByteView{b: []byte("geecache")}
+	p := make([]byte, 4)
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = v.At(3)
+		_ = v.Slice(1, 4)
+		_ = v.EqualString("geecache")
+		_, _ = v.ReadAt(p, 2)
+		_, _ = v.WriteTo(io.Discard)
+	})
+	if allocs != 0 {
+		t.Fatalf("accessors allocated %.0f times per run, want 0", allocs)
+	}
+}
+
+// Decompressed 保留版本号与标签，解压失败时返回错误而不是空值
+func TestByteViewDecompressed(t *testing.T) {
+	const s = "hello, geecache"
+	v := views(s)["compressed"]
+	v.v, v.t = 7, []string{"greeting"}
+	d, err := v.Decompressed()
+	if err != nil || d.z || d.String() != s || d.Version() != 7 || len(d.Tags()) != 1 || d.Tags()[0] != "greeting" {
+		t.Fatalf("Decompressed = %q, version %d, tags %v, %v", d, d.Version(), d.Tags(), err)
+	}
+	if u, _ := d.Decompressed(); u.b == nil || &u.b[0] != &d.b[0] {
+		t.Fatalf("Decompressed of an uncompressed view should not copy")
+	}
+	if _, err := (ByteView{b: []byte{0xff, 1, 2}, z: true}).Decompressed(); err == nil {
+		t.Fatalf("Decompressed should report an unknown algorithm")
+	}
+}
+
+// Query 返回的压缩值只解压一次，之后按下标读取不再解压，也不分配内存；解压失败时 Query 返回错误
+func TestQueryDecompressOnce(t *testing.T) {
+	gp := NewGroupOpts("query-decompress", 2<<10, GetterFunc(notFound), &GroupOptions{Compression: compress.Snappy, CompressThreshold: 1})
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil}}
+	gp.localSet("big", ByteView{b: compressible}, &gp.mainCache)
+
+	view, err := gp.Query("big")
+	if err != nil || !view.z || view.Len() >= int64(len(compressible)) {
+		t.Fatalf("Query = %d bytes, %v; want the compressed value", view.Len(), err)
+	}
+	p := make([]byte, 4)
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = view.At(7)
+		_ = view.Slice(7, 15)
+		_ = view.EqualBytes(compressible)
+		_, _ = view.ReadAt(p, 7)
+	})
+	if allocs != 0 || view.At(7) != compressible[7] || !view.EqualBytes(compressible) {
+		t.Fatalf("accessors on a queried compressed value allocated %.0f times per run, want 0", allocs)
+	}
+
+	gp.localSet("corrupt", ByteView{b: []byte{0xff, 1, 2}, z: true}, &gp.mainCache)
+	if _, err := gp.Query("corrupt"); err == nil {
+		t.Fatalf("Query should fail on a value that cannot be decompressed")
+	}
+}
+
+type stringGetter map[string]string
+
+func (g stringGetter) Get(key string) ([]byte, error) {
+	panic("Get should not be called when GetString is implemented")
+}
+
+func (g stringGetter) GetString(key string) (string, error) {
+	if v, ok := g[key]; ok {
+		return v, nil
+	}
+	return "", fmt.Errorf("%s not exist", key)
+}
+
+func TestStringGetter(t *testing.T) {
+	gp := NewGroup("string-getter", 2<<10, stringGetter{"Tom": "630"})
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil}}
+	for i := 0; i < 2; i++ {
+		view, err := gp.Query("Tom")
+		if err != nil || view.b != nil || !view.EqualString("630") {
+			t.Fatalf("Query = %q, %v; want the string-backed value 630", view, err)
+		}
+	}
+	if _, err := gp.Query("Sam"); err == nil {
+		t.Fatalf("Query of a missing key should fail")
+	}
+}
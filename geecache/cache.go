@@ -1,19 +1,33 @@
 package geecache
 
 import (
+	"geecache/index"
 	"geecache/lru"
 	"sync"
+	"unsafe"
 )
 
 /*
 	cache 结构体：实例化 lru，封装 get, add, remove 等方法，
-	并添加互斥锁 mu，实现的并发缓存
+	并添加互斥锁 mu，实现的并发缓存；同时维护按标签与前缀查找 key 的索引 idx
+	已使用的内存除 key 与值之外，还包括 lru 条目、map 中的一项、标签与索引的开销，
+	否则大量很小的值实际占用的内存会是 cacheBytes 的许多倍
 */
 
 type cache struct {
 	mu     sync.RWMutex
-	lru    *lru.LRUCache
-	nbytes int64 // size of all keys and values, 即当前已使用的内存
+	lru    *lru.Cache[ByteView]
+	idx    *index.Index // 与 lru 同时初始化，条目被移除时通过 OnEvicted 同步移除
+	nbytes int64        // 全部条目的 entrySize 之和，不包括索引
+}
+
+// entrySize 返回一个条目占用的内存
+func (c *cache) entrySize(key string, value ByteView) int64 {
+	n := int64(len(key)) + value.Len() + c.lru.EntryOverhead()
+	for _, tag := range value.t {
+		n += int64(unsafe.Sizeof(tag)) + int64(len(tag))
+	}
+	return n
 }
 
 func (c *cache) add(key string, value ByteView) {
@@ -22,34 +36,61 @@ func (c *cache) add(key string, value ByteView) {
 	// 判断 cache 中的 lru 是否为 nil，若是则新建 lru 实例，这种方法称之为延迟初始化，
 	// 延迟初始化意味着该对象的创建将会延迟至第一次使用该对象时，主要用于提高性能，并减少程序内存要求。
 	if c.lru == nil {
-		c.lru = lru.New(0, func(key string, value interface{}) {
-			val := value.(ByteView)
-			c.nbytes -= int64(len(key)) + val.Len()
+		c.idx = index.New()
+		c.lru = lru.NewCache(0, func(key string, value ByteView) {
+			c.nbytes -= c.entrySize(key, value)
+			c.idx.Remove(key)
 		})
 	}
+	c.lru.Remove(key) // key 已存在时先减去旧值的大小，包括已过期、Peek 不到的旧值
 	c.lru.Add(key, value, value.e)
-	c.nbytes += int64(len(key)) + value.Len()
+	c.idx.Add(key, value.t)
+	c.nbytes += c.entrySize(key, value)
 }
 
-// 获取 key 在 lru 中对应的 Value，并断言为 ByteView 返回
+// 获取 key 在 lru 中对应的 Value
 func (c *cache) get(key string) (ByteView, bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.lru == nil {
 		return ByteView{}, false
 	}
-	if v, exist := c.lru.Get(key); exist {
-		return v.(ByteView), exist
+	return c.lru.Get(key)
+}
+
+// peek 与 get 相同，但不影响 key 在 lru 中的顺序
+func (c *cache) peek(key string) (ByteView, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.lru == nil {
+		return ByteView{}, false
+	}
+	return c.lru.Peek(key)
+}
+
+// keys 返回 cache 中全部 key 的快照，按最近访问时间从新到旧排列
+func (c *cache) keys() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.lru == nil {
+		return nil
 	}
-	return ByteView{}, false
+	return c.lru.Keys()
 }
 
-func (c *cache) removeOldest() {
+// removeOldest 淘汰最近最少访问的条目，并返回被淘汰的条目
+func (c *cache) removeOldest() (key string, value ByteView, ok bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if c.lru != nil {
-		c.lru.RemoveOldest()
+	if c.lru == nil {
+		return "", ByteView{}, false
+	}
+	k, v, ok := c.lru.Oldest()
+	if !ok {
+		return "", ByteView{}, false
 	}
+	c.lru.RemoveOldest()
+	return k, v, true
 }
 
 func (c *cache) remove(key string) {
@@ -60,9 +101,44 @@ func (c *cache) remove(key string) {
 	}
 }
 
-// 返回cache中key+value的累计大小
+// matching 返回带有 tag 标签的全部 key；tag 为空时返回以 prefix 开头的全部 key
+func (c *cache) matching(tag, prefix string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.idx == nil {
+		return nil
+	}
+	if tag != "" {
+		return c.idx.Tagged(tag)
+	}
+	return c.idx.WithPrefix(prefix)
+}
+
+// 返回cache已使用的内存，包括索引
 func (c *cache) bytes() int64 {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.nbytes
+	if c.idx == nil {
+		return c.nbytes
+	}
+	return c.nbytes + c.idx.Bytes()
+}
+
+// len 返回条目数
+func (c *cache) len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.lru == nil {
+		return 0
+	}
+	return c.lru.Len()
+}
+
+// clear 清空 cache
+func (c *cache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru = nil
+	c.idx = nil
+	c.nbytes = 0
 }
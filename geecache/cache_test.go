@@ -0,0 +1,65 @@
+package geecache
+
+import (
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func heapAlloc() uint64 {
+	var m runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
+
+// TestCacheBytesMatchesHeap 比较大量小条目实际占用的堆内存与 cache 报告的大小
+func TestCacheBytesMatchesHeap(t *testing.T) {
+	if testing.Short() {
+		t.Skip("allocates a large number of entries")
+	}
+	const n = 50000
+	for _, tagged := range []bool{false, true} {
+		keys := make([]string, n) // key 在测量之前分配，cache 与调用方共享 key
+		for i := range keys {
+			keys[i] = "user:" + strconv.Itoa(i) + ":profile"
+		}
+		var tags []string
+		if tagged {
+			tags = []string{"profiles"}
+		}
+
+		var c cache
+		before := heapAlloc()
+		for i, key := range keys {
+			c.add(key, ByteView{b: []byte(strconv.Itoa(i)), v: uint64(i), t: tags})
+		}
+		heap := int64(heapAlloc() - before)
+		reported := c.bytes()
+		for _, key := range keys {
+			heap += int64(len(key)) // key 本身由调用方分配，cache 同样计入
+		}
+		ratio := float64(heap) / float64(reported)
+		t.Logf("tagged=%v: heap %d bytes, reported %d bytes, %.0f bytes per entry, ratio %.2f", tagged, heap, reported, float64(heap)/n, ratio)
+		if ratio < 0.75 || ratio > 1.33 {
+			t.Errorf("tagged=%v: heap is %.2f times the reported size, want within a third", tagged, ratio)
+		}
+		runtime.KeepAlive(&c)
+	}
+}
+
+func TestCacheUpdateAccounting(t *testing.T) {
+	var c cache
+	c.add("Tom", ByteView{b: []byte("630")})
+	size := c.bytes()
+	for i := 0; i < 3; i++ {
+		c.add("Tom", ByteView{b: []byte("631")})
+	}
+	if c.bytes() != size || c.len() != 1 {
+		t.Fatalf("updating a key changed the size from %d to %d", size, c.bytes())
+	}
+	c.remove("Tom")
+	if c.bytes() != 0 {
+		t.Fatalf("size after removing every key = %d, want 0", c.bytes())
+	}
+}
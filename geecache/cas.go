@@ -0,0 +1,152 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "geecache/geecachepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"hash/crc32"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+	版本号与 CompareAndSet：
+	1. 值进入所有者的 mainCache 时（从 Getter 加载、Set、交接等）分配一个新的版本号，随 Get 一起返回；
+	   版本号取当前时间的纳秒数，且在同一个 Group 内单调递增，被淘汰后重新加载的值也会得到不同的版本号；
+	2. CompareAndSet 总是在 key 的主节点上执行：持有 key 的 keyLock，比较 mainCache 中的版本号，
+	   一致时写入新值（配置了 Setter 时同时写回数据源）并同步给其他副本，不一致时返回 ErrVersionConflict。
+	读取-修改-CompareAndSet，遇到冲突时重新读取后重试，即可实现跨节点的无锁更新。
+*/
+
+// ErrVersionConflict CompareAndSet 的期望版本号与所有者上的当前版本号不一致
+var ErrVersionConflict = errors.New("version conflict")
+
+// keyLock 返回 key 所在分段的锁
+func (g *Group) keyLock(key string) *sync.Mutex {
+	return &g.keyLocks[crc32.ChecksumIEEE([]byte(key))%keyLockStripes]
+}
+
+// nextVersion 分配一个新的版本号
+func (g *Group) nextVersion() uint64 {
+	g.versionMu.Lock()
+	defer g.versionMu.Unlock()
+	v := uint64(time.Now().UnixNano())
+	if v <= g.lastVersion {
+		v = g.lastVersion + 1
+	}
+	g.lastVersion = v
+	return v
+}
+
+// observeVersion 记录其他节点分配的版本号 v，此后分配的版本号都大于 v，避免节点之间的时钟偏差使版本号回退
+func (g *Group) observeVersion(v uint64) {
+	g.versionMu.Lock()
+	defer g.versionMu.Unlock()
+	if v > g.lastVersion {
+		g.lastVersion = v
+	}
+}
+
+// CompareAndSet key 在主节点上的版本号等于 expectedVersion 时写入 value，返回新的版本号。
+// expectedVersion 为 0 表示 key 不在缓存中；版本号不一致时返回 ErrVersionConflict
+func (g *Group) CompareAndSet(key string, value []byte, expire time.Time, expectedVersion uint64) (uint64, error) {
+	g.peersOnce.Do(g.initPeers)
+	if key == "" {
+		return 0, errors.New("empty CompareAndSet() key not allowed")
+	}
+
+	replicas := g.peers.PickPeers(key)
+	if isPrimary(replicas) {
+		return g.ownerCompareAndSet(replicas, key, value, expire, expectedVersion)
+	}
+	req := &pb.CompareAndSetRequest{
+		Group:           g.name,
+		Key:             key,
+		Value:           value,
+		Expire:          toUnixNano(expire),
+		ExpectedVersion: expectedVersion,
+	}
+	out := &pb.CompareAndSetResponse{}
+	if err := replicas[0].CompareAndSet(req, out); err != nil {
+		return 0, err
+	}
+	// 当前节点作为副本时由主节点同步，否则丢弃 hotCache 中的旧值
+	if !isReplica(replicas) {
+		g.loadGroup.Lock(func() {
+			g.hotCache.remove(key)
+		})
+	}
+	return out.Version, nil
+}
+
+// ownerCompareAndSet 在主节点上比较版本号并写入，成功后同步给 replicas 中的其他副本，
+// 得不到 writeQuorum 个确认时返回新的版本号和错误，此时主节点上的写入已经生效
+func (g *Group) ownerCompareAndSet(replicas []ProtoGetter, key string, value []byte, expire time.Time, expectedVersion uint64) (uint64, error) {
+	lock := g.keyLock(key)
+	lock.Lock()
+	current, ok := g.mainCache.peek(key)
+	if !ok && g.disk != nil {
+		current, _ = g.promote(key)
+	}
+	if current.v != expectedVersion {
+		lock.Unlock()
+		return 0, fmt.Errorf("%w: key %s is at version %d, expected %d", ErrVersionConflict, key, current.v, expectedVersion)
+	}
+	view := g.compress(ByteView{b: value, e: expire, v: g.nextVersion(), t: current.t}) // 保留原来的标签
+	err := g.writeOriginLocked(WriteOp{Key: key, Value: value, Expire: expire}, func() {
+		g.localSet(key, view, &g.mainCache)
+	})
+	lock.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	g.invalidate(key) // 由主节点发布失效事件，转发来的请求也会发布
+	return view.v, g.replicate(replicas, key, view)
+}
+
+// replicate 主节点写入后，以相同的版本号同步给 replicas 中的其他副本，得不到 writeQuorum 个确认时返回错误
+func (g *Group) replicate(replicas []ProtoGetter, key string, value ByteView) error {
+	return g.writeReplicas(replicas, func(peer ProtoGetter) error {
+		if peer == nil {
+			return nil // 主节点已经写入
+		}
+		return g.setFromPeer(peer, key, value)
+	})
+}
+
+// CompareAndSet 作为 key 的主节点执行比较并写入，版本号不一致时返回 codes.Aborted
+func (s *Server) CompareAndSet(ctx context.Context, in *pb.CompareAndSetRequest) (*pb.CompareAndSetResponse, error) {
+	group := GetGroup(in.GetGroup())
+	if group == nil {
+		return nil, fmt.Errorf("no such group: %s", in.GetGroup())
+	}
+	group.peersOnce.Do(group.initPeers)
+	version, err := group.ownerCompareAndSet(group.peers.PickPeers(in.Key), in.Key, in.Value, fromUnixNano(in.Expire), in.ExpectedVersion)
+	if errors.Is(err, ErrVersionConflict) {
+		return nil, status.Error(codes.Aborted, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CompareAndSetResponse{Version: version}, nil
+}
+
+// CompareAndSet 方法，实现 ProtoGetter 接口。codes.Aborted 转换为 ErrVersionConflict
+func (c *client) CompareAndSet(in *pb.CompareAndSetRequest, out *pb.CompareAndSetResponse) error {
+	return c.call(func(ctx context.Context, grpcClient pb.GroupCacheClient) error {
+		resp, err := grpcClient.CompareAndSet(ctx, in)
+		if errCode(err) == codes.Aborted {
+			msg := strings.TrimPrefix(status.Convert(err).Message(), ErrVersionConflict.Error()+": ")
+			return fmt.Errorf("%w: %s", ErrVersionConflict, msg)
+		}
+		if err != nil {
+			return fmt.Errorf("grpc client CompareAndSet() error: %w", err)
+		}
+		out.Version = resp.GetVersion()
+		return nil
+	})
+}
@@ -0,0 +1,129 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"geecache/breaker"
+	pb "geecache/geecachepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+func TestCompareAndSet(t *testing.T) {
+	gp := NewGroup("cas", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}))
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil}}
+
+	view, err := gp.Query("Tom")
+	if err != nil || view.Version() == 0 {
+		t.Fatalf("loaded value should be versioned, got %d, %v", view.Version(), err)
+	}
+	v1 := view.Version()
+	v2, err := gp.CompareAndSet("Tom", []byte("631"), time.Time{}, v1)
+	if err != nil || v2 <= v1 {
+		t.Fatalf("CompareAndSet = %d, %v; want version above %d", v2, err, v1)
+	}
+	if view, _ := gp.Query("Tom"); view.String() != "631" || view.Version() != v2 {
+		t.Fatalf("Query = %q@%d, want 631@%d", view, view.Version(), v2)
+	}
+
+	// 旧版本号冲突，值保持不变
+	if _, err := gp.CompareAndSet("Tom", []byte("632"), time.Time{}, v1); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("stale CompareAndSet should conflict, got %v", err)
+	}
+	if view, _ := gp.Query("Tom"); view.String() != "631" {
+		t.Fatalf("conflicting write applied, got %q", view)
+	}
+
+	// Set 同样会改变版本号
+	gp.Set("Tom", []byte("633"), time.Time{}, false)
+	if _, err := gp.CompareAndSet("Tom", []byte("634"), time.Time{}, v2); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("CompareAndSet after Set should conflict, got %v", err)
+	}
+
+	// 期望版本号为 0 表示 key 不在缓存中
+	if _, err := gp.CompareAndSet("new", []byte("1"), time.Time{}, 0); err != nil {
+		t.Fatalf("CompareAndSet on absent key failed: %v", err)
+	}
+	if _, err := gp.CompareAndSet("new", []byte("2"), time.Time{}, 0); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("second create should conflict, got %v", err)
+	}
+}
+
+// 条目降级到磁盘再移回 mainCache 后版本号不变，之前读到的版本号仍然可以用于 CompareAndSet
+func TestCompareAndSetAfterDemote(t *testing.T) {
+	gp := NewGroupOpts("cas-demote", 2<<10, GetterFunc(notFound), &GroupOptions{MaxEntries: 1, DiskDir: t.TempDir(), DiskBytes: 1 << 20})
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil}}
+
+	gp.localSet("Tom", ByteView{b: []byte("630")}, &gp.mainCache)
+	view, _ := gp.mainCache.peek("Tom")
+	gp.localSet("Jack", ByteView{b: []byte("589")}, &gp.mainCache) // Tom 降级到磁盘
+	gp.flushDemoted()
+	if _, _, ok := gp.disk.Get("Tom"); !ok {
+		t.Fatalf("Tom should be demoted to disk")
+	}
+	if v, err := gp.CompareAndSet("Tom", []byte("631"), time.Time{}, view.Version()); err != nil || v <= view.Version() {
+		t.Fatalf("CompareAndSet after promotion = %d, %v; want a version above %d", v, err, view.Version())
+	}
+}
+
+func TestCompareAndSetReplicas(t *testing.T) {
+	p1 := newFakePeer(false)
+	p1.data["Tom"], p1.versions["Tom"] = []byte("630"), 7
+
+	// 当前节点不是主节点，转发给 p1，并丢弃 hotCache 中的旧值
+	gp := NewGroup("cas-forward", 2<<10, GetterFunc(notFound))
+	gp.peers = &fakePicker{replicas: []ProtoGetter{p1}}
+	gp.localSet("Tom", ByteView{b: []byte("630"), v: 7}, &gp.hotCache)
+	if _, err := gp.CompareAndSet("Tom", []byte("631"), time.Time{}, 6); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("CompareAndSet should conflict on primary, got %v", err)
+	}
+	if v, err := gp.CompareAndSet("Tom", []byte("631"), time.Time{}, 7); err != nil || v != 8 {
+		t.Fatalf("CompareAndSet = %d, %v; want 8", v, err)
+	}
+	if _, ok := gp.hotCache.get("Tom"); ok {
+		t.Fatalf("stale hot copy should be dropped")
+	}
+
+	// 当前节点是主节点，写入后以相同的版本号同步给 p2，写法定数为 2 时等待 p2 确认
+	p2 := newFakePeer(false)
+	gp = NewGroupOpts("cas-primary", 2<<10, GetterFunc(notFound), &GroupOptions{WriteQuorum: 2})
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil, p2}}
+	v, err := gp.CompareAndSet("Sam", []byte("567"), time.Time{}, 0)
+	if err != nil {
+		t.Fatalf("CompareAndSet failed: %v", err)
+	}
+	p2.mu.Lock()
+	defer p2.mu.Unlock()
+	if string(p2.data["Sam"]) != "567" || p2.versions["Sam"] != v {
+		t.Fatalf("replica got %q@%d, want 567@%d", p2.data["Sam"], p2.versions["Sam"], v)
+	}
+}
+
+func TestServerCompareAndSet(t *testing.T) {
+	gp := NewGroup("cas-server", 2<<10, GetterFunc(notFound))
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil}}
+	s := newServer("127.0.0.1:8001", nil)
+
+	out, err := s.CompareAndSet(context.Background(), &pb.CompareAndSetRequest{Group: gp.name, Key: "Tom", Value: []byte("630")})
+	if err != nil || out.Version == 0 {
+		t.Fatalf("CompareAndSet = %v, %v", out, err)
+	}
+	_, err = s.CompareAndSet(context.Background(), &pb.CompareAndSetRequest{Group: gp.name, Key: "Tom", Value: []byte("631")})
+	if status.Code(err) != codes.Aborted {
+		t.Fatalf("conflict should be reported as Aborted, got %v", err)
+	}
+
+	// 客户端将 Aborted 还原为 ErrVersionConflict，且不触发熔断与重试
+	fake := &faultyGrpcClient{err: err}
+	c := newFakeClient(fake, ClientOptions{}, breaker.Options{MinRequests: 1})
+	if err := c.CompareAndSet(&pb.CompareAndSetRequest{}, &pb.CompareAndSetResponse{}); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("client should return ErrVersionConflict, got %v", err)
+	}
+	if fake.callCount() != 1 || !c.healthy() {
+		t.Fatalf("conflict should not be retried or trip the breaker")
+	}
+}
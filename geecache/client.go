@@ -2,19 +2,162 @@ package geecache
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"geecache/breaker"
 	pb "geecache/geecachepb"
 	"geecache/registry"
 	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
 	"sync"
 	"time"
 )
 
-// client 只有一个字段——对等节点的地址，同时实现了 ProtoGetter 接口
+// client 对应一个对等节点，实现了 ProtoGetter 接口
 type client struct {
-	name       string // 格式：groupcache/127.0.0.1:8001
-	grpcClient pb.GroupCacheClient
-	clientOnce sync.Once
+	name         string // 格式：groupcache/127.0.0.1:8001
+	grpcClient   pb.GroupCacheClient
+	healthClient healthpb.HealthClient
+	mu           sync.Mutex // 保护 grpcClient 与 healthClient 的延迟初始化
+
+	// 熔断器，节点不可达的错误率过高或健康检查失败时熔断，PickPeers 会绕过熔断中的节点
+	breaker *breaker.Breaker
+
+	healthMu       sync.Mutex
+	cooldown       time.Duration // 节点不可达后，被标记为不健康的时长，为 0 时只依赖熔断器
+	unhealthyUntil time.Time     // 在此之前节点被视为不健康，PickPeers 会绕过它
+
+	opts    ClientOptions
+	latency *latencyWindow // 最近成功的 Get 请求耗时，用于计算对冲请求的延迟
+}
+
+// ClientOptions 访问远程节点时的超时、重试与对冲请求配置，零值字段使用默认值
+type ClientOptions struct {
+	// Timeout 单次尝试的超时时间，默认 5s
+	Timeout time.Duration
+
+	// MaxAttempts 最大尝试次数（包括首次），默认 1，即不重试
+	MaxAttempts int
+
+	// InitialBackoff 首次重试前的等待时间，之后每次乘以 BackoffMultiplier，但不超过 MaxBackoff。
+	// 默认分别为 50ms、1s、2
+	InitialBackoff    time.Duration
+	MaxBackoff        time.Duration
+	BackoffMultiplier float64
+
+	// Jitter 等待时间的随机抖动比例，取值 [0, 1]，默认 0.2，即在 ±20% 范围内随机，避免重试请求同时到达
+	Jitter float64
+
+	// RetryableCodes 允许重试的 gRPC 错误码，默认只重试 codes.Unavailable
+	RetryableCodes []codes.Code
+
+	// HedgePercentile 大于 0 时开启对冲请求：向主副本发起的 Get 超过其最近耗时的该百分位数（例如 0.95）
+	// 仍未返回时，同时向下一个副本发起请求，以先返回的结果为准
+	HedgePercentile float64
+
+	// HedgeMinDelay 对冲请求延迟的下限，避免节点响应很快时几乎每个请求都被对冲
+	HedgeMinDelay time.Duration
+}
+
+const (
+	defaultTimeout        = 5 * time.Second
+	defaultInitialBackoff = 50 * time.Millisecond
+	defaultMaxBackoff     = time.Second
+	defaultMultiplier     = 2
+	defaultJitter         = 0.2
+
+	latencySamples    = 128 // 计算百分位数时保留的最近样本数
+	minHedgingSamples = 20  // 样本数不足时不进行对冲
+)
+
+// withDefaults 填充 ClientOptions 中的零值字段
+func (o ClientOptions) withDefaults() ClientOptions {
+	if o.Timeout <= 0 {
+		o.Timeout = defaultTimeout
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 1
+	}
+	if o.InitialBackoff <= 0 {
+		o.InitialBackoff = defaultInitialBackoff
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = defaultMaxBackoff
+	}
+	if o.BackoffMultiplier < 1 {
+		o.BackoffMultiplier = defaultMultiplier
+	}
+	if o.Jitter <= 0 || o.Jitter > 1 {
+		o.Jitter = defaultJitter
+	}
+	if len(o.RetryableCodes) == 0 {
+		o.RetryableCodes = []codes.Code{codes.Unavailable}
+	}
+	return o
+}
+
+// backoff 返回第 attempt 次尝试失败后、下一次重试前的等待时间（指数退避加随机抖动）
+func (o ClientOptions) backoff(attempt int) time.Duration {
+	d := float64(o.InitialBackoff) * math.Pow(o.BackoffMultiplier, float64(attempt-1))
+	if d > float64(o.MaxBackoff) {
+		d = float64(o.MaxBackoff)
+	}
+	d *= 1 + o.Jitter*(2*rand.Float64()-1)
+	return time.Duration(d)
+}
+
+func (o ClientOptions) retryable(err error) bool {
+	code := errCode(err)
+	for _, c := range o.RetryableCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// latencyWindow 环形缓冲区，保存最近 latencySamples 次请求的耗时
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+func (w *latencyWindow) add(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.samples) < latencySamples {
+		w.samples = append(w.samples, d)
+		return
+	}
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % latencySamples
+}
+
+// percentile 返回样本的 p 百分位数，样本不足 minHedgingSamples 时返回 false
+func (w *latencyWindow) percentile(p float64) (time.Duration, bool) {
+	w.mu.Lock()
+	sorted := append([]time.Duration(nil), w.samples...)
+	w.mu.Unlock()
+	if len(sorted) < minHedgingSamples {
+		return 0, false
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i], true
 }
 
 var (
@@ -24,10 +167,35 @@ var (
 	}
 )
 
-func (c *client) initGrpcClient() {
+// errBreakerOpen 熔断期间直接拒绝请求
+var errBreakerOpen = status.Error(codes.Unavailable, "circuit breaker is open")
+
+func newClient(name string, o ClientOptions, b breaker.Options) *client {
+	return &client{
+		name:    name,
+		breaker: breaker.New(b),
+		opts:    o.withDefaults(),
+		latency: &latencyWindow{},
+	}
+}
+
+// String 返回节点名称，用于错误信息与日志
+func (c *client) String() string {
+	return c.name
+}
+
+// getGrpcClient 延迟初始化 grpcClient。节点可能尚未启动或已经下线，
+// 因此失败时返回错误而不是 panic，下次调用时会重新尝试
+func (c *client) getGrpcClient() (pb.GroupCacheClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.grpcClient != nil {
+		return c.grpcClient, nil
+	}
+
 	cli, err := clientv3.New(defaultEtcdConfig)
 	if err != nil {
-		panic("create etcd client failed: " + err.Error())
+		return nil, status.Errorf(codes.Unavailable, "create etcd client failed: %v", err)
 	}
 	defer cli.Close() // 关闭 cli 释放资源，且不影响 gRPC服务
 
@@ -42,44 +210,217 @@ func (c *client) initGrpcClient() {
 
 	conn, err := registry.EtcdDial(cli, c.name)
 	if err != nil {
-		panic("etcd dial failed: " + err.Error())
+		return nil, status.Errorf(codes.Unavailable, "etcd dial failed: %v", err)
 	}
 	c.grpcClient = pb.NewGroupCacheClient(conn)
+	c.healthClient = healthpb.NewHealthClient(conn)
+	return c.grpcClient, nil
 }
 
-// Get 方法，实现 ProtoGetter 接口
-func (c *client) Get(in *pb.Request, out *pb.Response) (err error) {
-	c.clientOnce.Do(c.initGrpcClient)
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
+// call 在熔断器的保护下调用远程节点，遇到 RetryableCodes 中的错误时按指数退避重试，最多 MaxAttempts 次
+func (c *client) call(fn func(ctx context.Context, grpcClient pb.GroupCacheClient) error) error {
+	for attempt := 1; ; attempt++ {
+		if !c.breaker.Allow() {
+			return errBreakerOpen
+		}
+		err := c.attempt(fn)
+		c.report(err)
+		if err == nil || attempt >= c.opts.MaxAttempts || !c.opts.retryable(err) {
+			return err
+		}
+		time.Sleep(c.opts.backoff(attempt))
+	}
+}
 
-	out, err = c.grpcClient.Get(ctx, in)
+// attempt 调用一次远程节点，超时时间为 Timeout
+func (c *client) attempt(fn func(ctx context.Context, grpcClient pb.GroupCacheClient) error) error {
+	grpcClient, err := c.getGrpcClient()
 	if err != nil {
-		return fmt.Errorf("grpc client Get() error: %v", err)
+		return err
 	}
-	return nil
+	ctx, cancel := context.WithTimeout(context.Background(), c.opts.Timeout)
+	defer cancel()
+	return fn(ctx, grpcClient)
+}
+
+// report 向熔断器报告调用结果。只有节点不可达才算失败，此时节点还会在 cooldown 时间内被标记为不健康；
+// 业务错误（例如 key 不存在）说明节点仍在正常工作
+func (c *client) report(err error) {
+	switch errCode(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		c.markUnhealthy(c.cooldown)
+		c.breaker.Failure()
+		if c.breaker.State() == breaker.Open {
+			log.Printf("[%s] 节点不可达，熔断器打开：%v", c.name, err)
+		}
+	default:
+		c.breaker.Success()
+	}
+}
+
+// errCode 取出（可能经过 fmt.Errorf 包装的）gRPC 错误码
+func errCode(err error) codes.Code {
+	var se interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &se) {
+		return se.GRPCStatus().Code()
+	}
+	return status.Code(err)
 }
 
-func (c *client) Set(in *pb.SetRequest) (err error) {
-	c.clientOnce.Do(c.initGrpcClient)
+// hedgeDelay 返回对冲请求的延迟：主副本的 Get 超过该时间仍未返回时，向下一个副本发起请求。
+// 未开启对冲或样本不足时返回 false
+func (c *client) hedgeDelay() (time.Duration, bool) {
+	if c.opts.HedgePercentile <= 0 {
+		return 0, false
+	}
+	d, ok := c.latency.percentile(c.opts.HedgePercentile)
+	if !ok {
+		return 0, false
+	}
+	if d < c.opts.HedgeMinDelay {
+		d = c.opts.HedgeMinDelay
+	}
+	return d, true
+}
+
+// markUnhealthy 在 d 时间内将节点标记为不健康，d 为 0 时清除标记
+func (c *client) markUnhealthy(d time.Duration) {
+	c.healthMu.Lock()
+	defer c.healthMu.Unlock()
+	if d == 0 {
+		c.unhealthyUntil = time.Time{}
+		return
+	}
+	c.unhealthyUntil = time.Now().Add(d)
+}
+
+// healthy 节点当前是否可用，熔断期间或不可达后的 cooldown 时间内视为不可用
+func (c *client) healthy() bool {
+	c.healthMu.Lock()
+	until := c.unhealthyUntil
+	c.healthMu.Unlock()
+	return !time.Now().Before(until) && c.breaker.State() != breaker.Open
+}
+
+// probe 使用标准的 gRPC 健康检查服务主动探测节点：不可用时直接熔断，恢复时关闭熔断器
+func (c *client) probe() {
+	if _, err := c.getGrpcClient(); err != nil {
+		c.breaker.Trip()
+		return
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 
-	_, err = c.grpcClient.Put(ctx, in)
+	resp, err := c.healthClient.Check(ctx, &healthpb.HealthCheckRequest{Service: healthService})
+	if err != nil || resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		if c.breaker.State() != breaker.Open {
+			log.Printf("[%s] 健康检查失败，熔断器打开：%v", c.name, err)
+		}
+		c.breaker.Trip()
+		return
+	}
+	c.markUnhealthy(0) // 健康检查通过，提前结束 cooldown
+	if c.breaker.State() != breaker.Closed {
+		log.Printf("[%s] 健康检查通过，熔断器关闭", c.name)
+		c.breaker.Reset()
+	}
+}
+
+// Get 方法，实现 ProtoGetter 接口
+func (c *client) Get(in *pb.Request, out *pb.Response) error {
+	return c.call(func(ctx context.Context, grpcClient pb.GroupCacheClient) error {
+		start := time.Now()
+		resp, err := grpcClient.Get(ctx, in)
+		if err != nil {
+			return fmt.Errorf("grpc client Get() error: %w", err)
+		}
+		c.latency.add(time.Since(start))
+		out.Value = resp.GetValue()
+		out.Compressed = resp.GetCompressed()
+		out.Version = resp.GetVersion()
+		out.Tags = resp.GetTags()
+		return nil
+	})
+}
+
+func (c *client) Set(in *pb.SetRequest) error {
+	return c.call(func(ctx context.Context, grpcClient pb.GroupCacheClient) error {
+		if _, err := grpcClient.Put(ctx, in); err != nil {
+			return fmt.Errorf("grpc client Put() error: %w", err)
+		}
+		return nil
+	})
+}
+
+func (c *client) Remove(in *pb.Request) error {
+	return c.call(func(ctx context.Context, grpcClient pb.GroupCacheClient) error {
+		if _, err := grpcClient.Delete(ctx, in); err != nil {
+			return fmt.Errorf("grpc client Delete error: %w", err)
+		}
+		return nil
+	})
+}
+
+// handoff 以流的形式把 entries 交给节点，每发送一条之前调用 wait 进行限速，返回对方写入的条目数。
+// 流可能持续较长时间，因此不受 Timeout 限制，也不重试
+func (c *client) handoff(entries []*pb.SetRequest, wait func()) (int64, error) {
+	if !c.breaker.Allow() {
+		return 0, errBreakerOpen
+	}
+	grpcClient, err := c.getGrpcClient()
+	if err != nil {
+		c.report(err)
+		return 0, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := grpcClient.Handoff(ctx)
+	if err == nil {
+		for _, entry := range entries {
+			wait()
+			if err = stream.Send(entry); err != nil {
+				break // 对方已结束流，真正的错误由 CloseAndRecv 返回
+			}
+		}
+	}
+	var resp *pb.HandoffResponse
+	if err == nil || err == io.EOF {
+		resp, err = stream.CloseAndRecv()
+	}
+	c.report(err)
 	if err != nil {
-		return fmt.Errorf("grpc client Put() error: %v", err)
+		return 0, fmt.Errorf("grpc client Handoff() error: %w", err)
 	}
-	return nil
+	return resp.GetAccepted(), nil
 }
 
-func (c *client) Remove(in *pb.Request) (err error) {
-	c.clientOnce.Do(c.initGrpcClient)
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+// warmup 向节点请求最近访问的条目，每收到一条调用一次 fn，整个流的超时时间为 timeout
+func (c *client) warmup(in *pb.WarmupRequest, timeout time.Duration, fn func(*pb.SetRequest)) error {
+	if !c.breaker.Allow() {
+		return errBreakerOpen
+	}
+	grpcClient, err := c.getGrpcClient()
+	if err != nil {
+		c.report(err)
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	_, err = c.grpcClient.Delete(ctx, in)
+	stream, err := grpcClient.Warmup(ctx, in)
+	for err == nil {
+		var entry *pb.SetRequest
+		if entry, err = stream.Recv(); err == nil {
+			fn(entry)
+		}
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	c.report(err)
 	if err != nil {
-		return fmt.Errorf("grpc client Delete error: %v", err)
+		return fmt.Errorf("grpc client Warmup() error: %w", err)
 	}
 	return nil
 }
@@ -0,0 +1,340 @@
+package geecache
+
+import (
+	"context"
+	"geecache/breaker"
+	pb "geecache/geecachepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// faultyGrpcClient 可注入故障的 pb.GroupCacheClient：
+// err 不为 nil 时，前 fails 次调用返回该错误，fails 为 0 则每次都返回该错误；每次调用耗时 delay
+type faultyGrpcClient struct {
+	mu    sync.Mutex
+	err   error
+	fails int
+	delay time.Duration
+	value []byte
+	calls int
+
+	compressed bool          // Get 返回的值是否标记为已压缩
+	spills     int           // 收到的溢出查询数
+	hold       chan struct{} // 不为 nil 时，调用在其关闭后才返回
+
+	handoffs []*pb.SetRequest  // Handoff 流收到的条目
+	warmups  []*pb.SetRequest  // Warmup 流返回的条目
+	warmupIn *pb.WarmupRequest // 最近一次 Warmup 的请求
+}
+
+func (f *faultyGrpcClient) result(ctx context.Context) error {
+	f.mu.Lock()
+	f.calls++
+	var err error
+	if f.err != nil && (f.fails == 0 || f.calls <= f.fails) {
+		err = f.err
+	}
+	hold := f.hold
+	f.mu.Unlock()
+
+	if hold != nil {
+		select {
+		case <-hold:
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	select {
+	case <-time.After(f.delay):
+		return err
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+func (f *faultyGrpcClient) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func (f *faultyGrpcClient) Get(ctx context.Context, in *pb.Request, opts ...grpc.CallOption) (*pb.Response, error) {
+	if in.Spill {
+		f.mu.Lock()
+		f.spills++
+		f.mu.Unlock()
+	}
+	if err := f.result(ctx); err != nil {
+		return nil, err
+	}
+	return &pb.Response{Value: f.value, Compressed: f.compressed}, nil
+}
+
+func (f *faultyGrpcClient) Put(ctx context.Context, in *pb.SetRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	return new(emptypb.Empty), f.result(ctx)
+}
+
+func (f *faultyGrpcClient) Delete(ctx context.Context, in *pb.Request, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	return new(emptypb.Empty), f.result(ctx)
+}
+
+func (f *faultyGrpcClient) CompareAndSet(ctx context.Context, in *pb.CompareAndSetRequest, opts ...grpc.CallOption) (*pb.CompareAndSetResponse, error) {
+	return &pb.CompareAndSetResponse{}, f.result(ctx)
+}
+
+func (f *faultyGrpcClient) Incr(ctx context.Context, in *pb.IncrRequest, opts ...grpc.CallOption) (*pb.IncrResponse, error) {
+	return &pb.IncrResponse{}, f.result(ctx)
+}
+
+func (f *faultyGrpcClient) RemoveMatching(ctx context.Context, in *pb.RemoveMatchingRequest, opts ...grpc.CallOption) (*pb.RemoveMatchingResponse, error) {
+	return &pb.RemoveMatchingResponse{}, f.result(ctx)
+}
+
+func (f *faultyGrpcClient) Purge(ctx context.Context, in *pb.PurgeRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	return new(emptypb.Empty), f.result(ctx)
+}
+
+func (f *faultyGrpcClient) Invalidations(ctx context.Context, in *pb.InvalidationsRequest, opts ...grpc.CallOption) (pb.GroupCache_InvalidationsClient, error) {
+	return nil, status.Error(codes.Unimplemented, "invalidation bus is disabled")
+}
+
+func (f *faultyGrpcClient) Handoff(ctx context.Context, opts ...grpc.CallOption) (pb.GroupCache_HandoffClient, error) {
+	if err := f.result(ctx); err != nil {
+		return nil, err
+	}
+	return &fakeHandoffStream{f: f}, nil
+}
+
+func (f *faultyGrpcClient) handedOff() []*pb.SetRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*pb.SetRequest(nil), f.handoffs...)
+}
+
+// fakeHandoffStream 把收到的条目记录到 faultyGrpcClient 中，全部接收
+type fakeHandoffStream struct {
+	grpc.ClientStream
+	f     *faultyGrpcClient
+	count int64
+}
+
+func (s *fakeHandoffStream) Send(in *pb.SetRequest) error {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	s.f.handoffs = append(s.f.handoffs, in)
+	s.count++
+	return nil
+}
+
+func (s *fakeHandoffStream) CloseAndRecv() (*pb.HandoffResponse, error) {
+	return &pb.HandoffResponse{Accepted: s.count}, nil
+}
+
+func (f *faultyGrpcClient) Warmup(ctx context.Context, in *pb.WarmupRequest, opts ...grpc.CallOption) (pb.GroupCache_WarmupClient, error) {
+	f.mu.Lock()
+	f.warmupIn = in
+	f.mu.Unlock()
+	if err := f.result(ctx); err != nil {
+		return nil, err
+	}
+	return &fakeWarmupStream{entries: f.warmups}, nil
+}
+
+// fakeWarmupStream 依次返回 entries 中的条目
+type fakeWarmupStream struct {
+	grpc.ClientStream
+	entries []*pb.SetRequest
+}
+
+func (s *fakeWarmupStream) Recv() (*pb.SetRequest, error) {
+	if len(s.entries) == 0 {
+		return nil, io.EOF
+	}
+	in := s.entries[0]
+	s.entries = s.entries[1:]
+	return in, nil
+}
+
+// fakeHealthClient 返回固定健康状态的 healthpb.HealthClient
+type fakeHealthClient struct {
+	healthpb.HealthClient
+	serving bool
+}
+
+func (f *fakeHealthClient) Check(ctx context.Context, in *healthpb.HealthCheckRequest, opts ...grpc.CallOption) (*healthpb.HealthCheckResponse, error) {
+	if !f.serving {
+		return nil, status.Error(codes.Unavailable, "connection refused")
+	}
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
+
+// newFakeClient 返回已经“连接”到 fake 节点的 client，不依赖 etcd
+func newFakeClient(grpcClient pb.GroupCacheClient, o ClientOptions, b breaker.Options) *client {
+	c := newClient("groupcache/fake", o, b)
+	c.grpcClient = grpcClient
+	c.healthClient = &fakeHealthClient{serving: true}
+	return c
+}
+
+var errUnavailable = status.Error(codes.Unavailable, "connection refused")
+
+func TestClientBreaker(t *testing.T) {
+	fake := &faultyGrpcClient{err: errUnavailable}
+	c := newFakeClient(fake, ClientOptions{}, breaker.Options{MinRequests: 3})
+
+	for i := 0; i < 3; i++ {
+		if err := c.Get(&pb.Request{Key: "Tom"}, &pb.Response{}); err == nil {
+			t.Fatalf("Get should fail while peer is down")
+		}
+	}
+	if c.healthy() {
+		t.Fatalf("breaker should open after repeated Unavailable errors")
+	}
+	if err := c.Get(&pb.Request{Key: "Tom"}, &pb.Response{}); err != errBreakerOpen || fake.calls != 3 {
+		t.Fatalf("open breaker should reject calls without contacting the peer")
+	}
+
+	// 业务错误不影响节点健康
+	fake = &faultyGrpcClient{err: status.Error(codes.Unknown, "Tom not exist")}
+	c = newFakeClient(fake, ClientOptions{}, breaker.Options{MinRequests: 3})
+	for i := 0; i < 5; i++ {
+		c.Get(&pb.Request{Key: "Tom"}, &pb.Response{})
+	}
+	if !c.healthy() {
+		t.Fatalf("application errors should not open the breaker")
+	}
+}
+
+// 节点不可达一次即在 cooldown 内被视为不健康，不必等待熔断器打开
+func TestClientCooldown(t *testing.T) {
+	fake := &faultyGrpcClient{err: errUnavailable}
+	c := newFakeClient(fake, ClientOptions{}, breaker.Options{MinRequests: 10})
+	c.cooldown = time.Minute
+	c.Get(&pb.Request{Key: "Tom"}, &pb.Response{})
+	if c.healthy() || c.breaker.State() == breaker.Open {
+		t.Fatalf("one Unavailable error should mark the peer unhealthy without opening the breaker")
+	}
+	if err := c.Get(&pb.Request{Key: "Tom"}, &pb.Response{}); err == errBreakerOpen || fake.calls != 2 {
+		t.Fatalf("cooldown should only affect PickPeers, calls = %d, err = %v", fake.calls, err)
+	}
+
+	c.probe()
+	if !c.healthy() {
+		t.Fatalf("passed health check should end the cooldown")
+	}
+}
+
+// 无论由 applyPeers 还是 WarmBeforeSwitch 的交接创建，节点的客户端都使用 Server 的 FailoverCooldown
+func TestNewPeerClient(t *testing.T) {
+	s := newServer("127.0.0.1:8001", &ServerOptions{FailoverCooldown: time.Minute})
+	if c := s.newPeerClient("127.0.0.1:8002"); c.cooldown != time.Minute || c.name != "groupcache/127.0.0.1:8002" {
+		t.Fatalf("newPeerClient = %s with cooldown %v, want cooldown 1m", c.name, c.cooldown)
+	}
+	s.SetPeers("127.0.0.1:8001", "127.0.0.1:8003")
+	if c := s.clients["127.0.0.1:8003"]; c == nil || c.cooldown != time.Minute {
+		t.Fatalf("client added by SetPeers should use FailoverCooldown")
+	}
+}
+
+func TestClientProbe(t *testing.T) {
+	c := newFakeClient(&faultyGrpcClient{}, ClientOptions{}, breaker.Options{})
+	hc := c.healthClient.(*fakeHealthClient)
+
+	hc.serving = false
+	c.probe()
+	if c.healthy() {
+		t.Fatalf("failed health check should open the breaker")
+	}
+
+	hc.serving = true
+	c.probe()
+	if !c.healthy() {
+		t.Fatalf("passed health check should close the breaker")
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	opts := ClientOptions{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	tests := []struct {
+		name    string
+		fake    *faultyGrpcClient
+		wantErr bool
+		calls   int
+	}{
+		{"recover", &faultyGrpcClient{err: errUnavailable, fails: 2, value: []byte("630")}, false, 3},
+		{"exhausted", &faultyGrpcClient{err: errUnavailable, fails: 3}, true, 3},
+		{"not-retryable", &faultyGrpcClient{err: status.Error(codes.NotFound, "Tom not exist"), fails: 1}, true, 1},
+	}
+	for _, tt := range tests {
+		c := newFakeClient(tt.fake, opts, breaker.Options{MinRequests: 10})
+		out := &pb.Response{}
+		err := c.Get(&pb.Request{Key: "Tom"}, out)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: Get error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if !tt.wantErr && string(out.Value) != "630" {
+			t.Errorf("%s: Get = %q, want 630", tt.name, out.Value)
+		}
+		if tt.fake.calls != tt.calls {
+			t.Errorf("%s: peer called %d times, want %d", tt.name, tt.fake.calls, tt.calls)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	o := ClientOptions{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond, Jitter: 0.1}.withDefaults()
+	tests := []struct {
+		attempt int
+		base    time.Duration
+	}{
+		{1, 10 * time.Millisecond},
+		{2, 20 * time.Millisecond},
+		{3, 40 * time.Millisecond},
+		{4, 50 * time.Millisecond}, // 不超过 MaxBackoff
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			d := o.backoff(tt.attempt)
+			if d < tt.base*9/10 || d > tt.base*11/10 {
+				t.Fatalf("backoff(%d) = %v, want %v ± 10%%", tt.attempt, d, tt.base)
+			}
+		}
+	}
+}
+
+func TestHedgedGet(t *testing.T) {
+	opts := ClientOptions{HedgePercentile: 0.9}
+	slow := &faultyGrpcClient{delay: 300 * time.Millisecond, value: []byte("from slow")}
+	fast := &faultyGrpcClient{value: []byte("from fast")}
+	primary := newFakeClient(slow, opts, breaker.Options{})
+	secondary := newFakeClient(fast, opts, breaker.Options{})
+
+	// 主副本平时 1ms 内返回，这次却变慢了
+	for i := 0; i < minHedgingSamples; i++ {
+		primary.latency.add(time.Millisecond)
+	}
+
+	gp := NewGroup("hedged-get", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}))
+	gp.peers = &fakePicker{replicas: []ProtoGetter{primary, secondary}}
+
+	start := time.Now()
+	view, err := gp.Query("Tom")
+	if err != nil || view.String() != "from fast" {
+		t.Fatalf("Query = %q, %v; want hedged value from secondary", view, err)
+	}
+	if elapsed := time.Since(start); elapsed >= slow.delay {
+		t.Fatalf("hedged Query took %v, should not wait for the slow primary", elapsed)
+	}
+	if fast.callCount() != 1 {
+		t.Fatalf("secondary should be asked once, got %d", fast.callCount())
+	}
+}
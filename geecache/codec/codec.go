@@ -0,0 +1,79 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+/*
+	Codec 在类型化的值与缓存中保存的 []byte 之间转换，供 geecache.TypedGroup 使用。
+	内置 JSON、Protobuf、Gob 与 Msgpack 四种实现，均为零值可用的空结构体，例如 codec.JSON[User]{}。
+*/
+
+// Codec 编码与解码 T 类型的值
+type Codec[T any] interface {
+	Encode(v T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+// JSON 使用 encoding/json
+type JSON[T any] struct{}
+
+func (JSON[T]) Encode(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSON[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// Proto 使用 protobuf 的二进制格式，T 为生成的消息指针类型，例如 *pb.User
+type Proto[T proto.Message] struct{}
+
+func (Proto[T]) Encode(v T) ([]byte, error) {
+	return proto.Marshal(v)
+}
+
+func (Proto[T]) Decode(data []byte) (T, error) {
+	var zero T
+	v := zero.ProtoReflect().New().Interface().(T) // 生成的消息类型在 nil 指针上也可以调用 ProtoReflect
+	if err := proto.Unmarshal(data, v); err != nil {
+		return zero, err
+	}
+	return v, nil
+}
+
+// Gob 使用 encoding/gob，每个值单独编码，包含完整的类型信息
+type Gob[T any] struct{}
+
+func (Gob[T]) Encode(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (Gob[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return v, err
+}
+
+// Msgpack 使用 MessagePack 格式，比 JSON 更紧凑
+type Msgpack[T any] struct{}
+
+func (Msgpack[T]) Encode(v T) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (Msgpack[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := msgpack.Unmarshal(data, &v)
+	return v, err
+}
@@ -0,0 +1,49 @@
+package codec
+
+import (
+	pb "geecache/geecachepb"
+	"google.golang.org/protobuf/proto"
+	"reflect"
+	"testing"
+)
+
+type user struct {
+	Name  string
+	Age   int
+	Roles []string
+}
+
+func TestRoundTrip(t *testing.T) {
+	want := user{Name: "Tom", Age: 30, Roles: []string{"admin"}}
+	codecs := map[string]Codec[user]{
+		"json":    JSON[user]{},
+		"gob":     Gob[user]{},
+		"msgpack": Msgpack[user]{},
+	}
+	for name, c := range codecs {
+		data, err := c.Encode(want)
+		if err != nil {
+			t.Fatalf("%s: Encode failed: %v", name, err)
+		}
+		got, err := c.Decode(data)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: Decode = %+v, %v; want %+v", name, got, err, want)
+		}
+	}
+}
+
+func TestProto(t *testing.T) {
+	c := Proto[*pb.SetRequest]{}
+	want := &pb.SetRequest{Group: "scores", Key: "Tom", Value: []byte("630"), Tags: []string{"people"}}
+	data, err := c.Encode(want)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	got, err := c.Decode(data)
+	if err != nil || !proto.Equal(got, want) {
+		t.Fatalf("Decode = %v, %v; want %v", got, err, want)
+	}
+	if _, err := c.Decode([]byte{0xff}); err == nil {
+		t.Fatalf("Decode should fail on malformed input")
+	}
+}
@@ -0,0 +1,122 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"sync"
+)
+
+/*
+	压缩缓存值：编码后的数据以一个字节的头部开始，标记使用的算法，其后是压缩后的数据。
+	头部让数据可以自描述，解码时不需要知道写入方的配置。None 表示未压缩，头部之后即原始数据。
+*/
+
+// Algorithm 压缩算法，即编码后数据的第一个字节
+type Algorithm byte
+
+const (
+	None Algorithm = iota
+	Snappy
+	Zstd
+	Gzip
+)
+
+func (a Algorithm) String() string {
+	switch a {
+	case None:
+		return "none"
+	case Snappy:
+		return "snappy"
+	case Zstd:
+		return "zstd"
+	case Gzip:
+		return "gzip"
+	}
+	return fmt.Sprintf("Algorithm(%d)", byte(a))
+}
+
+// ErrCorrupt 数据缺少头部、算法未知或无法解压
+var ErrCorrupt = errors.New("compress: corrupt input")
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder // EncodeAll 与 DecodeAll 可以并发调用
+	zstdDecoder *zstd.Decoder
+
+	gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+)
+
+func initZstd() {
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+}
+
+// Encode 使用算法 a 压缩 data，返回带有头部的数据
+func Encode(a Algorithm, data []byte) ([]byte, error) {
+	switch a {
+	case None:
+		return append([]byte{byte(None)}, data...), nil
+	case Snappy:
+		buf := make([]byte, 1+snappy.MaxEncodedLen(len(data)))
+		buf[0] = byte(Snappy)
+		return buf[:1+len(snappy.Encode(buf[1:], data))], nil
+	case Zstd:
+		zstdOnce.Do(initZstd)
+		return zstdEncoder.EncodeAll(data, []byte{byte(Zstd)}), nil
+	case Gzip:
+		var buf bytes.Buffer
+		buf.WriteByte(byte(Gzip))
+		w := gzipWriters.Get().(*gzip.Writer)
+		defer gzipWriters.Put(w)
+		w.Reset(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("compress: unknown algorithm %v", a)
+}
+
+// Decode 按头部标记的算法解压 Encode 返回的数据。算法为 None 时返回的切片与 b 共享底层数组
+func Decode(b []byte) ([]byte, error) {
+	if len(b) == 0 {
+		return nil, fmt.Errorf("%w: missing header", ErrCorrupt)
+	}
+	payload := b[1:]
+	switch Algorithm(b[0]) {
+	case None:
+		return payload, nil
+	case Snappy:
+		data, err := snappy.Decode(nil, payload)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		return data, nil
+	case Zstd:
+		zstdOnce.Do(initZstd)
+		data, err := zstdDecoder.DecodeAll(payload, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		return data, nil
+	case Gzip:
+		r, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("%w: unknown algorithm %v", ErrCorrupt, Algorithm(b[0]))
+}
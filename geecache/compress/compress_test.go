@@ -0,0 +1,38 @@
+package compress
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte(`{"name":"Tom","score":630},`), 100)
+	for _, a := range []Algorithm{None, Snappy, Zstd, Gzip} {
+		enc, err := Encode(a, data)
+		if err != nil {
+			t.Fatalf("%v: Encode failed: %v", a, err)
+		}
+		if Algorithm(enc[0]) != a {
+			t.Fatalf("%v: header = %d", a, enc[0])
+		}
+		if a != None && len(enc) >= len(data)/4 {
+			t.Fatalf("%v: %d bytes compressed to %d, want a better ratio", a, len(data), len(enc))
+		}
+		got, err := Decode(enc)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("%v: Decode mismatch, err %v", a, err)
+		}
+	}
+	if got, err := Decode([]byte{byte(Snappy)}); err == nil {
+		t.Fatalf("Decode of empty snappy payload = %q, want error", got)
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	for _, b := range [][]byte{nil, {0xff, 1, 2}, {byte(Gzip), 1, 2, 3}, {byte(Zstd), 1, 2, 3}} {
+		if _, err := Decode(b); !errors.Is(err, ErrCorrupt) {
+			t.Fatalf("Decode(%v) = %v, want ErrCorrupt", b, err)
+		}
+	}
+}
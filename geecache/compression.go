@@ -0,0 +1,71 @@
+package geecache
+
+import (
+	"geecache/compress"
+	"sync/atomic"
+)
+
+/*
+	透明压缩：开启 GroupOptions.Compression 后，值在存入 mainCache/hotCache 之前压缩，ByteView.Len 即压缩后的大小，
+	因此同样的 cacheBytes 可以容纳更多的值。压缩后的值以 compress 包的头部开始，节点之间原样传输并标记 compressed，
+	接收方不需要与发送方使用相同的配置。Query 返回前解压一次，之后的读取不再解压；写回数据源、保存快照时使用解压后的值。
+	小于阈值或压缩后没有变小的值保持原样，记为跳过。
+*/
+
+const defaultCompressThreshold = 256
+
+// CompressionStats 压缩的统计信息
+type CompressionStats struct {
+	Compressed      int64 // 压缩的值的个数
+	Skipped         int64 // 压缩后没有变小而保持原样的值的个数，不包括小于阈值的值
+	RawBytes        int64 // 压缩的值压缩前的总字节数
+	CompressedBytes int64 // 压缩的值压缩后的总字节数
+}
+
+// Ratio 压缩后与压缩前的字节数之比，没有压缩过任何值时为 1
+func (s CompressionStats) Ratio() float64 {
+	if s.RawBytes == 0 {
+		return 1
+	}
+	return float64(s.CompressedBytes) / float64(s.RawBytes)
+}
+
+type compressionCounters struct {
+	compressed, skipped, rawBytes, compressedBytes atomic.Int64
+}
+
+// CompressionStats 返回压缩的统计信息
+func (g *Group) CompressionStats() CompressionStats {
+	c := &g.compressStats
+	return CompressionStats{
+		Compressed:      c.compressed.Load(),
+		Skipped:         c.skipped.Load(),
+		RawBytes:        c.rawBytes.Load(),
+		CompressedBytes: c.compressedBytes.Load(),
+	}
+}
+
+// compress 按 Group 的配置压缩 value，已压缩、未开启压缩或不需要压缩时原样返回
+func (g *Group) compress(value ByteView) ByteView {
+	if g.compression == compress.None || value.z {
+		return value
+	}
+	threshold := g.compressThreshold
+	if threshold <= 0 {
+		threshold = defaultCompressThreshold
+	}
+	if value.Len() < int64(threshold) {
+		return value
+	}
+	raw, _ := value.raw()
+	b, err := compress.Encode(g.compression, raw)
+	if err != nil || len(b) >= len(raw) {
+		g.compressStats.skipped.Add(1)
+		return value
+	}
+	g.compressStats.compressed.Add(1)
+	g.compressStats.rawBytes.Add(int64(len(raw)))
+	g.compressStats.compressedBytes.Add(int64(len(b)))
+	value.b, value.s, value.z = b, "", true
+	return value
+}
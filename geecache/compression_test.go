@@ -0,0 +1,116 @@
+package geecache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"geecache/breaker"
+	"geecache/compress"
+	pb "geecache/geecachepb"
+	"testing"
+	"time"
+)
+
+var compressible = bytes.Repeat([]byte(`{"name":"Tom","score":630},`), 40)
+
+func TestCompression(t *testing.T) {
+	gp := NewGroupOpts("compressed", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if key == "small" {
+			return []byte("630"), nil
+		}
+		return compressible, nil
+	}), &GroupOptions{Compression: compress.Snappy})
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil}}
+
+	for i := 0; i < 2; i++ {
+		view, err := gp.Query("big")
+		if err != nil || !bytes.Equal(view.ByteSlice(), compressible) || view.String() != string(compressible) {
+			t.Fatalf("Query(big) = %v, want the original value", err)
+		}
+		if i > 0 && (!view.z || view.Len() >= int64(len(compressible))) { // 加载时直接返回原始值，命中缓存时才是压缩后的值
+			t.Fatalf("Len = %d, want the compressed size below %d", view.Len(), len(compressible))
+		}
+	}
+	if view, _ := gp.Query("small"); view.z || view.String() != "630" {
+		t.Fatalf("value below the threshold should not be compressed")
+	}
+
+	stats := gp.CompressionStats()
+	if stats.Compressed != 1 || stats.RawBytes != int64(len(compressible)) || stats.Ratio() >= 0.5 {
+		t.Fatalf("stats = %+v, ratio %.2f", stats, stats.Ratio())
+	}
+	if used := gp.mainCache.bytes(); used >= int64(len(compressible)) {
+		t.Fatalf("mainCache uses %d bytes, want less than the raw size", used)
+	}
+}
+
+func TestCompressionOnTheWire(t *testing.T) {
+	gp := NewGroupOpts("compressed-wire", 2<<10, GetterFunc(notFound), &GroupOptions{Compression: compress.Zstd, WriteQuorum: 2})
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil}}
+	s := newServer("127.0.0.1:8001", nil)
+
+	// 其他节点发来压缩后的值，原样保存
+	enc, _ := compress.Encode(compress.Gzip, compressible)
+	if _, err := s.Put(context.Background(), &pb.SetRequest{Group: gp.name, Key: "Tom", Value: enc, Compressed: true}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	out, err := s.Get(context.Background(), &pb.Request{Group: gp.name, Key: "Tom"})
+	if err != nil || !out.Compressed || !bytes.Equal(out.Value, enc) {
+		t.Fatalf("Get should return the compressed value unchanged, err %v", err)
+	}
+	if view, _ := gp.Query("Tom"); view.String() != string(compressible) {
+		t.Fatalf("Query should decompress the value")
+	}
+
+	// 写入副本时发送压缩后的值
+	peer := newFakePeer(false)
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil, peer}}
+	if err := gp.Set("Jack", compressible, time.Time{}, false); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if !bytes.Equal(peer.data["Jack"], compressible) {
+		t.Fatalf("replica got %d bytes, want the original value", len(peer.data["Jack"]))
+	}
+}
+
+func TestCompressionDiskTier(t *testing.T) {
+	gp := NewGroupOpts("compressed-disk", 300, GetterFunc(notFound), &GroupOptions{Compression: compress.Gzip, DiskDir: t.TempDir(), DiskBytes: 1 << 20})
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil}}
+	gp.localSet("big", ByteView{b: compressible}, &gp.mainCache)
+	gp.localSet("small", ByteView{b: []byte("630")}, &gp.mainCache)
+	for i := 0; i < 10; i++ { // 挤出 mainCache，降级到磁盘
+		gp.localSet(fmt.Sprintf("filler%d", i), ByteView{b: bytes.Repeat([]byte{'x'}, 40)}, &gp.mainCache)
+	}
+	for key, want := range map[string]string{"big": string(compressible), "small": "630"} {
+		if view, err := gp.Query(key); err != nil || view.String() != want {
+			t.Fatalf("Query(%s) after promotion = %q, %v", key, view, err)
+		}
+	}
+}
+
+// 已压缩的值原样写入磁盘，不需要先解压；未开启压缩的 Group 写入解压后的值
+func TestCompressionDiskValue(t *testing.T) {
+	enc, _ := compress.Encode(compress.Snappy, compressible)
+	view := ByteView{b: enc, z: true}
+	gp := &Group{compression: compress.Gzip}
+	if b, err := gp.diskValue(view); err != nil || &b[0] != &enc[0] {
+		t.Fatalf("compressed value should be written to disk as is, err %v", err)
+	}
+	gp = &Group{}
+	if b, err := gp.diskValue(view); err != nil || !bytes.Equal(b, compressible) {
+		t.Fatalf("group without compression should write the decompressed value, err %v", err)
+	}
+}
+
+func TestCompressionFromPeer(t *testing.T) {
+	enc, _ := compress.Encode(compress.Snappy, compressible)
+	fake := &faultyGrpcClient{value: enc, compressed: true}
+	c := newFakeClient(fake, ClientOptions{}, breaker.Options{})
+	gp := NewGroup("compressed-peer", 2<<10, GetterFunc(notFound))
+	gp.peers = &fakePicker{replicas: []ProtoGetter{c}}
+
+	view, err := gp.Query("Tom")
+	if err != nil || !view.z || view.String() != string(compressible) {
+		t.Fatalf("Query = %v; the compressed flag should survive the client", err)
+	}
+}
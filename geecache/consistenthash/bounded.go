@@ -0,0 +1,146 @@
+package consistenthash
+
+import (
+	"math"
+	"sync"
+)
+
+// Bounded 有界负载的一致性哈希（Mirrokni 等，Consistent Hashing with Bounded Loads）。
+// 每个节点同时处理的请求数不超过 ceil((1+ε)×平均负载)，其中平均负载按权重分摊；
+// key 的主节点已满时，沿偏好列表（哈希环上即顺时针的后继节点）溢出到下一个未满的节点。
+// 负载由 Acquire 与 Release 实时统计，因此热点 key 只会在主节点繁忙时才分散到其他节点。
+// FindNodes 不受负载影响，仍然返回底层的偏好列表，key 的所有者（副本）不会随负载变化
+type Bounded struct {
+	Placement // 底层的放置算法，决定 key 的偏好列表
+
+	epsilon float64
+
+	mu          sync.Mutex     // 保护负载计数，以及 SetNodes 与 pick 对底层 Placement 的访问
+	loads       map[string]int // 每个节点正在处理的请求数
+	total       int            // 全部节点正在处理的请求数之和
+	totalWeight int
+}
+
+// NewBounded 在 p 的基础上启用有界负载，epsilon 必须大于 0，越小负载越均衡，但 key 越容易离开主节点
+func NewBounded(p Placement, epsilon float64) *Bounded {
+	if epsilon <= 0 {
+		panic("consistenthash: bounded load epsilon must be positive")
+	}
+	b := &Bounded{
+		Placement: p,
+		epsilon:   epsilon,
+		loads:     make(map[string]int),
+	}
+	for _, nodeName := range p.Nodes() {
+		b.totalWeight += p.Weight(nodeName)
+	}
+	return b
+}
+
+// SetNodes 更新底层的节点，被移除节点的负载不再计入
+func (b *Bounded) SetNodes(weights map[string]int) (added, removed []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	added, removed = b.Placement.SetNodes(weights)
+	for _, nodeName := range removed {
+		b.total -= b.loads[nodeName]
+		delete(b.loads, nodeName)
+	}
+	b.totalWeight = 0
+	for _, nodeName := range b.Placement.Nodes() {
+		b.totalWeight += b.Placement.Weight(nodeName)
+	}
+	return added, removed
+}
+
+// FindNode 按当前负载返回 key 应该访问的节点，但不计入负载。所有节点空闲时与底层的 FindNode 相同
+func (b *Bounded) FindNode(key string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.pick(key)
+}
+
+// Acquire 按当前负载为 key 选择节点，并将该节点的负载加 1。请求结束后必须调用 Release
+func (b *Bounded) Acquire(key string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	nodeName := b.pick(key)
+	if nodeName != "" {
+		b.loads[nodeName]++
+		b.total++
+	}
+	return nodeName
+}
+
+// AcquireFrom 与 Acquire 相同，但由调用方给出候选节点：nodeName 未满时选择 nodeName，
+// 否则沿 spill 的顺序选择第一个未满的节点，全部已满时选择余量最大的节点。
+// 调用方借此跳过当前节点与不健康的节点。请求结束后必须调用 Release
+func (b *Bounded) AcquireFrom(nodeName string, spill []string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	nodeName = b.first(nodeName, spill)
+	b.loads[nodeName]++
+	b.total++
+	return nodeName
+}
+
+// Release 将 Acquire 选中节点的负载减 1
+func (b *Bounded) Release(nodeName string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.loads[nodeName] > 0 { // 节点可能已在 SetNodes 中被移除
+		b.loads[nodeName]--
+		b.total--
+	}
+}
+
+// Load 返回节点正在处理的请求数
+func (b *Bounded) Load(nodeName string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.loads[nodeName]
+}
+
+// Capacity 返回再接收一个请求时节点的负载上限
+func (b *Bounded) Capacity(nodeName string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.capacity(nodeName)
+}
+
+// capacity 按权重分摊 total+1 个请求，上限为 ceil((1+ε)×分摊值)
+func (b *Bounded) capacity(nodeName string) int {
+	if b.totalWeight == 0 {
+		return 0
+	}
+	avg := float64(b.total+1) * float64(b.Placement.Weight(nodeName)) / float64(b.totalWeight)
+	return int(math.Ceil((1 + b.epsilon) * avg))
+}
+
+// pick 沿偏好列表返回第一个未满的节点。上限之和不小于 total+1，因此总能找到
+func (b *Bounded) pick(key string) string {
+	nodes := b.Placement.FindNodes(key, len(b.Placement.Nodes()))
+	if len(nodes) == 0 {
+		return ""
+	}
+	return b.first(nodes[0], nodes[1:])
+}
+
+// first 返回 nodeName 与 spill 中第一个未满的节点。候选不包括全部节点时可能都已满，此时返回余量最大的节点，
+// 相同时优先 nodeName
+func (b *Bounded) first(nodeName string, spill []string) string {
+	best, room := nodeName, b.capacity(nodeName)-b.loads[nodeName]
+	if room > 0 {
+		return nodeName
+	}
+	for _, n := range spill {
+		r := b.capacity(n) - b.loads[n]
+		if r > 0 {
+			return n
+		}
+		if r > room {
+			best, room = n, r
+		}
+	}
+	return best
+}
@@ -0,0 +1,163 @@
+package consistenthash
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// zipfKeys 生成服从 Zipf 分布的 key 序列，少数 key 占据绝大部分请求
+func zipfKeys(n int, s float64) []string {
+	zipf := rand.NewZipf(rand.New(rand.NewSource(1)), s, 1, 9999)
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = "key" + strconv.FormatUint(zipf.Uint64(), 10)
+	}
+	return keys
+}
+
+// simulate 模拟同时处理 inflight 个请求的负载：每个新请求到来时，最早的请求结束。
+// 返回各节点的峰值负载，并检查每次分配后节点负载都不超过上限
+func simulate(t *testing.T, b *Bounded, keys []string, inflight int) map[string]int {
+	peak := make(map[string]int)
+	var window []string
+	for _, key := range keys {
+		if len(window) == inflight {
+			b.Release(window[0])
+			window = window[1:]
+		}
+		limit := b.Capacity(b.FindNode(key))
+		node := b.Acquire(key)
+		if load := b.Load(node); load > limit {
+			t.Fatalf("node %s load %d exceeds capacity %d", node, load, limit)
+		}
+		if load := b.Load(node); load > peak[node] {
+			peak[node] = load
+		}
+		window = append(window, node)
+	}
+	for _, node := range window {
+		b.Release(node)
+	}
+	return peak
+}
+
+func TestBoundedZipf(t *testing.T) {
+	const inflight = 100
+	keys := zipfKeys(50000, 1.5)
+	for name, newPlacement := range placements() {
+		p := newPlacement()
+		p.SetNodes(testNodes(5))
+
+		// 不限制负载时，热点 key 的主节点远超平均负载 inflight/5
+		var hottest int
+		loads := make(map[string]int)
+		for i, key := range keys {
+			if i >= inflight {
+				loads[p.FindNode(keys[i-inflight])]--
+			}
+			node := p.FindNode(key)
+			if loads[node]++; loads[node] > hottest {
+				hottest = loads[node]
+			}
+		}
+		if hottest <= 2*inflight/5 {
+			t.Fatalf("%s: workload is not skewed enough, hottest unbounded load %d", name, hottest)
+		}
+
+		b := NewBounded(p, 0.25)
+		peak := simulate(t, b, keys, inflight)
+		for node, load := range peak {
+			if load > 25 { // ceil(1.25 × 100/5)
+				t.Errorf("%s: node %s peak load %d exceeds the bound", name, node, load)
+			}
+		}
+		t.Logf("%-10s unbounded hottest=%d bounded peak=%v", name, hottest, peak)
+		for _, node := range p.Nodes() {
+			if b.Load(node) != 0 {
+				t.Fatalf("%s: node %s load should drop to 0 after release", name, node)
+			}
+		}
+	}
+}
+
+func TestBoundedWeighted(t *testing.T) {
+	p := New(50, nil)
+	p.SetNodes(map[string]int{"a": 1, "b": 3})
+	b := NewBounded(p, 0.1)
+	for i := 0; i < 1000; i++ {
+		b.Acquire("hot") // 同一个 key 的请求持续积压
+	}
+	// 上限按权重分摊：a 约 1.1×250，b 约 1.1×750
+	if la, lb := b.Load("a"), b.Load("b"); la > 276 || lb > 826 || la+lb != 1000 {
+		t.Errorf("loads a=%d b=%d do not follow the weighted bound", la, lb)
+	}
+}
+
+func TestBoundedSpill(t *testing.T) {
+	p := New(50, nil)
+	p.SetNodes(testNodes(4))
+	b := NewBounded(p, 0.5)
+
+	// 空闲时与底层一致
+	owner := p.FindNode("hot")
+	if b.FindNode("hot") != owner {
+		t.Fatalf("idle bounded placement should pick the owner")
+	}
+
+	// 主节点满后溢出到偏好列表中的下一个节点
+	next := p.FindNodes("hot", 2)[1]
+	var spilled string
+	for i := 0; i < 10 && spilled == ""; i++ {
+		if node := b.Acquire("hot"); node != owner {
+			spilled = node
+		}
+	}
+	if spilled != next {
+		t.Fatalf("hot key should spill to the next node %s, got %q", next, spilled)
+	}
+
+	// 主节点空闲后重新回到主节点
+	for b.Load(owner) > 0 {
+		b.Release(owner)
+	}
+	if b.FindNode("hot") != owner {
+		t.Fatalf("key should return to its owner once the owner has capacity")
+	}
+
+	// 被移除节点的负载不再计入
+	nodes := testNodes(4)
+	delete(nodes, next)
+	b.SetNodes(nodes)
+	if b.Load(next) != 0 || b.total != 0 {
+		t.Fatalf("loads of removed node should be dropped, total = %d", b.total)
+	}
+	b.Release(next) // 对已移除的节点无影响
+	if b.total != 0 {
+		t.Fatalf("Release of removed node should be ignored")
+	}
+}
+
+func TestBoundedAcquireFrom(t *testing.T) {
+	p := New(50, nil)
+	p.SetNodes(map[string]int{"a": 1, "b": 1, "c": 1, "d": 1})
+	b := NewBounded(p, 0.25)
+
+	// 只在调用方给出的候选中选择，FindNodes 不受负载影响
+	want := p.FindNodes("hot", 4)
+	counts := make(map[string]int)
+	for i := 0; i < 40; i++ {
+		counts[b.AcquireFrom("a", []string{"b", "c"})]++
+	}
+	if counts["d"] != 0 || counts["a"]+counts["b"]+counts["c"] != 40 {
+		t.Fatalf("AcquireFrom picked a node outside the candidates: %v", counts)
+	}
+	// 候选都已满时分给余量最大的节点，负载保持均衡
+	if counts["a"] > 14 || counts["b"] > 14 || counts["c"] > 14 {
+		t.Fatalf("loads should stay balanced among the candidates: %v", counts)
+	}
+	if got := b.FindNodes("hot", 4); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("FindNodes = %v, want the underlying preference list %v", got, want)
+	}
+}
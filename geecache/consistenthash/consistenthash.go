@@ -12,8 +12,14 @@ type HashFunc func(data []byte) uint32
 type ConsistHash struct {
 	hashFunc HashFunc       // 哈希函数
 	replicas int            // 虚拟节点倍数
-	hashRing []int          // 虚拟节点构成的哈希环
+	hashRing []int          // 虚拟节点构成的哈希环，已排序且不重复
 	hashMap  map[int]string // 虚拟节点与真实节点的映射表
+	weights  map[string]int // 真实节点的权重，虚拟节点数为 replicas*weight
+
+	// 不同真实节点的虚拟节点哈希值可能相同，claims 记录每个哈希值的全部所属节点。
+	// 冲突时由名称最小的节点获得该虚拟节点，因此结果与节点的添加顺序无关；
+	// 获得者被移除后，虚拟节点交给剩余节点中名称最小的一个
+	claims map[int][]string
 }
 
 // New 允许自定义虚拟节点倍数和 HashFunc 函数。
@@ -26,32 +32,242 @@ func New(replicas int, hashFunc HashFunc) *ConsistHash {
 		replicas: replicas,
 		hashRing: nil,
 		hashMap:  make(map[int]string),
+		weights:  make(map[string]int),
+		claims:   make(map[int][]string),
 	}
 }
 
-// AddNode 允许传入 0 或 多个真实节点的名称
+// AddNode 允许传入 0 或 多个真实节点的名称，每个节点的权重均为 1
 func (ch *ConsistHash) AddNode(nodeNames ...string) {
+	weights := make(map[string]int, len(nodeNames))
 	for _, nodeName := range nodeNames {
-		for i := 0; i < ch.replicas; i++ {
-			hashValue := int(ch.hashFunc([]byte(strconv.Itoa(i) + nodeName))) // 计算虚拟节点的哈希值
-			ch.hashRing = append(ch.hashRing, hashValue)                      // 将虚拟节点哈希值保存起来
-			ch.hashMap[hashValue] = nodeName                                  // 构建每个节点对应的虚拟节点哈希值与节点名的映射
+		weights[nodeName] = 1
+	}
+	ch.AddWeightedNode(weights)
+}
+
+// AddWeightedNode 按权重添加真实节点，节点的虚拟节点数为 replicas*weight，
+// 因此分到的 key 的比例与权重成正比。权重小于 1 时按 1 计算；节点已存在时更新其权重
+func (ch *ConsistHash) AddWeightedNode(weights map[string]int) {
+	for nodeName, weight := range weights {
+		if weight < 1 {
+			weight = 1
+		}
+		if old, ok := ch.weights[nodeName]; ok {
+			if old == weight {
+				continue
+			}
+			ch.removeVirtual(nodeName)
+		}
+		ch.weights[nodeName] = weight
+		for _, hashValue := range ch.virtualNodes(nodeName, weight) {
+			ch.claim(hashValue, nodeName)
+		}
+	}
+	ch.rebuildRing()
+}
+
+// RemoveNode 从哈希环上移除真实节点及其全部虚拟节点
+func (ch *ConsistHash) RemoveNode(nodeNames ...string) {
+	for _, nodeName := range nodeNames {
+		if _, ok := ch.weights[nodeName]; !ok {
+			continue
+		}
+		ch.removeVirtual(nodeName)
+		delete(ch.weights, nodeName)
+	}
+	ch.rebuildRing()
+}
+
+// SetNodes 将哈希环上的真实节点更新为 weights 中的节点：只增删有变化的节点，未变化节点的虚拟节点保持不动。
+// 返回新增（含权重变化）与移除的节点，均已排序
+func (ch *ConsistHash) SetNodes(weights map[string]int) (added, removed []string) {
+	added, removed, weights = diffNodes(ch.weights, weights)
+	changed := make(map[string]int, len(added))
+	for _, nodeName := range added {
+		changed[nodeName] = weights[nodeName]
+	}
+	ch.RemoveNode(removed...)
+	ch.AddWeightedNode(changed)
+	return added, removed
+}
+
+// Nodes 返回哈希环上全部真实节点的名称，已排序
+func (ch *ConsistHash) Nodes() []string {
+	return sortedNodes(ch.weights)
+}
+
+// Clone 返回哈希环的一份拷贝，用于保存旧版本，与 MovedRanges 配合比较
+func (ch *ConsistHash) Clone() *ConsistHash {
+	c := New(ch.replicas, ch.hashFunc)
+	c.hashRing = append([]int(nil), ch.hashRing...)
+	for h, nodeName := range ch.hashMap {
+		c.hashMap[h] = nodeName
+	}
+	for nodeName, weight := range ch.weights {
+		c.weights[nodeName] = weight
+	}
+	for h, nodes := range ch.claims {
+		c.claims[h] = append([]string(nil), nodes...)
+	}
+	return c
+}
+
+// virtualNodes 计算真实节点全部虚拟节点的哈希值
+func (ch *ConsistHash) virtualNodes(nodeName string, weight int) []int {
+	hashValues := make([]int, ch.replicas*weight)
+	for i := range hashValues {
+		hashValues[i] = int(ch.hashFunc([]byte(strconv.Itoa(i) + nodeName))) // 计算虚拟节点的哈希值
+	}
+	return hashValues
+}
+
+// claim 将哈希值为 hashValue 的虚拟节点登记到 nodeName 名下，冲突时名称最小的节点获得该虚拟节点
+func (ch *ConsistHash) claim(hashValue int, nodeName string) {
+	nodes := ch.claims[hashValue]
+	i := sort.SearchStrings(nodes, nodeName)
+	nodes = append(nodes, "")
+	copy(nodes[i+1:], nodes[i:])
+	nodes[i] = nodeName
+	ch.claims[hashValue] = nodes
+	ch.hashMap[hashValue] = nodes[0] // 构建每个节点对应的虚拟节点哈希值与节点名的映射
+}
+
+// removeVirtual 撤销 nodeName 的全部虚拟节点，调用方负责 rebuildRing
+func (ch *ConsistHash) removeVirtual(nodeName string) {
+	for _, hashValue := range ch.virtualNodes(nodeName, ch.weights[nodeName]) {
+		nodes := ch.claims[hashValue]
+		i := sort.SearchStrings(nodes, nodeName)
+		if i == len(nodes) || nodes[i] != nodeName {
+			continue // 同一节点的两个虚拟节点冲突时，第二次已被移除
 		}
+		nodes = append(nodes[:i], nodes[i+1:]...)
+		if len(nodes) == 0 {
+			delete(ch.claims, hashValue)
+			delete(ch.hashMap, hashValue)
+			continue
+		}
+		ch.claims[hashValue] = nodes
+		ch.hashMap[hashValue] = nodes[0]
+	}
+}
+
+// rebuildRing 根据 hashMap 重新生成有序的哈希环
+func (ch *ConsistHash) rebuildRing() {
+	ch.hashRing = ch.hashRing[:0]
+	for hashValue := range ch.hashMap {
+		ch.hashRing = append(ch.hashRing, hashValue) // 将虚拟节点哈希值保存起来
 	}
 	sort.Ints(ch.hashRing) // 环上的哈希值排序
 }
 
+// Weight 返回真实节点的权重，节点不存在时返回 0
+func (ch *ConsistHash) Weight(nodeName string) int {
+	return ch.weights[nodeName]
+}
+
 // FindNode 获取真实节点
 func (ch *ConsistHash) FindNode(key string) string {
+	if len(ch.hashRing) == 0 {
+		return ""
+	}
+	return ch.ownerAt(int(ch.hashFunc([]byte(key)))) // 找到第一个大于等于它的虚拟节点
+}
+
+// FindNodes 返回 key 的有序偏好列表：从 key 在哈希环上的位置出发，顺时针依次找到的 n 个不同的真实节点。
+// 列表首个节点即 FindNode 的结果；真实节点数不足 n 时，返回全部真实节点。
+func (ch *ConsistHash) FindNodes(key string, n int) []string {
+	length := len(ch.hashRing)
+	if length == 0 || n <= 0 {
+		return nil
+	}
+	hashValue := int(ch.hashFunc([]byte(key)))
+	index := sort.Search(length, func(i int) bool {
+		return ch.hashRing[i] >= hashValue
+	})
+
+	nodes := make([]string, 0, n)
+	seen := make(map[string]struct{}, n)
+	for i := 0; i < length && len(nodes) < n; i++ {
+		node := ch.hashMap[ch.hashRing[(index+i)%length]]
+		if _, ok := seen[node]; ok { // 同一真实节点的其他虚拟节点，跳过
+			continue
+		}
+		seen[node] = struct{}{}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// Range 哈希环上的一段区间 (Start, End]，哈希值落在其中的 key 的主节点由 From 变为 To。
+// Start >= End 时区间越过环尾，即 (Start, MaxUint32] 与 [0, End] 两段
+type Range struct {
+	Start, End uint32
+	From, To   string
+}
+
+// Contains 判断哈希值是否落在区间内
+func (r Range) Contains(hashValue uint32) bool {
+	if r.Start < r.End {
+		return hashValue > r.Start && hashValue <= r.End
+	}
+	return hashValue > r.Start || hashValue <= r.End
+}
+
+// MovedRanges 比较同一哈希函数下的两个版本的哈希环，返回主节点发生变化的全部区间，相邻且迁移方向相同的区间会被合并。
+// 某个版本为空环时，对应的节点名为空字符串
+func MovedRanges(old, new *ConsistHash) []Range {
+	// 两个环的全部虚拟节点把哈希空间切分成若干段，每段内的 key 在两个环上都落到同一个虚拟节点
+	bounds := make([]int, 0, len(old.hashRing)+len(new.hashRing))
+	bounds = append(bounds, old.hashRing...)
+	bounds = append(bounds, new.hashRing...)
+	sort.Ints(bounds)
+	n := 0
+	for i, b := range bounds { // 去重
+		if i == 0 || b != bounds[n-1] {
+			bounds[n] = b
+			n++
+		}
+	}
+	bounds = bounds[:n]
+	if len(bounds) == 0 {
+		return nil
+	}
+
+	var ranges []Range
+	for i, end := range bounds {
+		start := bounds[(i+len(bounds)-1)%len(bounds)] // 第一段的起点是最后一个边界，越过环尾
+		from, to := old.ownerAt(end), new.ownerAt(end)
+		if from == to {
+			continue
+		}
+		if last := len(ranges) - 1; last >= 0 && ranges[last].End == uint32(start) &&
+			ranges[last].From == from && ranges[last].To == to {
+			ranges[last].End = uint32(end)
+			continue
+		}
+		ranges = append(ranges, Range{Start: uint32(start), End: uint32(end), From: from, To: to})
+	}
+	// 首尾两段在环上相邻时合并
+	if len(ranges) > 1 {
+		first, last := ranges[0], ranges[len(ranges)-1]
+		if last.End == first.Start && last.From == first.From && last.To == first.To {
+			ranges[0].Start = last.Start
+			ranges = ranges[:len(ranges)-1]
+		}
+	}
+	return ranges
+}
+
+// ownerAt 返回哈希值为 hashValue 的 key 的主节点，空环返回空字符串
+func (ch *ConsistHash) ownerAt(hashValue int) string {
 	length := len(ch.hashRing)
 	if length == 0 {
 		return ""
 	}
-	hashValue := int(ch.hashFunc([]byte(key)))
 	index := sort.Search(length, func(i int) bool {
-		return ch.hashRing[i] >= hashValue // 找到第一个大于它的虚拟节点
+		return ch.hashRing[i] >= hashValue
 	})
-	//k := ch.hashRing[index%len(ch.hashRing)]
 	if index == length {
 		index = 0
 	}
@@ -1,6 +1,10 @@
 package consistenthash
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"reflect"
 	"strconv"
 	"testing"
 )
@@ -44,3 +48,179 @@ func TestHashing(t *testing.T) {
 		}
 	}
 }
+
+// 沿用 TestHashing 中的哈希环：2, 4, 6, 12, 14, 16, 22, 24, 26
+// 用例 11 从虚拟节点 12 出发，依次经过 14、16，对应真实节点 2、4、6；
+// 用例 27 越过环尾回到 02，再依次经过 04、06。
+func TestFindNodes(t *testing.T) {
+	hash := New(3, func(data []byte) uint32 {
+		num, err := strconv.Atoi(string(data))
+		if err != nil {
+			panic("类型转换错误")
+		}
+		return uint32(num)
+	})
+	hash.AddNode("6", "4", "2")
+
+	testCase := []struct {
+		key   string
+		n     int
+		nodes []string
+	}{
+		{"11", 1, []string{"2"}},
+		{"11", 2, []string{"2", "4"}},
+		{"27", 3, []string{"2", "4", "6"}},
+		{"23", 3, []string{"4", "6", "2"}},
+		{"23", 5, []string{"4", "6", "2"}}, // 真实节点不足 n 个
+		{"23", 0, nil},
+	}
+	for _, tc := range testCase {
+		got := hash.FindNodes(tc.key, tc.n)
+		if !reflect.DeepEqual(got, tc.nodes) {
+			t.Errorf("FindNodes(%s, %d) = %v, should be %v", tc.key, tc.n, got, tc.nodes)
+		}
+		if len(got) > 0 && got[0] != hash.FindNode(tc.key) {
+			t.Errorf("FindNodes(%s) should start with FindNode result", tc.key)
+		}
+	}
+}
+
+// sha256Hash 分布均匀的哈希函数。crc32 对 "虚拟节点编号+地址" 这种只差几个字符的输入分布较差，
+// 测试权重时改用它，避免哈希函数本身的偏差掩盖权重的效果
+func sha256Hash(data []byte) uint32 {
+	sum := sha256.Sum256(data)
+	return binary.BigEndian.Uint32(sum[:4])
+}
+
+// 各节点分到的 key 的比例应与权重成正比
+func TestWeightedDistribution(t *testing.T) {
+	weights := map[string]int{
+		"127.0.0.1:8001": 1,
+		"127.0.0.1:8002": 2,
+		"127.0.0.1:8003": 3,
+		"127.0.0.1:8004": 8,
+	}
+	hash := New(50, sha256Hash)
+	hash.AddWeightedNode(weights)
+
+	const keys = 100000
+	counts := make(map[string]int, len(weights))
+	for i := 0; i < keys; i++ {
+		counts[hash.FindNode("key"+strconv.Itoa(i))]++
+	}
+
+	var total int
+	for _, w := range weights {
+		total += w
+	}
+	for node, w := range weights {
+		want := float64(w) / float64(total)
+		got := float64(counts[node]) / keys
+		if math.Abs(got-want)/want > 0.15 { // 允许 15% 的相对误差
+			t.Errorf("node %s (weight %d) got %.3f of keys, want %.3f", node, w, got, want)
+		}
+	}
+}
+
+func numberHash(data []byte) uint32 {
+	num, err := strconv.Atoi(string(data))
+	if err != nil {
+		panic("类型转换错误")
+	}
+	return uint32(num)
+}
+
+func TestRemoveNode(t *testing.T) {
+	hash := New(3, numberHash)
+	hash.AddNode("6", "4", "2", "8")
+	if hash.FindNode("27") != "8" {
+		t.Fatalf("27 should map to 8")
+	}
+	hash.RemoveNode("8")
+	if hash.FindNode("27") != "2" {
+		t.Errorf("27 should map back to 2 after removing 8")
+	}
+	if !reflect.DeepEqual(hash.hashRing, []int{2, 4, 6, 12, 14, 16, 22, 24, 26}) {
+		t.Errorf("virtual nodes of 8 not removed: %v", hash.hashRing)
+	}
+
+	added, removed := hash.SetNodes(map[string]int{"2": 1, "4": 1, "8": 1})
+	if !reflect.DeepEqual(added, []string{"8"}) || !reflect.DeepEqual(removed, []string{"6"}) {
+		t.Errorf("SetNodes diff = +%v -%v, want +[8] -[6]", added, removed)
+	}
+	if !reflect.DeepEqual(hash.Nodes(), []string{"2", "4", "8"}) {
+		t.Errorf("Nodes = %v", hash.Nodes())
+	}
+}
+
+// 虚拟节点哈希冲突时，结果与节点的添加顺序无关
+func TestCollision(t *testing.T) {
+	// 所有虚拟节点都落在同一个位置
+	collide := func(data []byte) uint32 { return 10 }
+
+	ab, ba := New(2, collide), New(2, collide)
+	ab.AddNode("a")
+	ab.AddNode("b")
+	ba.AddNode("b")
+	ba.AddNode("a")
+	if ab.FindNode("key") != "a" || ba.FindNode("key") != "a" {
+		t.Fatalf("collision should be resolved to the smallest node regardless of order")
+	}
+	if len(ab.hashRing) != 1 {
+		t.Fatalf("colliding virtual nodes should share one position, got %v", ab.hashRing)
+	}
+
+	// 获得者被移除后，由剩余的节点接管
+	ab.RemoveNode("a")
+	if ab.FindNode("key") != "b" {
+		t.Fatalf("b should take over the virtual node after a is removed")
+	}
+	ab.RemoveNode("b")
+	if ab.FindNode("key") != "" || len(ab.hashMap) != 0 {
+		t.Fatalf("ring should be empty")
+	}
+}
+
+func TestMovedRanges(t *testing.T) {
+	old := New(3, numberHash)
+	old.AddNode("6", "4", "2")
+	cur := old.Clone()
+	cur.AddNode("8")
+
+	// 新增节点 8 的虚拟节点 08/18/28 从节点 2 手中接过 (6, 8]、(16, 18]、(26, 28]
+	want := []Range{
+		{Start: 6, End: 8, From: "2", To: "8"},
+		{Start: 16, End: 18, From: "2", To: "8"},
+		{Start: 26, End: 28, From: "2", To: "8"},
+	}
+	got := MovedRanges(old, cur)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("MovedRanges = %+v, want %+v", got, want)
+	}
+	for _, key := range []int{7, 8, 17, 27, 28} {
+		if !got[0].Contains(uint32(key)) && !got[1].Contains(uint32(key)) && !got[2].Contains(uint32(key)) {
+			t.Errorf("key %d should be in a moved range", key)
+		}
+	}
+	if reverse := MovedRanges(cur, old); len(reverse) != 3 || reverse[0].From != "8" || reverse[0].To != "2" {
+		t.Errorf("reverse MovedRanges = %+v", reverse)
+	}
+	if MovedRanges(old, old.Clone()) != nil {
+		t.Errorf("identical rings should have no moved ranges")
+	}
+
+	// 移除节点 2 后，它的区间交给顺时针方向的下一个节点 4，其中 (26, 2] 越过环尾
+	cur = old.Clone()
+	cur.RemoveNode("2")
+	want = []Range{
+		{Start: 26, End: 2, From: "2", To: "4"},
+		{Start: 6, End: 12, From: "2", To: "4"},
+		{Start: 16, End: 22, From: "2", To: "4"},
+	}
+	if got = MovedRanges(old, cur); !reflect.DeepEqual(got, want) {
+		t.Fatalf("MovedRanges = %+v, want %+v", got, want)
+	}
+	if !got[0].Contains(30) || !got[0].Contains(1) || got[0].Contains(3) {
+		t.Errorf("wrapped range (26, 2] contains wrong keys")
+	}
+}
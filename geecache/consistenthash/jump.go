@@ -0,0 +1,93 @@
+package consistenthash
+
+import "hash/crc32"
+
+// Jump 跳跃一致性哈希（Lamping & Veach）：不占用额外内存，查找为 O(log n)，负载非常均衡。
+// 它只能把 key 映射到编号 [0, n) 的桶，因此节点按名称排序后编号，权重为 w 的节点占 w 个桶。
+// 只有在编号末尾增删桶时迁移量最小；按名称排序意味着新节点插入中间时会迁移更多的 key，
+// 但可以保证各个进程对同一组节点得到相同的编号
+type Jump struct {
+	hashFunc HashFunc
+	weights  map[string]int
+	buckets  []string // 第 i 个桶所属的节点
+}
+
+// NewJump 实例化 Jump，hashFunc 为 nil 时默认使用 crc32.ChecksumIEEE
+func NewJump(hashFunc HashFunc) *Jump {
+	if hashFunc == nil {
+		hashFunc = crc32.ChecksumIEEE
+	}
+	return &Jump{
+		hashFunc: hashFunc,
+		weights:  make(map[string]int),
+	}
+}
+
+// jumpHash 将 64 位的 key 映射到 [0, numBuckets) 中的一个桶
+func jumpHash(key uint64, numBuckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(numBuckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+func (j *Jump) SetNodes(weights map[string]int) (added, removed []string) {
+	added, removed, j.weights = diffNodes(j.weights, weights)
+	j.buckets = j.buckets[:0]
+	for _, nodeName := range sortedNodes(j.weights) {
+		for i := 0; i < j.weights[nodeName]; i++ {
+			j.buckets = append(j.buckets, nodeName)
+		}
+	}
+	return added, removed
+}
+
+func (j *Jump) FindNode(key string) string {
+	if len(j.buckets) == 0 {
+		return ""
+	}
+	return j.buckets[jumpHash(hash64(j.hashFunc, key), len(j.buckets))]
+}
+
+// FindNodes 首个节点与 FindNode 相同，之后不断对 key 的哈希值再次混合，重新选桶，跳过已选中的节点。
+// 多次尝试仍凑不够 n 个时，按名称顺序补齐
+func (j *Jump) FindNodes(key string, n int) []string {
+	if len(j.buckets) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(j.weights) {
+		n = len(j.weights)
+	}
+	nodes := make([]string, 0, n)
+	seen := make(map[string]struct{}, n)
+	h := hash64(j.hashFunc, key)
+	for attempt := 0; len(nodes) < n && attempt < 32*n; attempt++ {
+		nodeName := j.buckets[jumpHash(h, len(j.buckets))]
+		h = mix64(h + 1)
+		if _, ok := seen[nodeName]; ok {
+			continue
+		}
+		seen[nodeName] = struct{}{}
+		nodes = append(nodes, nodeName)
+	}
+	for _, nodeName := range sortedNodes(j.weights) {
+		if len(nodes) >= n {
+			break
+		}
+		if _, ok := seen[nodeName]; !ok {
+			nodes = append(nodes, nodeName)
+		}
+	}
+	return nodes
+}
+
+func (j *Jump) Nodes() []string {
+	return sortedNodes(j.weights)
+}
+
+func (j *Jump) Weight(nodeName string) int {
+	return j.weights[nodeName]
+}
@@ -0,0 +1,140 @@
+package consistenthash
+
+import "hash/crc32"
+
+// DefaultMaglevTableSize Maglev 查找表的默认大小，必须是质数，并且远大于节点数
+const DefaultMaglevTableSize = 65537
+
+// Maglev 哈希（Google Maglev 负载均衡器）：每个节点按各自的排列轮流填充一张固定大小的查找表，
+// 查找只需 O(1)，负载几乎完全均衡；节点增删时大部分表项保持不变
+type Maglev struct {
+	hashFunc HashFunc
+	size     int // 查找表大小 M
+	weights  map[string]int
+	nodes    []string // 已排序
+	table    []int    // 查找表，值为 nodes 的下标
+}
+
+// NewMaglev 实例化 Maglev，tableSize 为 0 时使用 DefaultMaglevTableSize，不是质数时向上取到下一个质数；
+// hashFunc 为 nil 时默认使用 crc32.ChecksumIEEE
+func NewMaglev(tableSize int, hashFunc HashFunc) *Maglev {
+	if tableSize <= 0 {
+		tableSize = DefaultMaglevTableSize
+	}
+	tableSize = nextPrime(tableSize)
+	if hashFunc == nil {
+		hashFunc = crc32.ChecksumIEEE
+	}
+	return &Maglev{
+		hashFunc: hashFunc,
+		size:     tableSize,
+		weights:  make(map[string]int),
+	}
+}
+
+func (m *Maglev) SetNodes(weights map[string]int) (added, removed []string) {
+	added, removed, m.weights = diffNodes(m.weights, weights)
+	m.nodes = sortedNodes(m.weights)
+	m.populate()
+	return added, removed
+}
+
+// nextPrime 返回不小于 n 的最小质数。表大小不是质数时，skip 与 M 可能不互质，
+// 节点的排列无法遍历整张表，populate 会陷入死循环
+func nextPrime(n int) int {
+	if n <= 2 {
+		return 2
+	}
+	if n%2 == 0 {
+		n++
+	}
+	for ; ; n += 2 {
+		prime := true
+		for d := 3; d*d <= n; d += 2 {
+			if n%d == 0 {
+				prime = false
+				break
+			}
+		}
+		if prime {
+			return n
+		}
+	}
+}
+
+// populate 生成查找表：节点 i 的排列为 (offset + j*skip) mod M，各节点轮流取自己排列中下一个空位，
+// 每轮权重为 w 的节点取 w 次，直到填满整张表
+func (m *Maglev) populate() {
+	if len(m.nodes) == 0 {
+		m.table = nil
+		return
+	}
+	size := uint64(m.size)
+	offsets := make([]uint64, len(m.nodes))
+	skips := make([]uint64, len(m.nodes))
+	next := make([]uint64, len(m.nodes))
+	for i, nodeName := range m.nodes {
+		h := hash64(m.hashFunc, nodeName)
+		offsets[i] = h % size
+		skips[i] = mix64(h^0x9e3779b97f4a7c15)%(size-1) + 1
+	}
+
+	table := make([]int, m.size)
+	for i := range table {
+		table[i] = -1
+	}
+	for filled := 0; ; {
+		for i, nodeName := range m.nodes {
+			for w := 0; w < m.weights[nodeName]; w++ {
+				c := (offsets[i] + next[i]*skips[i]) % size
+				for table[c] >= 0 {
+					next[i]++
+					c = (offsets[i] + next[i]*skips[i]) % size
+				}
+				table[c] = i
+				next[i]++
+				if filled++; filled == m.size {
+					m.table = table
+					return
+				}
+			}
+		}
+	}
+}
+
+func (m *Maglev) FindNode(key string) string {
+	if len(m.table) == 0 {
+		return ""
+	}
+	return m.nodes[m.table[hash64(m.hashFunc, key)%uint64(m.size)]]
+}
+
+// FindNodes 从 key 在查找表中的位置出发依次向后查找，收集 n 个不同的节点
+func (m *Maglev) FindNodes(key string, n int) []string {
+	if len(m.table) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(m.nodes) {
+		n = len(m.nodes)
+	}
+	nodes := make([]string, 0, n)
+	seen := make([]bool, len(m.nodes))
+	start := int(hash64(m.hashFunc, key) % uint64(m.size))
+	for i := 0; i < m.size && len(nodes) < n; i++ {
+		idx := m.table[(start+i)%m.size]
+		if seen[idx] {
+			continue
+		}
+		seen[idx] = true
+		nodes = append(nodes, m.nodes[idx])
+	}
+	return nodes
+}
+
+func (m *Maglev) Nodes() []string {
+	return append([]string(nil), m.nodes...)
+}
+
+func (m *Maglev) Weight(nodeName string) int {
+	return m.weights[nodeName]
+}
@@ -0,0 +1,104 @@
+package consistenthash
+
+import "sort"
+
+// Placement 决定每个 key 由哪些真实节点负责。
+// 除了基于哈希环的 ConsistHash，还提供 Rendezvous、Jump 与 Maglev 三种实现，
+// 在节点较少时它们的负载通常比虚拟节点数有限的哈希环更均衡
+type Placement interface {
+	// SetNodes 将真实节点更新为 weights 中的节点（权重小于 1 时按 1 计算），
+	// 返回新增（含权重变化）与移除的节点，均已排序
+	SetNodes(weights map[string]int) (added, removed []string)
+
+	// FindNode 返回 key 的主节点，没有节点时返回空字符串
+	FindNode(key string) string
+
+	// FindNodes 返回 key 的有序偏好列表：n 个不同的真实节点，首个即 FindNode 的结果。
+	// 真实节点数不足 n 时，返回全部真实节点
+	FindNodes(key string, n int) []string
+
+	// Nodes 返回全部真实节点的名称，已排序
+	Nodes() []string
+
+	// Weight 返回真实节点的权重，节点不存在时返回 0
+	Weight(nodeName string) int
+}
+
+var (
+	_ Placement = (*ConsistHash)(nil)
+	_ Placement = (*Rendezvous)(nil)
+	_ Placement = (*Jump)(nil)
+	_ Placement = (*Maglev)(nil)
+)
+
+// diffNodes 比较新旧两组节点，返回新增（含权重变化）与移除的节点，以及权重规范化后的新节点
+func diffNodes(old, weights map[string]int) (added, removed []string, normalized map[string]int) {
+	normalized = make(map[string]int, len(weights))
+	for nodeName, weight := range weights {
+		if weight < 1 {
+			weight = 1
+		}
+		normalized[nodeName] = weight
+		if w, ok := old[nodeName]; !ok || w != weight {
+			added = append(added, nodeName)
+		}
+	}
+	for nodeName := range old {
+		if _, ok := normalized[nodeName]; !ok {
+			removed = append(removed, nodeName)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed, normalized
+}
+
+// sortedNodes 返回 weights 中的节点名称，已排序
+func sortedNodes(weights map[string]int) []string {
+	nodes := make([]string, 0, len(weights))
+	for nodeName := range weights {
+		nodes = append(nodes, nodeName)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// mix64 对哈希值做进一步的混合（MurmurHash3 的 fmix64），使相近的输入得到差异很大的输出。
+// HashFunc 只有 32 位且 crc32 对相似输入分布较差，Rendezvous、Jump 与 Maglev 都在它的基础上再混合一次
+func mix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// hash64 使用 hashFunc 计算数据的哈希值，并混合为 64 位
+func hash64(hashFunc HashFunc, data string) uint64 {
+	return mix64(uint64(hashFunc([]byte(data))))
+}
+
+// ClonePlacement 返回 p 的一份独立拷贝，可以在不影响 p 的情况下预先计算节点变化后的放置结果。
+// Bounded 只拷贝底层的放置算法，不拷贝负载；不支持的自定义实现返回 false
+func ClonePlacement(p Placement) (Placement, bool) {
+	var c Placement
+	switch p := p.(type) {
+	case *ConsistHash:
+		return p.Clone(), true
+	case *Bounded:
+		return ClonePlacement(p.Placement)
+	case *Rendezvous:
+		c = NewRendezvous(p.hashFunc)
+		c.SetNodes(p.weights)
+	case *Jump:
+		c = NewJump(p.hashFunc)
+		c.SetNodes(p.weights)
+	case *Maglev:
+		c = NewMaglev(p.size, p.hashFunc)
+		c.SetNodes(p.weights)
+	default:
+		return nil, false
+	}
+	return c, true
+}
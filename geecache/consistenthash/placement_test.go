@@ -0,0 +1,203 @@
+package consistenthash
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+// placements 返回待比较的各种 Placement 实现，均使用默认的 crc32 哈希函数
+func placements() map[string]func() Placement {
+	return map[string]func() Placement{
+		"ring":       func() Placement { return New(50, nil) },
+		"rendezvous": func() Placement { return NewRendezvous(nil) },
+		"jump":       func() Placement { return NewJump(nil) },
+		"maglev":     func() Placement { return NewMaglev(0, nil) },
+	}
+}
+
+func testNodes(n int) map[string]int {
+	weights := make(map[string]int, n)
+	for i := 0; i < n; i++ {
+		weights["127.0.0.1:"+strconv.Itoa(8001+i)] = 1
+	}
+	return weights
+}
+
+// loadShares 统计 keys 个 key 在各节点上的占比
+func loadShares(p Placement, keys int) map[string]float64 {
+	counts := make(map[string]int)
+	for i := 0; i < keys; i++ {
+		counts[p.FindNode("key"+strconv.Itoa(i))]++
+	}
+	shares := make(map[string]float64, len(counts))
+	for node, c := range counts {
+		shares[node] = float64(c) / float64(keys)
+	}
+	return shares
+}
+
+// coefficientOfVariation 各节点 key 数量的变异系数（标准差/均值），越小负载越均衡
+func coefficientOfVariation(shares map[string]float64, nodes int) float64 {
+	mean := 1 / float64(nodes)
+	var sum float64
+	for _, s := range shares {
+		sum += (s - mean) * (s - mean)
+	}
+	sum += float64(nodes-len(shares)) * mean * mean // 一个 key 都没分到的节点
+	return math.Sqrt(sum/float64(nodes)) / mean
+}
+
+func TestPlacementLoadVariance(t *testing.T) {
+	const keys = 100000
+	for _, nodes := range []int{3, 5, 10} {
+		for name, newPlacement := range placements() {
+			p := newPlacement()
+			p.SetNodes(testNodes(nodes))
+			cv := coefficientOfVariation(loadShares(p, keys), nodes)
+			t.Logf("%-10s nodes=%-2d cv=%.4f", name, nodes, cv)
+			if name != "ring" && cv > 0.05 {
+				t.Errorf("%s with %d nodes: load cv %.4f exceeds 0.05", name, nodes, cv)
+			}
+		}
+	}
+}
+
+func TestPlacementWeights(t *testing.T) {
+	weights := map[string]int{"a": 1, "b": 2, "c": 5}
+	for name, newPlacement := range placements() {
+		if name == "ring" {
+			continue // 哈希环的权重由 TestWeightedDistribution 覆盖
+		}
+		p := newPlacement()
+		p.SetNodes(weights)
+		shares := loadShares(p, 100000)
+		for node, w := range weights {
+			want := float64(w) / 8
+			if math.Abs(shares[node]-want)/want > 0.1 {
+				t.Errorf("%s: node %s (weight %d) got %.3f of keys, want %.3f", name, node, w, shares[node], want)
+			}
+		}
+	}
+}
+
+func TestPlacementFindNodes(t *testing.T) {
+	for name, newPlacement := range placements() {
+		p := newPlacement()
+		if p.FindNode("key") != "" || p.FindNodes("key", 2) != nil {
+			t.Errorf("%s: empty placement should find nothing", name)
+		}
+		p.SetNodes(testNodes(5))
+		for i := 0; i < 1000; i++ {
+			key := "key" + strconv.Itoa(i)
+			nodes := p.FindNodes(key, 3)
+			if len(nodes) != 3 || nodes[0] != p.FindNode(key) {
+				t.Fatalf("%s: FindNodes(%s) = %v, should start with %s", name, key, nodes, p.FindNode(key))
+			}
+			if nodes[0] == nodes[1] || nodes[1] == nodes[2] || nodes[0] == nodes[2] {
+				t.Fatalf("%s: FindNodes(%s) = %v contains duplicates", name, key, nodes)
+			}
+		}
+		if nodes := p.FindNodes("key", 10); len(nodes) != 5 {
+			t.Errorf("%s: FindNodes should return all 5 nodes, got %v", name, nodes)
+		}
+	}
+}
+
+// 移除一个节点时，迁移的 key 应当接近该节点原本负责的比例
+func TestPlacementDisruption(t *testing.T) {
+	const keys = 20000
+	for name, newPlacement := range placements() {
+		p := newPlacement()
+		nodes := testNodes(5)
+		p.SetNodes(nodes)
+		before := make([]string, keys)
+		for i := range before {
+			before[i] = p.FindNode("key" + strconv.Itoa(i))
+		}
+
+		delete(nodes, "127.0.0.1:8003")
+		if _, removed := p.SetNodes(nodes); len(removed) != 1 {
+			t.Fatalf("%s: SetNodes should report one removed node", name)
+		}
+		var moved int
+		for i := range before {
+			if after := p.FindNode("key" + strconv.Itoa(i)); after != before[i] {
+				moved++
+				if before[i] != "127.0.0.1:8003" && name != "jump" && name != "maglev" {
+					t.Fatalf("%s: key%d moved from surviving node %s", name, i, before[i])
+				}
+			}
+		}
+		// 理想情况下约 1/5 的 key 迁移；跳跃哈希按名称编号，移除中间的节点会迁移更多
+		limit := 0.3
+		if name == "jump" {
+			limit = 0.7
+		}
+		if frac := float64(moved) / keys; frac > limit {
+			t.Errorf("%s: %.3f of keys moved after removing one of 5 nodes", name, frac)
+		}
+	}
+}
+
+func BenchmarkPlacementFindNode(b *testing.B) {
+	for name, newPlacement := range placements() {
+		for _, nodes := range []int{3, 10, 50} {
+			p := newPlacement()
+			p.SetNodes(testNodes(nodes))
+			b.Run(name+"/"+strconv.Itoa(nodes), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					p.FindNode("key" + strconv.Itoa(i&1023))
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkPlacementFindNodes(b *testing.B) {
+	for name, newPlacement := range placements() {
+		p := newPlacement()
+		p.SetNodes(testNodes(10))
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				p.FindNodes("key"+strconv.Itoa(i&1023), 3)
+			}
+		})
+	}
+}
+
+func TestClonePlacement(t *testing.T) {
+	for name, newPlacement := range placements() {
+		p := newPlacement()
+		p.SetNodes(testNodes(4))
+		c, ok := ClonePlacement(NewBounded(p, 0.5))
+		if !ok {
+			t.Fatalf("%s: placement should be cloneable", name)
+		}
+		c.SetNodes(testNodes(5)) // 修改拷贝不影响原对象
+		if len(p.Nodes()) != 4 || len(c.Nodes()) != 5 {
+			t.Fatalf("%s: clone shares state with the original", name)
+		}
+		nodes := testNodes(5)
+		p.SetNodes(nodes)
+		for i := 0; i < 100; i++ {
+			if key := "key" + strconv.Itoa(i); p.FindNode(key) != c.FindNode(key) {
+				t.Fatalf("%s: clone places %s differently", name, key)
+			}
+		}
+	}
+}
+
+// 表大小不是质数时向上取到下一个质数，否则 populate 可能无法填满查找表
+func TestMaglevTableSize(t *testing.T) {
+	for size, want := range map[int]int{1: 2, 4: 5, 100: 101, 1000: 1009, 65537: 65537} {
+		m := NewMaglev(size, nil)
+		if m.size != want {
+			t.Fatalf("NewMaglev(%d) table size = %d, want %d", size, m.size, want)
+		}
+		m.SetNodes(testNodes(3))
+		if len(m.table) != want || m.FindNode("tom") == "" {
+			t.Fatalf("NewMaglev(%d) failed to populate the table", size)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package consistenthash
+
+import (
+	"hash/crc32"
+	"math"
+	"sort"
+)
+
+// Rendezvous 最高随机权重（HRW）哈希：对每个 key，所有节点各自计算一个分数，分数最高的节点负责该 key。
+// 节点增删时只有属于该节点的 key 会迁移；每次查找需要遍历全部节点，适合节点数不多的集群
+type Rendezvous struct {
+	hashFunc HashFunc
+	weights  map[string]int
+	nodes    []string // 已排序
+	seeds    []uint64 // 与 nodes 一一对应的节点哈希值
+}
+
+// NewRendezvous 实例化 Rendezvous，hashFunc 为 nil 时默认使用 crc32.ChecksumIEEE
+func NewRendezvous(hashFunc HashFunc) *Rendezvous {
+	if hashFunc == nil {
+		hashFunc = crc32.ChecksumIEEE
+	}
+	return &Rendezvous{
+		hashFunc: hashFunc,
+		weights:  make(map[string]int),
+	}
+}
+
+func (r *Rendezvous) SetNodes(weights map[string]int) (added, removed []string) {
+	added, removed, r.weights = diffNodes(r.weights, weights)
+	r.nodes = sortedNodes(r.weights)
+	r.seeds = make([]uint64, len(r.nodes))
+	for i, nodeName := range r.nodes {
+		r.seeds[i] = hash64(r.hashFunc, nodeName)
+	}
+	return added, removed
+}
+
+// score 计算节点对 key 的分数。带权重的 HRW 使用 -weight/ln(u)，u 为 (0, 1) 上均匀分布的哈希值，
+// 这样每个节点得分最高的概率与其权重成正比
+func (r *Rendezvous) score(keyHash uint64, i int) float64 {
+	h := mix64(keyHash ^ r.seeds[i])
+	u := (float64(h>>11) + 0.5) / (1 << 53)
+	return -float64(r.weights[r.nodes[i]]) / math.Log(u)
+}
+
+func (r *Rendezvous) FindNode(key string) string {
+	if len(r.nodes) == 0 {
+		return ""
+	}
+	keyHash := hash64(r.hashFunc, key)
+	best, bestScore := 0, r.score(keyHash, 0)
+	for i := 1; i < len(r.nodes); i++ {
+		if s := r.score(keyHash, i); s > bestScore {
+			best, bestScore = i, s
+		}
+	}
+	return r.nodes[best]
+}
+
+func (r *Rendezvous) FindNodes(key string, n int) []string {
+	if len(r.nodes) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(r.nodes) {
+		n = len(r.nodes)
+	}
+	keyHash := hash64(r.hashFunc, key)
+	scores := make([]float64, len(r.nodes))
+	order := make([]int, len(r.nodes))
+	for i := range r.nodes {
+		scores[i] = r.score(keyHash, i)
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+
+	nodes := make([]string, n)
+	for i := range nodes {
+		nodes[i] = r.nodes[order[i]]
+	}
+	return nodes
+}
+
+func (r *Rendezvous) Nodes() []string {
+	return append([]string(nil), r.nodes...)
+}
+
+func (r *Rendezvous) Weight(nodeName string) int {
+	return r.weights[nodeName]
+}
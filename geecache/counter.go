@@ -0,0 +1,147 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "geecache/geecachepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	原子计数器：计数器的值以十进制字符串保存（例如 "42"），可以直接通过 Get 读取。
+	Incr 总是在 key 的主节点上执行，持有 key 的 keyLock 完成读取-增加-写回，与主节点上的 Set/Remove/CompareAndSet 串行；
+	key 不在缓存中时先通过 load 从 Getter 加载初始值（与并发的 Query 合并为一次加载），Getter 返回空值表示从 0 开始。
+	增加后的值与 Set 一样分配新的版本号、写回数据源（配置了 Setter 时）并同步给其他副本。
+*/
+
+// ErrNotCounter key 的值不是十进制表示的 int64，无法作为计数器
+var ErrNotCounter = errors.New("value is not an int64 counter")
+
+// Incr 将 key 对应的计数器加上 delta，返回增加后的值。
+// ttl 大于 0 时，新建的计数器（key 不在缓存中）在 ttl 后过期，已存在的计数器保持原来的过期时间，适用于固定窗口限流
+func (g *Group) Incr(key string, delta int64, ttl time.Duration) (int64, error) {
+	g.peersOnce.Do(g.initPeers)
+	if key == "" {
+		return 0, errors.New("empty Incr() key not allowed")
+	}
+
+	replicas := g.peers.PickPeers(key)
+	if isPrimary(replicas) {
+		return g.ownerIncr(replicas, key, delta, ttl)
+	}
+	out := &pb.IncrResponse{}
+	if err := replicas[0].Incr(&pb.IncrRequest{Group: g.name, Key: key, Delta: delta, Ttl: int64(ttl)}, out); err != nil {
+		return 0, err
+	}
+	if !isReplica(replicas) { // 当前节点作为副本时由主节点同步，否则丢弃 hotCache 中的旧值
+		g.loadGroup.Lock(func() {
+			g.hotCache.remove(key)
+		})
+	}
+	return out.Value, nil
+}
+
+// Decr 将 key 对应的计数器减去 delta，等价于 Incr(key, -delta, ttl)
+func (g *Group) Decr(key string, delta int64, ttl time.Duration) (int64, error) {
+	return g.Incr(key, -delta, ttl)
+}
+
+// ownerIncr 在主节点上增加计数器，成功后同步给其他副本
+func (g *Group) ownerIncr(replicas []ProtoGetter, key string, delta int64, ttl time.Duration) (int64, error) {
+	lock := g.keyLock(key)
+	lock.Lock()
+	current, ok := g.mainCache.peek(key)
+	if !ok && g.disk != nil {
+		current, ok = g.promote(key)
+	}
+	if !ok {
+		var err error
+		if current, err = g.load(key); err != nil {
+			lock.Unlock()
+			return 0, err
+		}
+		current.e = time.Time{} // 新建的计数器只使用 ttl 作为过期时间
+		if ttl > 0 {
+			current.e = time.Now().Add(ttl)
+		}
+	}
+	b, err := current.raw()
+	if err != nil {
+		lock.Unlock()
+		return 0, err
+	}
+	n, err := parseCounter(b)
+	if err != nil {
+		lock.Unlock()
+		return 0, fmt.Errorf("incr %s: %w", key, err)
+	}
+	if delta > 0 && n > math.MaxInt64-delta || delta < 0 && n < math.MinInt64-delta {
+		lock.Unlock()
+		return 0, fmt.Errorf("incr %s: counter %d overflows int64 when adding %d", key, n, delta)
+	}
+	n += delta
+
+	value := strconv.AppendInt(nil, n, 10)
+	view := g.compress(ByteView{b: value, e: current.e, v: g.nextVersion(), t: current.t})
+	err = g.writeOriginLocked(WriteOp{Key: key, Value: value, Expire: current.e}, func() {
+		g.localSet(key, view, &g.mainCache)
+	})
+	lock.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	g.invalidate(key)
+	return n, g.replicate(replicas, key, view)
+}
+
+// parseCounter 解析十进制表示的计数器，空值为 0
+func parseCounter(b []byte) (int64, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrNotCounter, b)
+	}
+	return n, nil
+}
+
+// Incr 作为 key 的主节点增加计数器，值不是整数时返回 codes.FailedPrecondition
+func (s *Server) Incr(ctx context.Context, in *pb.IncrRequest) (*pb.IncrResponse, error) {
+	group := GetGroup(in.GetGroup())
+	if group == nil {
+		return nil, fmt.Errorf("no such group: %s", in.GetGroup())
+	}
+	group.peersOnce.Do(group.initPeers)
+	value, err := group.ownerIncr(group.peers.PickPeers(in.Key), in.Key, in.Delta, time.Duration(in.Ttl))
+	if errors.Is(err, ErrNotCounter) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pb.IncrResponse{Value: value}, nil
+}
+
+// Incr 方法，实现 ProtoGetter 接口。codes.FailedPrecondition 转换为 ErrNotCounter。
+// 计数器不是幂等的，RetryableCodes 中不应包含 codes.DeadlineExceeded，否则超时重试可能重复增加
+func (c *client) Incr(in *pb.IncrRequest, out *pb.IncrResponse) error {
+	return c.call(func(ctx context.Context, grpcClient pb.GroupCacheClient) error {
+		resp, err := grpcClient.Incr(ctx, in)
+		if errCode(err) == codes.FailedPrecondition {
+			msg := strings.Replace(status.Convert(err).Message(), ErrNotCounter.Error()+": ", "", 1)
+			return fmt.Errorf("%w: %s", ErrNotCounter, msg)
+		}
+		if err != nil {
+			return fmt.Errorf("grpc client Incr() error: %w", err)
+		}
+		out.Value = resp.GetValue()
+		return nil
+	})
+}
@@ -0,0 +1,132 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"geecache/breaker"
+	pb "geecache/geecachepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIncr(t *testing.T) {
+	var loads int
+	gp := NewGroup("counter", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		if key == "hits" {
+			return []byte("10"), nil
+		}
+		return nil, nil // 空值表示从 0 开始
+	}))
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil}}
+
+	if n, err := gp.Incr("hits", 1, 0); err != nil || n != 11 {
+		t.Fatalf("Incr = %d, %v; want 11 from initial value 10", n, err)
+	}
+	if n, err := gp.Decr("hits", 5, 0); err != nil || n != 6 {
+		t.Fatalf("Decr = %d, %v; want 6", n, err)
+	}
+	if view, _ := gp.Query("hits"); view.String() != "6" || loads != 1 {
+		t.Fatalf("Query = %q after %d loads, want 6 after 1 load", view, loads)
+	}
+
+	// 新建的计数器在 ttl 后过期，之后重新从 Getter 加载
+	if n, err := gp.Incr("window", 1, 20*time.Millisecond); err != nil || n != 1 {
+		t.Fatalf("Incr = %d, %v; want 1", n, err)
+	}
+	gp.Incr("window", 1, time.Hour) // 已存在的计数器保持原来的过期时间
+	time.Sleep(30 * time.Millisecond)
+	if n, _ := gp.Incr("window", 1, 0); n != 1 {
+		t.Fatalf("counter should restart after ttl, got %d", n)
+	}
+
+	gp.Set("name", []byte("Tom"), time.Time{}, false)
+	if _, err := gp.Incr("name", 1, 0); !errors.Is(err, ErrNotCounter) {
+		t.Fatalf("Incr on non-integer should fail with ErrNotCounter, got %v", err)
+	}
+	gp.Set("max", []byte("9223372036854775807"), time.Time{}, false)
+	if _, err := gp.Incr("max", 1, 0); err == nil {
+		t.Fatalf("Incr should fail on overflow")
+	}
+	if n, err := gp.Incr("max", math.MinInt64, 0); err != nil || n != -1 {
+		t.Fatalf("Incr = %d, %v; want -1", n, err)
+	}
+}
+
+func TestIncrConcurrent(t *testing.T) {
+	gp := NewGroup("counter-concurrent", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		time.Sleep(10 * time.Millisecond) // 加载期间并发的 Query 与 Incr 不能覆盖彼此的结果
+		return []byte("100"), nil
+	}))
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := gp.Incr("hits", 1, 0); err != nil {
+				t.Errorf("Incr failed: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			gp.Query("hits")
+		}()
+	}
+	wg.Wait()
+	if view, _ := gp.Query("hits"); view.String() != "150" {
+		t.Fatalf("counter = %s, want 150", view)
+	}
+}
+
+func TestIncrReplicas(t *testing.T) {
+	p1 := newFakePeer(false)
+	p1.data["hits"] = []byte("7")
+
+	// 当前节点不是主节点，转发给 p1
+	gp := NewGroup("counter-forward", 2<<10, GetterFunc(notFound))
+	gp.peers = &fakePicker{replicas: []ProtoGetter{p1}}
+	gp.localSet("hits", ByteView{b: []byte("7")}, &gp.hotCache)
+	if n, err := gp.Incr("hits", 2, 0); err != nil || n != 9 {
+		t.Fatalf("Incr = %d, %v; want 9", n, err)
+	}
+	if _, ok := gp.hotCache.get("hits"); ok {
+		t.Fatalf("stale hot copy should be dropped")
+	}
+
+	// 当前节点是主节点，增加后同步给 p2
+	p2 := newFakePeer(false)
+	gp = NewGroupOpts("counter-primary", 2<<10, GetterFunc(func(string) ([]byte, error) { return nil, nil }),
+		&GroupOptions{WriteQuorum: 2})
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil, p2}}
+	if _, err := gp.Incr("hits", 3, 0); err != nil {
+		t.Fatalf("Incr failed: %v", err)
+	}
+	p2.mu.Lock()
+	defer p2.mu.Unlock()
+	if string(p2.data["hits"]) != "3" {
+		t.Fatalf("replica got %q, want 3", p2.data["hits"])
+	}
+}
+
+func TestServerIncr(t *testing.T) {
+	gp := NewGroup("counter-server", 2<<10, GetterFunc(func(string) ([]byte, error) { return []byte("x"), nil }))
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil}}
+	s := newServer("127.0.0.1:8001", nil)
+
+	_, err := s.Incr(context.Background(), &pb.IncrRequest{Group: gp.name, Key: "hits", Delta: 1})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("non-integer value should be reported as FailedPrecondition, got %v", err)
+	}
+
+	fake := &faultyGrpcClient{err: err}
+	c := newFakeClient(fake, ClientOptions{}, breaker.Options{MinRequests: 1})
+	if err := c.Incr(&pb.IncrRequest{}, &pb.IncrResponse{}); !errors.Is(err, ErrNotCounter) {
+		t.Fatalf("client should return ErrNotCounter, got %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package geecache
+
+import (
+	"geecache/compress"
+	"geecache/disk"
+	"log"
+	"time"
+)
+
+/*
+	磁盘缓存的读写不在 loadGroup.Lock 中进行，这把锁保护整个 Group，持有期间的磁盘 I/O 会阻塞全部 key 的加载、写入与移除：
+	1. 降级：evict 在锁中只把淘汰的条目放入 demoting，由后台协程 flushDemoted 在锁外写入磁盘，
+	   写入期间条目仍留在 demoting 中，lookupCache 未命中时可以直接从这里移回 mainCache；
+	2. 移回：promote 在锁外读取磁盘，回到锁中用 DeleteRecord 确认记录没有在此期间被删除或覆盖后才写入 mainCache；
+	3. 移除：localRemove、Purge 与按标签/前缀移除时将 demoting 中对应的条目标记为取消，
+	   已经在写入的条目写完后立即从磁盘删除，不会被 promote 移回；
+	4. 按标签、前缀删除与 Purge 需要遍历磁盘的索引，在锁外进行：beginDiskRemoval 与内存中的移除在同一次加锁中开始，
+	   直到 endDiskRemoval 之前，以及这期间开始读取的 promote，都不会把磁盘上的条目移回 mainCache。
+	磁盘记录保存条目的版本号与标签，移回后 CompareAndSet 与 RemoveByTag 不受影响。
+*/
+
+// demotion 等待写入磁盘的条目
+type demotion struct {
+	value    ByteView
+	canceled bool // 条目已被移除或移回 mainCache，不再写入，已写入的从磁盘删除
+}
+
+// demote 将 mainCache 中淘汰的条目交给后台协程写入磁盘，已过期的条目直接丢弃。调用方持有 loadGroup.Lock
+func (g *Group) demote(key string, value ByteView) {
+	if !value.e.IsZero() && value.e.Before(time.Now()) {
+		return
+	}
+	g.demoteOnce.Do(func() { go g.demoteLoop() })
+	g.demoting[key] = &demotion{value: value}
+	select {
+	case g.demoteReady <- struct{}{}:
+	default:
+	}
+}
+
+func (g *Group) demoteLoop() {
+	for {
+		select {
+		case <-g.demoteReady:
+			g.flushDemoted()
+		case <-g.demoteStop:
+			return
+		}
+	}
+}
+
+// flushDemoted 将 demoting 中的条目写入磁盘
+func (g *Group) flushDemoted() {
+	g.demoteMu.Lock()
+	defer g.demoteMu.Unlock()
+
+	var (
+		keys  []string
+		batch []*demotion
+	)
+	g.loadGroup.Lock(func() {
+		for key, d := range g.demoting {
+			if d.canceled {
+				delete(g.demoting, key)
+				continue
+			}
+			keys, batch = append(keys, key), append(batch, d)
+		}
+	})
+
+	for i, key := range keys {
+		b, err := g.diskValue(batch[i].value)
+		if err == nil {
+			err = g.disk.PutRecord(key, disk.Record{Value: b, Expire: batch[i].value.e, Version: batch[i].value.v, Tags: batch[i].value.t})
+		}
+		if err != nil {
+			log.Printf("demote %s to disk failed: %v", key, err)
+		}
+	}
+
+	g.loadGroup.Lock(func() {
+		for i, key := range keys {
+			if g.demoting[key] == batch[i] {
+				delete(g.demoting, key)
+			}
+			if batch[i].canceled { // 写入期间被移除或移回 mainCache
+				g.disk.Delete(key)
+			}
+		}
+	})
+}
+
+// diskValue 返回写入磁盘的数据。开启压缩时磁盘上的值都带有头部，移回时据此解压，已压缩的值原样写入；
+// 未开启时保存解压后的值
+func (g *Group) diskValue(value ByteView) ([]byte, error) {
+	if value.z && g.compression != compress.None {
+		return value.b, nil
+	}
+	b, err := value.raw()
+	if err != nil {
+		return nil, err
+	}
+	if g.compression != compress.None {
+		return compress.Encode(compress.None, b)
+	}
+	return b, nil
+}
+
+// cancelDemotions 取消 demoting 中 match 返回 true 的条目，调用方持有 loadGroup.Lock
+func (g *Group) cancelDemotions(match func(key string, value ByteView) bool) {
+	for key, d := range g.demoting {
+		if match(key, d.value) {
+			d.canceled = true
+		}
+	}
+}
+
+// beginDiskRemoval 开始在锁外删除磁盘条目，调用方持有 loadGroup.Lock，并在同一次加锁中移除内存中的条目
+func (g *Group) beginDiskRemoval() {
+	g.diskRemoving++
+	g.diskEpoch++
+}
+
+// endDiskRemoval 锁外的删除已经完成
+func (g *Group) endDiskRemoval() {
+	g.loadGroup.Lock(func() {
+		g.diskRemoving--
+		g.diskEpoch++
+	})
+}
+
+// promote 在等待写入的条目或磁盘中查找 key，命中时将其移回 mainCache
+func (g *Group) promote(key string) (value ByteView, ok bool) {
+	var (
+		pending bool
+		epoch   uint64
+	)
+	g.loadGroup.Lock(func() {
+		epoch = g.diskEpoch
+		d, exist := g.demoting[key]
+		if pending = exist; !exist || d.canceled {
+			return
+		}
+		d.canceled = true // 已经写入磁盘时由 flushDemoted 删除
+		value, ok = d.value, true
+		g.populateCache(key, value, &g.mainCache)
+	})
+	if pending {
+		return value, ok
+	}
+
+	r, hit := g.disk.Lookup(key) // 在锁外读取磁盘
+	if !hit {
+		return ByteView{}, false
+	}
+	g.loadGroup.Lock(func() {
+		if current, exist := g.mainCache.peek(key); exist { // 读取期间已写入新的值
+			value, ok = current, true
+			return
+		}
+		if g.diskRemoving > 0 || g.diskEpoch != epoch {
+			return // 读取期间开始了按标签、前缀的删除，记录可能已被删除，按未命中处理
+		}
+		if _, exist := g.demoting[key]; exist || !g.disk.DeleteRecord(key, r) {
+			return // 读取期间记录被删除或覆盖，按未命中处理
+		}
+		// 保留降级前的版本号与标签，CompareAndSet 不会因此冲突，RemoveByTag 仍能找到
+		value, ok = ByteView{b: r.Value, e: r.Expire, v: r.Version, t: r.Tags, z: g.compression != compress.None}, true
+		if value.v == 0 {
+			value.v = g.nextVersion()
+		}
+		g.populateCache(key, value, &g.mainCache)
+	})
+	return value, ok
+}
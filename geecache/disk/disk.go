@@ -0,0 +1,361 @@
+package disk
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+	Store 日志结构的磁盘缓存，作为内存缓存之下的第二级：
+	1. 写入只追加到当前段（segment）文件的末尾，段写满后新建一个段；
+	2. 内存中的索引记录每个 key 最新一条记录的位置，覆盖与删除只修改索引；另有按标签的索引，DeleteTag 不需要遍历全部 key；
+	3. 全部段的大小之和超过 maxBytes 时，整段删除最旧的段，其中仍然有效的 key 一并淘汰（FIFO）。
+	每条记录的格式：crc32 uint32 | uvarint key 长度 | uvarint value 长度 | varint 过期时间（UnixNano）| uvarint 版本号 | key | value |
+	uvarint 标签数 | 每个标签的 uvarint 长度与内容
+	Store 只是缓存，重启后不保留数据：Open 会清空目录中上一次遗留的段文件。
+*/
+
+const segmentSuffix = ".seg"
+
+type NowFunc func() time.Time
+
+// ErrTooLarge 记录超过了 Store 的容量
+var ErrTooLarge = errors.New("disk: entry larger than store capacity")
+
+type Store struct {
+	mu           sync.RWMutex
+	dir          string
+	maxBytes     int64 // 全部段文件大小之和的上限
+	segmentBytes int64 // 单个段文件的大小上限
+	nextID       int
+
+	segments []*segment                     // 按创建时间排列，最后一个为当前写入的段
+	index    map[string]location            // key 最新一条记录的位置
+	tags     map[string]map[string]struct{} // 标签 -> 带有该标签的 key
+	nbytes   int64                          // 全部段文件的大小之和
+	seq      uint64                         // 最近一次写入分配的序号
+
+	// Now 用于判断记录是否过期，默认为 time.Now，测试时可以替换
+	Now NowFunc
+}
+
+type segment struct {
+	f    *os.File
+	size int64
+	keys []string // 写入过该段的 key，删除段时据此清理索引
+}
+
+type location struct {
+	seg    *segment
+	offset int64
+	length int64
+	expire time.Time
+	seq    uint64   // 写入时分配的序号，同一个 key 每次写入都不同
+	tags   []string // 记录的标签，删除时据此清理标签索引
+}
+
+// Record 磁盘上的一条记录，Lookup 返回的 Record 可以交给 DeleteRecord
+type Record struct {
+	Value   []byte
+	Expire  time.Time
+	Version uint64   // 调用方的版本号，Store 只负责保存
+	Tags    []string // 记录的标签，可以通过 DeleteTag 删除
+	seq     uint64
+}
+
+// Open 在 dir 中创建 Store，maxBytes 为磁盘占用的上限，每个段的大小为 maxBytes 的 1/8
+func Open(dir string, maxBytes int64) (*Store, error) {
+	if maxBytes <= 0 {
+		return nil, errors.New("disk: maxBytes must be positive")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	stale, err := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range stale {
+		if err := os.Remove(name); err != nil {
+			return nil, err
+		}
+	}
+	return &Store{
+		dir:          dir,
+		maxBytes:     maxBytes,
+		segmentBytes: maxBytes/8 + 1,
+		index:        make(map[string]location),
+		tags:         make(map[string]map[string]struct{}),
+		Now:          time.Now,
+	}, nil
+}
+
+// Put 追加一条记录，覆盖 key 之前的值
+func (s *Store) Put(key string, value []byte, expire time.Time) error {
+	return s.PutRecord(key, Record{Value: value, Expire: expire})
+}
+
+// PutRecord 与 Put 相同，同时保存 r.Version 与 r.Tags
+func (s *Store) PutRecord(key string, r Record) error {
+	record := encode(key, r)
+	if int64(len(record)) > s.maxBytes {
+		return ErrTooLarge
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.segments) == 0 || s.active().size > 0 && s.active().size+int64(len(record)) > s.segmentBytes {
+		if err := s.roll(); err != nil {
+			return err
+		}
+	}
+	seg := s.active()
+	if _, err := seg.f.WriteAt(record, seg.size); err != nil {
+		return fmt.Errorf("disk: write segment failed: %v", err)
+	}
+	s.seq++
+	s.unindex(key)
+	s.index[key] = location{seg: seg, offset: seg.size, length: int64(len(record)), expire: r.Expire, seq: s.seq, tags: r.Tags}
+	for _, tag := range r.Tags {
+		if s.tags[tag] == nil {
+			s.tags[tag] = make(map[string]struct{})
+		}
+		s.tags[tag][key] = struct{}{}
+	}
+	seg.keys = append(seg.keys, key)
+	seg.size += int64(len(record))
+	s.nbytes += int64(len(record))
+
+	for s.nbytes > s.maxBytes && len(s.segments) > 1 {
+		s.dropOldest()
+	}
+	return nil
+}
+
+// Get 返回 key 的值与过期时间。记录已过期或已损坏时视为不存在
+func (s *Store) Get(key string) (value []byte, expire time.Time, ok bool) {
+	r, ok := s.Lookup(key)
+	return r.Value, r.Expire, ok
+}
+
+// Lookup 与 Get 相同，返回 key 最新的一条记录
+func (s *Store) Lookup(key string) (Record, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	loc, exist := s.index[key]
+	if !exist || !loc.expire.IsZero() && loc.expire.Before(s.Now()) {
+		return Record{}, false
+	}
+	record := make([]byte, loc.length)
+	if _, err := loc.seg.f.ReadAt(record, loc.offset); err != nil {
+		return Record{}, false
+	}
+	k, r, err := decode(record)
+	if err != nil || k != key {
+		return Record{}, false
+	}
+	r.seq = loc.seq
+	return r, true
+}
+
+// Delete 删除 key，记录所占的空间在所在的段被删除时回收
+func (s *Store) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unindex(key)
+}
+
+// DeleteRecord 只在 key 最新的记录仍是 r 时删除 key，返回是否删除。
+// 调用方在 Lookup 之后据此确认记录没有被覆盖或删除
+func (s *Store) DeleteRecord(key string, r Record) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if loc, ok := s.index[key]; !ok || loc.seq != r.seq {
+		return false
+	}
+	s.unindex(key)
+	return true
+}
+
+// DeletePrefix 删除以 prefix 开头的全部 key，返回删除的数量。需要遍历索引中的全部 key
+func (s *Store) DeletePrefix(prefix string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int
+	for key := range s.index {
+		if strings.HasPrefix(key, prefix) {
+			s.unindex(key)
+			n++
+		}
+	}
+	return n
+}
+
+// DeleteTag 删除带有 tag 标签的全部 key，返回删除的数量
+func (s *Store) DeleteTag(tag string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.tags[tag])
+	for key := range s.tags[tag] {
+		s.unindex(key)
+	}
+	return n
+}
+
+// unindex 从索引与标签索引中删除 key，调用方持有 mu
+func (s *Store) unindex(key string) {
+	loc, ok := s.index[key]
+	if !ok {
+		return
+	}
+	delete(s.index, key)
+	for _, tag := range loc.tags {
+		if delete(s.tags[tag], key); len(s.tags[tag]) == 0 {
+			delete(s.tags, tag)
+		}
+	}
+}
+
+// Len 返回 key 的数量
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.index)
+}
+
+// Bytes 返回全部段文件的大小之和，包括已被覆盖或删除的记录
+func (s *Store) Bytes() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.nbytes
+}
+
+// Close 关闭并删除全部段文件
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	for len(s.segments) > 0 {
+		if e := s.dropOldest(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (s *Store) active() *segment {
+	return s.segments[len(s.segments)-1]
+}
+
+// roll 新建一个段作为当前写入的段
+func (s *Store) roll() error {
+	name := filepath.Join(s.dir, fmt.Sprintf("%08d%s", s.nextID, segmentSuffix))
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0o644)
+	if err != nil {
+		return fmt.Errorf("disk: create segment failed: %v", err)
+	}
+	s.nextID++
+	s.segments = append(s.segments, &segment{f: f})
+	return nil
+}
+
+// dropOldest 删除最旧的段，以及索引中仍指向该段的 key
+func (s *Store) dropOldest() error {
+	seg := s.segments[0]
+	s.segments = s.segments[1:]
+	for _, key := range seg.keys {
+		if loc, ok := s.index[key]; ok && loc.seg == seg {
+			s.unindex(key)
+		}
+	}
+	s.nbytes -= seg.size
+	name := seg.f.Name()
+	err := seg.f.Close()
+	if e := os.Remove(name); err == nil {
+		err = e
+	}
+	return err
+}
+
+func encode(key string, r Record) []byte {
+	var e int64
+	if !r.Expire.IsZero() {
+		e = r.Expire.UnixNano()
+	}
+	size := 4 + 5*binary.MaxVarintLen64 + len(key) + len(r.Value)
+	for _, tag := range r.Tags {
+		size += binary.MaxVarintLen64 + len(tag)
+	}
+	record := make([]byte, 4, size)
+	record = binary.AppendUvarint(record, uint64(len(key)))
+	record = binary.AppendUvarint(record, uint64(len(r.Value)))
+	record = binary.AppendVarint(record, e)
+	record = binary.AppendUvarint(record, r.Version)
+	record = append(record, key...)
+	record = append(record, r.Value...)
+	record = binary.AppendUvarint(record, uint64(len(r.Tags)))
+	for _, tag := range r.Tags {
+		record = binary.AppendUvarint(record, uint64(len(tag)))
+		record = append(record, tag...)
+	}
+	binary.BigEndian.PutUint32(record, crc32.ChecksumIEEE(record[4:]))
+	return record
+}
+
+var errCorrupt = errors.New("disk: corrupt record")
+
+func decode(record []byte) (key string, r Record, err error) {
+	if len(record) < 4 || binary.BigEndian.Uint32(record) != crc32.ChecksumIEEE(record[4:]) {
+		return "", Record{}, errCorrupt
+	}
+	p := record[4:]
+	keyLen, n := binary.Uvarint(p)
+	if n <= 0 {
+		return "", Record{}, errCorrupt
+	}
+	p = p[n:]
+	valueLen, n := binary.Uvarint(p)
+	if n <= 0 {
+		return "", Record{}, errCorrupt
+	}
+	p = p[n:]
+	e, n := binary.Varint(p)
+	if n <= 0 {
+		return "", Record{}, errCorrupt
+	}
+	p = p[n:]
+	version, n := binary.Uvarint(p)
+	if n <= 0 || uint64(len(p)-n) < keyLen+valueLen {
+		return "", Record{}, errCorrupt
+	}
+	p = p[n:]
+	if e != 0 {
+		r.Expire = time.Unix(0, e)
+	}
+	key, r.Value, r.Version = string(p[:keyLen]), p[keyLen:keyLen+valueLen], version
+	p = p[keyLen+valueLen:]
+	count, n := binary.Uvarint(p)
+	if n <= 0 || count > uint64(len(p)) {
+		return "", Record{}, errCorrupt
+	}
+	p = p[n:]
+	for ; count > 0; count-- {
+		tagLen, n := binary.Uvarint(p)
+		if n <= 0 || uint64(len(p)-n) < tagLen {
+			return "", Record{}, errCorrupt
+		}
+		r.Tags = append(r.Tags, string(p[n:n+int(tagLen)]))
+		p = p[n+int(tagLen):]
+	}
+	if len(p) != 0 {
+		return "", Record{}, errCorrupt
+	}
+	return key, r, nil
+}
@@ -0,0 +1,182 @@
+package disk
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPutGet(t *testing.T) {
+	s, err := Open(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	expire := time.Now().Add(time.Hour).Round(0)
+	s.Put("k1", []byte("v1"), time.Time{})
+	s.Put("k2", []byte("v2"), expire)
+	s.Put("k1", []byte("v1-new"), time.Time{}) // 覆盖
+
+	if v, _, ok := s.Get("k1"); !ok || string(v) != "v1-new" {
+		t.Fatalf("Get k1 = %q, %v; want v1-new", v, ok)
+	}
+	if v, e, ok := s.Get("k2"); !ok || string(v) != "v2" || !e.Equal(expire) {
+		t.Fatalf("Get k2 = %q expire %v; want v2 expire %v", v, e, expire)
+	}
+	s.Delete("k2")
+	if _, _, ok := s.Get("k2"); ok || s.Len() != 1 {
+		t.Fatalf("k2 should be deleted")
+	}
+}
+
+func TestExpire(t *testing.T) {
+	s, _ := Open(t.TempDir(), 1<<20)
+	defer s.Close()
+	now := time.Now()
+	s.Now = func() time.Time { return now }
+
+	s.Put("k", []byte("v"), now.Add(time.Second))
+	if _, _, ok := s.Get("k"); !ok {
+		t.Fatalf("k should not expire yet")
+	}
+	now = now.Add(2 * time.Second)
+	if _, _, ok := s.Get("k"); ok {
+		t.Fatalf("expired k should not be returned")
+	}
+}
+
+// 超过容量时整段淘汰最旧的记录，磁盘占用不超过 maxBytes
+func TestBudget(t *testing.T) {
+	dir := t.TempDir()
+	const maxBytes = 4096
+	s, _ := Open(dir, maxBytes)
+	defer s.Close()
+
+	value := make([]byte, 100)
+	for i := 0; i < 200; i++ {
+		if err := s.Put("key"+strconv.Itoa(i), value, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+		if s.Bytes() > maxBytes {
+			t.Fatalf("store uses %d bytes, exceeds %d", s.Bytes(), maxBytes)
+		}
+	}
+	if _, _, ok := s.Get("key0"); ok {
+		t.Errorf("oldest key should be evicted")
+	}
+	if _, _, ok := s.Get("key199"); !ok {
+		t.Errorf("newest key should be kept")
+	}
+
+	var size int64
+	files, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	for _, name := range files {
+		fi, _ := os.Stat(name)
+		size += fi.Size()
+	}
+	if size != s.Bytes() {
+		t.Errorf("segment files use %d bytes, store reports %d", size, s.Bytes())
+	}
+
+	if err := s.Put("huge", make([]byte, maxBytes), time.Time{}); err != ErrTooLarge {
+		t.Errorf("Put larger than capacity = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestCorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := Open(dir, 1<<20)
+	defer s.Close()
+	s.Put("k", []byte("value"), time.Time{})
+
+	f := s.active().f
+	f.WriteAt([]byte("X"), s.active().size-1) // 损坏 value 的最后一个字节
+	if _, _, ok := s.Get("k"); ok {
+		t.Fatalf("corrupt record should be treated as missing")
+	}
+}
+
+// Open 清理上一次遗留的段文件，Close 删除全部段文件
+func TestOpenClose(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "00000007"+segmentSuffix), []byte("stale"), 0o644)
+	s, err := Open(dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put("k", []byte("v"), time.Time{})
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix)); len(files) != 0 {
+		t.Fatalf("segment files left after Close: %v", files)
+	}
+}
+
+func TestDeletePrefix(t *testing.T) {
+	s, _ := Open(t.TempDir(), 1<<20)
+	defer s.Close()
+	for _, key := range []string{"user:42", "user:42:cart", "user:7"} {
+		s.Put(key, []byte("v"), time.Time{})
+	}
+	if n := s.DeletePrefix("user:42"); n != 2 || s.Len() != 1 {
+		t.Fatalf("DeletePrefix removed %d, %d keys left; want 2 removed, 1 left", n, s.Len())
+	}
+	if _, _, ok := s.Get("user:7"); !ok {
+		t.Fatalf("user:7 should be kept")
+	}
+}
+
+// DeleteRecord 只删除 Lookup 读到的那条记录，key 已被覆盖或删除时不删除
+func TestDeleteRecord(t *testing.T) {
+	s, _ := Open(t.TempDir(), 1<<20)
+	defer s.Close()
+	s.Put("k", []byte("v1"), time.Time{})
+	r, ok := s.Lookup("k")
+	if !ok || string(r.Value) != "v1" {
+		t.Fatalf("Lookup = %q, %v; want v1", r.Value, ok)
+	}
+	s.Put("k", []byte("v2"), time.Time{})
+	if s.DeleteRecord("k", r) {
+		t.Fatalf("DeleteRecord should not delete an overwritten record")
+	}
+	r, _ = s.Lookup("k")
+	if !s.DeleteRecord("k", r) || s.Len() != 0 {
+		t.Fatalf("DeleteRecord should delete the latest record")
+	}
+	if s.DeleteRecord("k", r) {
+		t.Fatalf("DeleteRecord should fail after the key is deleted")
+	}
+}
+
+func TestPutRecord(t *testing.T) {
+	s, _ := Open(t.TempDir(), 1<<20)
+	defer s.Close()
+	expire := time.Now().Add(time.Hour).Round(0)
+	s.PutRecord("k", Record{Value: []byte("v"), Expire: expire, Version: 42})
+	if r, ok := s.Lookup("k"); !ok || string(r.Value) != "v" || !r.Expire.Equal(expire) || r.Version != 42 {
+		t.Fatalf("Lookup = %q expire %v version %d, want v %v 42", r.Value, r.Expire, r.Version, expire)
+	}
+}
+
+func TestDeleteTag(t *testing.T) {
+	s, _ := Open(t.TempDir(), 1<<20)
+	defer s.Close()
+	s.PutRecord("u1", Record{Value: []byte("v"), Tags: []string{"user", "vip"}})
+	s.PutRecord("u2", Record{Value: []byte("v"), Tags: []string{"user"}})
+	s.PutRecord("u3", Record{Value: []byte("v"), Tags: []string{"user"}})
+	s.Put("u3", []byte("untagged"), time.Time{}) // 覆盖后不再带有标签
+
+	if r, ok := s.Lookup("u1"); !ok || len(r.Tags) != 2 || r.Tags[0] != "user" || r.Tags[1] != "vip" {
+		t.Fatalf("Lookup u1 tags = %v, want [user vip]", r.Tags)
+	}
+	if n := s.DeleteTag("user"); n != 2 || s.Len() != 1 {
+		t.Fatalf("DeleteTag removed %d, %d keys left; want 2 removed, 1 left", n, s.Len())
+	}
+	if n := s.DeleteTag("vip"); n != 0 {
+		t.Fatalf("deleted keys should leave the tag index, DeleteTag(vip) = %d", n)
+	}
+}
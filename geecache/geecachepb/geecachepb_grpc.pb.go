@@ -20,9 +20,16 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	GroupCache_Get_FullMethodName    = "/geecachepb.GroupCache/Get"
-	GroupCache_Put_FullMethodName    = "/geecachepb.GroupCache/Put"
-	GroupCache_Delete_FullMethodName = "/geecachepb.GroupCache/Delete"
+	GroupCache_Get_FullMethodName            = "/geecachepb.GroupCache/Get"
+	GroupCache_Put_FullMethodName            = "/geecachepb.GroupCache/Put"
+	GroupCache_Delete_FullMethodName         = "/geecachepb.GroupCache/Delete"
+	GroupCache_Handoff_FullMethodName        = "/geecachepb.GroupCache/Handoff"
+	GroupCache_Warmup_FullMethodName         = "/geecachepb.GroupCache/Warmup"
+	GroupCache_CompareAndSet_FullMethodName  = "/geecachepb.GroupCache/CompareAndSet"
+	GroupCache_Incr_FullMethodName           = "/geecachepb.GroupCache/Incr"
+	GroupCache_Invalidations_FullMethodName  = "/geecachepb.GroupCache/Invalidations"
+	GroupCache_RemoveMatching_FullMethodName = "/geecachepb.GroupCache/RemoveMatching"
+	GroupCache_Purge_FullMethodName          = "/geecachepb.GroupCache/Purge"
 )
 
 // GroupCacheClient is the client API for GroupCache service.
@@ -32,6 +39,20 @@ type GroupCacheClient interface {
 	Get(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error)
 	Put(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
 	Delete(ctx context.Context, in *Request, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// Handoff 哈希环变化后，旧的所有者将不再负责的 key 以流的形式交给新的所有者
+	Handoff(ctx context.Context, opts ...grpc.CallOption) (GroupCache_HandoffClient, error)
+	// Warmup 按最近访问时间从新到旧返回 mainCache 中的条目，供新启动的节点预热
+	Warmup(ctx context.Context, in *WarmupRequest, opts ...grpc.CallOption) (GroupCache_WarmupClient, error)
+	// CompareAndSet 在 key 的主节点上比较版本号并写入，版本号不一致时返回 Aborted
+	CompareAndSet(ctx context.Context, in *CompareAndSetRequest, opts ...grpc.CallOption) (*CompareAndSetResponse, error)
+	// Incr 在 key 的主节点上原子地增加计数器，值不是整数时返回 FailedPrecondition
+	Incr(ctx context.Context, in *IncrRequest, opts ...grpc.CallOption) (*IncrResponse, error)
+	// Invalidations 推送 after_seq 之后本节点发布的失效事件，直到订阅方断开
+	Invalidations(ctx context.Context, in *InvalidationsRequest, opts ...grpc.CallOption) (GroupCache_InvalidationsClient, error)
+	// RemoveMatching 按标签或前缀移除节点 mainCache 与 hotCache 中的条目
+	RemoveMatching(ctx context.Context, in *RemoveMatchingRequest, opts ...grpc.CallOption) (*RemoveMatchingResponse, error)
+	// Purge 清空节点上 group 的 mainCache、hotCache 与磁盘缓存
+	Purge(ctx context.Context, in *PurgeRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
 }
 
 type groupCacheClient struct {
@@ -69,6 +90,140 @@ func (c *groupCacheClient) Delete(ctx context.Context, in *Request, opts ...grpc
 	return out, nil
 }
 
+func (c *groupCacheClient) Handoff(ctx context.Context, opts ...grpc.CallOption) (GroupCache_HandoffClient, error) {
+	stream, err := c.cc.NewStream(ctx, &GroupCache_ServiceDesc.Streams[0], GroupCache_Handoff_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &groupCacheHandoffClient{stream}
+	return x, nil
+}
+
+type GroupCache_HandoffClient interface {
+	Send(*SetRequest) error
+	CloseAndRecv() (*HandoffResponse, error)
+	grpc.ClientStream
+}
+
+type groupCacheHandoffClient struct {
+	grpc.ClientStream
+}
+
+func (x *groupCacheHandoffClient) Send(m *SetRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *groupCacheHandoffClient) CloseAndRecv() (*HandoffResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(HandoffResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *groupCacheClient) Warmup(ctx context.Context, in *WarmupRequest, opts ...grpc.CallOption) (GroupCache_WarmupClient, error) {
+	stream, err := c.cc.NewStream(ctx, &GroupCache_ServiceDesc.Streams[1], GroupCache_Warmup_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &groupCacheWarmupClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type GroupCache_WarmupClient interface {
+	Recv() (*SetRequest, error)
+	grpc.ClientStream
+}
+
+type groupCacheWarmupClient struct {
+	grpc.ClientStream
+}
+
+func (x *groupCacheWarmupClient) Recv() (*SetRequest, error) {
+	m := new(SetRequest)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *groupCacheClient) CompareAndSet(ctx context.Context, in *CompareAndSetRequest, opts ...grpc.CallOption) (*CompareAndSetResponse, error) {
+	out := new(CompareAndSetResponse)
+	err := c.cc.Invoke(ctx, GroupCache_CompareAndSet_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *groupCacheClient) Incr(ctx context.Context, in *IncrRequest, opts ...grpc.CallOption) (*IncrResponse, error) {
+	out := new(IncrResponse)
+	err := c.cc.Invoke(ctx, GroupCache_Incr_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *groupCacheClient) Invalidations(ctx context.Context, in *InvalidationsRequest, opts ...grpc.CallOption) (GroupCache_InvalidationsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &GroupCache_ServiceDesc.Streams[2], GroupCache_Invalidations_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &groupCacheInvalidationsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type GroupCache_InvalidationsClient interface {
+	Recv() (*Invalidation, error)
+	grpc.ClientStream
+}
+
+type groupCacheInvalidationsClient struct {
+	grpc.ClientStream
+}
+
+func (x *groupCacheInvalidationsClient) Recv() (*Invalidation, error) {
+	m := new(Invalidation)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *groupCacheClient) RemoveMatching(ctx context.Context, in *RemoveMatchingRequest, opts ...grpc.CallOption) (*RemoveMatchingResponse, error) {
+	out := new(RemoveMatchingResponse)
+	err := c.cc.Invoke(ctx, GroupCache_RemoveMatching_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *groupCacheClient) Purge(ctx context.Context, in *PurgeRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, GroupCache_Purge_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // GroupCacheServer is the server API for GroupCache service.
 // All implementations must embed UnimplementedGroupCacheServer
 // for forward compatibility
@@ -76,6 +231,20 @@ type GroupCacheServer interface {
 	Get(context.Context, *Request) (*Response, error)
 	Put(context.Context, *SetRequest) (*emptypb.Empty, error)
 	Delete(context.Context, *Request) (*emptypb.Empty, error)
+	// Handoff 哈希环变化后，旧的所有者将不再负责的 key 以流的形式交给新的所有者
+	Handoff(GroupCache_HandoffServer) error
+	// Warmup 按最近访问时间从新到旧返回 mainCache 中的条目，供新启动的节点预热
+	Warmup(*WarmupRequest, GroupCache_WarmupServer) error
+	// CompareAndSet 在 key 的主节点上比较版本号并写入，版本号不一致时返回 Aborted
+	CompareAndSet(context.Context, *CompareAndSetRequest) (*CompareAndSetResponse, error)
+	// Incr 在 key 的主节点上原子地增加计数器，值不是整数时返回 FailedPrecondition
+	Incr(context.Context, *IncrRequest) (*IncrResponse, error)
+	// Invalidations 推送 after_seq 之后本节点发布的失效事件，直到订阅方断开
+	Invalidations(*InvalidationsRequest, GroupCache_InvalidationsServer) error
+	// RemoveMatching 按标签或前缀移除节点 mainCache 与 hotCache 中的条目
+	RemoveMatching(context.Context, *RemoveMatchingRequest) (*RemoveMatchingResponse, error)
+	// Purge 清空节点上 group 的 mainCache、hotCache 与磁盘缓存
+	Purge(context.Context, *PurgeRequest) (*emptypb.Empty, error)
 	mustEmbedUnimplementedGroupCacheServer()
 }
 
@@ -92,6 +261,27 @@ func (UnimplementedGroupCacheServer) Put(context.Context, *SetRequest) (*emptypb
 func (UnimplementedGroupCacheServer) Delete(context.Context, *Request) (*emptypb.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
 }
+func (UnimplementedGroupCacheServer) Handoff(GroupCache_HandoffServer) error {
+	return status.Errorf(codes.Unimplemented, "method Handoff not implemented")
+}
+func (UnimplementedGroupCacheServer) Warmup(*WarmupRequest, GroupCache_WarmupServer) error {
+	return status.Errorf(codes.Unimplemented, "method Warmup not implemented")
+}
+func (UnimplementedGroupCacheServer) CompareAndSet(context.Context, *CompareAndSetRequest) (*CompareAndSetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CompareAndSet not implemented")
+}
+func (UnimplementedGroupCacheServer) Incr(context.Context, *IncrRequest) (*IncrResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Incr not implemented")
+}
+func (UnimplementedGroupCacheServer) Invalidations(*InvalidationsRequest, GroupCache_InvalidationsServer) error {
+	return status.Errorf(codes.Unimplemented, "method Invalidations not implemented")
+}
+func (UnimplementedGroupCacheServer) RemoveMatching(context.Context, *RemoveMatchingRequest) (*RemoveMatchingResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveMatching not implemented")
+}
+func (UnimplementedGroupCacheServer) Purge(context.Context, *PurgeRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Purge not implemented")
+}
 func (UnimplementedGroupCacheServer) mustEmbedUnimplementedGroupCacheServer() {}
 
 // UnsafeGroupCacheServer may be embedded to opt out of forward compatibility for this service.
@@ -159,6 +349,146 @@ func _GroupCache_Delete_Handler(srv interface{}, ctx context.Context, dec func(i
 	return interceptor(ctx, in, info, handler)
 }
 
+func _GroupCache_Handoff_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(GroupCacheServer).Handoff(&groupCacheHandoffServer{stream})
+}
+
+type GroupCache_HandoffServer interface {
+	SendAndClose(*HandoffResponse) error
+	Recv() (*SetRequest, error)
+	grpc.ServerStream
+}
+
+type groupCacheHandoffServer struct {
+	grpc.ServerStream
+}
+
+func (x *groupCacheHandoffServer) SendAndClose(m *HandoffResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *groupCacheHandoffServer) Recv() (*SetRequest, error) {
+	m := new(SetRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _GroupCache_Warmup_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WarmupRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GroupCacheServer).Warmup(m, &groupCacheWarmupServer{stream})
+}
+
+type GroupCache_WarmupServer interface {
+	Send(*SetRequest) error
+	grpc.ServerStream
+}
+
+type groupCacheWarmupServer struct {
+	grpc.ServerStream
+}
+
+func (x *groupCacheWarmupServer) Send(m *SetRequest) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _GroupCache_CompareAndSet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CompareAndSetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GroupCacheServer).CompareAndSet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GroupCache_CompareAndSet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GroupCacheServer).CompareAndSet(ctx, req.(*CompareAndSetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GroupCache_Incr_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IncrRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GroupCacheServer).Incr(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GroupCache_Incr_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GroupCacheServer).Incr(ctx, req.(*IncrRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GroupCache_Invalidations_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(InvalidationsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GroupCacheServer).Invalidations(m, &groupCacheInvalidationsServer{stream})
+}
+
+type GroupCache_InvalidationsServer interface {
+	Send(*Invalidation) error
+	grpc.ServerStream
+}
+
+type groupCacheInvalidationsServer struct {
+	grpc.ServerStream
+}
+
+func (x *groupCacheInvalidationsServer) Send(m *Invalidation) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _GroupCache_RemoveMatching_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveMatchingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GroupCacheServer).RemoveMatching(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GroupCache_RemoveMatching_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GroupCacheServer).RemoveMatching(ctx, req.(*RemoveMatchingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GroupCache_Purge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PurgeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GroupCacheServer).Purge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GroupCache_Purge_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GroupCacheServer).Purge(ctx, req.(*PurgeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // GroupCache_ServiceDesc is the grpc.ServiceDesc for GroupCache service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -178,7 +508,39 @@ var GroupCache_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Delete",
 			Handler:    _GroupCache_Delete_Handler,
 		},
+		{
+			MethodName: "CompareAndSet",
+			Handler:    _GroupCache_CompareAndSet_Handler,
+		},
+		{
+			MethodName: "Incr",
+			Handler:    _GroupCache_Incr_Handler,
+		},
+		{
+			MethodName: "RemoveMatching",
+			Handler:    _GroupCache_RemoveMatching_Handler,
+		},
+		{
+			MethodName: "Purge",
+			Handler:    _GroupCache_Purge_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Handoff",
+			Handler:       _GroupCache_Handoff_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Warmup",
+			Handler:       _GroupCache_Warmup_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Invalidations",
+			Handler:       _GroupCache_Invalidations_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "geecachepb.proto",
 }
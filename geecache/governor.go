@@ -0,0 +1,200 @@
+package geecache
+
+import (
+	"math"
+	"runtime/debug"
+	"runtime/metrics"
+	"sync"
+	"time"
+)
+
+/*
+	进程级的内存调节：Governor 每隔 Interval 读取 runtime/metrics 中的堆内存，与软上限（默认即 GOMEMLIMIT）比较。
+	超过 SoftLimit*Threshold 时将全部 Group 的内存上限乘以 ShrinkFactor，压力消失后逐步恢复。
+	TotalBytes 不为 0 时，全局预算按各 Group 的 configBytes（NewGroup 或 SetCacheBytes 设置的大小）为权重分配；
+	为 0 时每个 Group 以 configBytes 为预算，只随内存压力收缩。上限缩小时立即按 LRU 顺序淘汰，
+	mainCache 中淘汰的条目同样降级到磁盘。一个进程只应运行一个 Governor。
+*/
+
+// GovernorOptions Governor 的配置，零值字段使用默认值
+type GovernorOptions struct {
+	// TotalBytes 全部 Group 共享的内存预算，为 0 时不重新分配
+	TotalBytes int64
+
+	// SoftLimit 堆内存的软上限，为 0 时使用 debug.SetMemoryLimit 的当前值（即 GOMEMLIMIT），未设置时不检测内存压力
+	SoftLimit int64
+
+	// Threshold 堆内存超过 SoftLimit*Threshold 时收缩，默认 0.9
+	Threshold float64
+
+	// ShrinkFactor 每次收缩保留的比例，默认 0.8；堆内存低于 SoftLimit*Threshold*ShrinkFactor 时按相同比例恢复
+	ShrinkFactor float64
+
+	// MinScale 收缩的下限，默认 0.05，即每个 Group 至少保留预算的 5%
+	MinScale float64
+
+	// Interval 检查间隔，默认 1s
+	Interval time.Duration
+}
+
+func (o GovernorOptions) withDefaults() GovernorOptions {
+	if o.Threshold <= 0 || o.Threshold > 1 {
+		o.Threshold = 0.9
+	}
+	if o.ShrinkFactor <= 0 || o.ShrinkFactor >= 1 {
+		o.ShrinkFactor = 0.8
+	}
+	if o.MinScale <= 0 || o.MinScale > 1 {
+		o.MinScale = 0.05
+	}
+	if o.Interval <= 0 {
+		o.Interval = time.Second
+	}
+	return o
+}
+
+// Governor 根据进程的内存压力调整全部 Group 的内存上限
+type Governor struct {
+	opts GovernorOptions
+
+	mu    sync.Mutex
+	scale float64 // 当前预算的比例，(0, 1]
+
+	stop     chan struct{}
+	done     chan struct{}
+	readHeap func() uint64 // 读取堆内存，测试时替换
+}
+
+// NewGovernor 实例化 Governor，调用 Start 后开始定期调整
+func NewGovernor(o GovernorOptions) *Governor {
+	return &Governor{
+		opts:     o.withDefaults(),
+		scale:    1,
+		readHeap: heapBytes,
+	}
+}
+
+// Start 在后台每隔 Interval 调用一次 Adjust，直到 Stop
+func (gv *Governor) Start() {
+	gv.mu.Lock()
+	defer gv.mu.Unlock()
+	if gv.stop != nil {
+		return
+	}
+	gv.stop, gv.done = make(chan struct{}), make(chan struct{})
+	go gv.loop(gv.stop, gv.done)
+}
+
+// Stop 停止后台调整，已设置的上限保持不变
+func (gv *Governor) Stop() {
+	gv.mu.Lock()
+	stop, done := gv.stop, gv.done
+	gv.stop, gv.done = nil, nil
+	gv.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+func (gv *Governor) loop(stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(gv.opts.Interval)
+	defer ticker.Stop()
+	gv.Adjust()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			gv.Adjust()
+		}
+	}
+}
+
+// Scale 返回当前预算的比例，1 表示没有因内存压力收缩
+func (gv *Governor) Scale() float64 {
+	gv.mu.Lock()
+	defer gv.mu.Unlock()
+	return gv.scale
+}
+
+// Adjust 读取一次堆内存，更新预算的比例并重新设置全部 Group 的内存上限
+func (gv *Governor) Adjust() {
+	limit := gv.opts.SoftLimit
+	if limit <= 0 {
+		limit = debug.SetMemoryLimit(-1) // 负数只读取当前值
+	}
+	heap := float64(gv.readHeap())
+
+	gv.mu.Lock()
+	high := float64(limit) * gv.opts.Threshold
+	switch {
+	case limit <= 0 || limit == math.MaxInt64: // 没有软上限
+		gv.scale = 1
+	case heap > high:
+		gv.scale = math.Max(gv.scale*gv.opts.ShrinkFactor, gv.opts.MinScale)
+	case heap < high*gv.opts.ShrinkFactor:
+		gv.scale = math.Min(gv.scale/gv.opts.ShrinkFactor, 1)
+	}
+	scale := gv.scale
+	gv.mu.Unlock()
+
+	mu.RLock()
+	gs := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		gs = append(gs, g)
+	}
+	mu.RUnlock()
+
+	var weights int64
+	for _, g := range gs {
+		if w := g.configBytes.Load(); w > 0 {
+			weights += w
+		}
+	}
+	for _, g := range gs {
+		w := g.configBytes.Load()
+		if w <= 0 {
+			continue // 未开启缓存的 Group 不参与分配
+		}
+		budget := float64(w)
+		if gv.opts.TotalBytes > 0 {
+			budget = float64(gv.opts.TotalBytes) * float64(w) / float64(weights)
+		}
+		g.setLimit(int64(math.Max(budget*scale, 1)))
+	}
+}
+
+// heapBytes 返回堆中对象占用的内存。优先使用上次 GC 后存活的对象，不包括等待回收的对象
+func heapBytes() uint64 {
+	samples := []metrics.Sample{
+		{Name: "/gc/heap/live:bytes"},
+		{Name: "/memory/classes/heap/objects:bytes"},
+	}
+	metrics.Read(samples)
+	for _, s := range samples {
+		if s.Value.Kind() == metrics.KindUint64 {
+			return s.Value.Uint64()
+		}
+	}
+	return 0
+}
+
+// CacheBytes 返回 Group 当前的内存上限
+func (g *Group) CacheBytes() int64 {
+	return g.cacheBytes.Load()
+}
+
+// SetCacheBytes 修改 Group 的内存上限，缩小时立即淘汰超出的条目；不大于 0 时清空并停止缓存。
+// 运行 Governor 时 n 作为该 Group 的权重，实际上限由 Governor 重新计算
+func (g *Group) SetCacheBytes(n int64) {
+	g.configBytes.Store(n)
+	g.setLimit(n)
+}
+
+func (g *Group) setLimit(n int64) {
+	if old := g.cacheBytes.Swap(n); n < old {
+		g.loadGroup.Lock(g.evict)
+	}
+}
@@ -0,0 +1,140 @@
+package geecache
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// restoreLimits Governor 会修改全部已注册 Group 的上限，测试结束后恢复
+func restoreLimits(t *testing.T) {
+	t.Cleanup(func() {
+		mu.RLock()
+		defer mu.RUnlock()
+		for _, g := range groups {
+			g.setLimit(g.configBytes.Load())
+		}
+	})
+}
+
+func fill(g *Group, n int) {
+	for i := 0; i < n; i++ {
+		g.localSet("key"+strconv.Itoa(i), ByteView{b: []byte(strings.Repeat("v", 100))}, &g.mainCache)
+	}
+}
+
+func TestSetCacheBytes(t *testing.T) {
+	gp := NewGroupOpts("set-cache-bytes", 1<<20, GetterFunc(notFound), &GroupOptions{DiskDir: t.TempDir(), DiskBytes: 1 << 20})
+	fill(gp, 100)
+	if gp.mainCache.len() != 100 {
+		t.Fatalf("mainCache holds %d entries, want 100", gp.mainCache.len())
+	}
+
+	gp.SetCacheBytes(8 << 10)
+	if used := gp.mainCache.bytes() + gp.hotCache.bytes(); used > 8<<10 || gp.CacheBytes() != 8<<10 {
+		t.Fatalf("%d bytes used after shrinking to %d", used, 8<<10)
+	}
+	gp.flushDemoted()
+	if n := gp.mainCache.len(); gp.disk.Len() != 100-n {
+		t.Fatalf("%d entries evicted but %d demoted to disk", 100-n, gp.disk.Len())
+	}
+	if _, ok := gp.mainCache.peek("key99"); !ok {
+		t.Fatalf("the most recent entry should be kept")
+	}
+
+	gp.SetCacheBytes(0)
+	if gp.mainCache.len() != 0 {
+		t.Fatalf("SetCacheBytes(0) should clear the cache")
+	}
+	gp.localSet("Tom", ByteView{b: []byte("630")}, &gp.mainCache)
+	if gp.mainCache.len() != 0 {
+		t.Fatalf("a disabled cache should not store values")
+	}
+}
+
+func TestGovernorDistribute(t *testing.T) {
+	restoreLimits(t)
+	small := NewGroup("governor-small", 1<<20, GetterFunc(notFound))
+	large := NewGroup("governor-large", 3<<20, GetterFunc(notFound))
+
+	gv := NewGovernor(GovernorOptions{SoftLimit: 1 << 30})
+	gv.readHeap = func() uint64 { return 0 }
+	gv.Adjust()
+	if small.CacheBytes() != 1<<20 || large.CacheBytes() != 3<<20 {
+		t.Fatalf("without a total budget the limits should stay, got %d and %d", small.CacheBytes(), large.CacheBytes())
+	}
+
+	// 全局预算按 configBytes 的比例分配
+	var weights int64
+	mu.RLock()
+	for _, g := range groups {
+		if w := g.configBytes.Load(); w > 0 {
+			weights += w
+		}
+	}
+	mu.RUnlock()
+	gv = NewGovernor(GovernorOptions{TotalBytes: 64 << 20, SoftLimit: 1 << 30})
+	gv.readHeap = func() uint64 { return 0 }
+	gv.Adjust()
+	if got, want := large.CacheBytes(), int64(float64(64<<20)*float64(3<<20)/float64(weights)); got != want {
+		t.Fatalf("large group got %d bytes, want %d", got, want)
+	}
+	if got := large.CacheBytes(); got != 3*small.CacheBytes() && got != 3*small.CacheBytes()+1 {
+		t.Fatalf("large group got %d bytes, want three times the small group's %d", got, small.CacheBytes())
+	}
+}
+
+func TestGovernorPressure(t *testing.T) {
+	restoreLimits(t)
+	gp := NewGroup("governor-pressure", 64<<10, GetterFunc(notFound))
+	fill(gp, 200)
+	before := gp.mainCache.bytes()
+
+	heap := uint64(95 << 20)
+	gv := NewGovernor(GovernorOptions{SoftLimit: 100 << 20, ShrinkFactor: 0.5})
+	gv.readHeap = func() uint64 { return heap }
+
+	// 超过 90% 时收缩，并立即淘汰
+	gv.Adjust()
+	if gv.Scale() != 0.5 || gp.CacheBytes() != 32<<10 {
+		t.Fatalf("scale %.2f, limit %d; want 0.5 and %d", gv.Scale(), gp.CacheBytes(), 32<<10)
+	}
+	if used := gp.mainCache.bytes(); used > 32<<10 || used >= before {
+		t.Fatalf("%d bytes used after shrinking from %d", used, before)
+	}
+	for i := 0; i < 10; i++ {
+		gv.Adjust()
+	}
+	if gv.Scale() != 0.05 {
+		t.Fatalf("scale %.2f, want the 0.05 floor", gv.Scale())
+	}
+
+	// 处于滞回区间时保持不变，压力消失后逐步恢复
+	heap = 60 << 20
+	gv.Adjust()
+	if gv.Scale() != 0.05 {
+		t.Fatalf("scale should hold between the thresholds, got %.2f", gv.Scale())
+	}
+	heap = 10 << 20
+	for i := 0; i < 10; i++ {
+		gv.Adjust()
+	}
+	if gv.Scale() != 1 || gp.CacheBytes() != 64<<10 {
+		t.Fatalf("scale %.2f, limit %d; want a full recovery", gv.Scale(), gp.CacheBytes())
+	}
+}
+
+func TestGovernorStartStop(t *testing.T) {
+	restoreLimits(t)
+	if heapBytes() == 0 {
+		t.Fatalf("heapBytes should read the heap size from runtime/metrics")
+	}
+	gp := NewGroup("governor-loop", 64<<10, GetterFunc(notFound))
+	gv := NewGovernor(GovernorOptions{SoftLimit: 1 << 20, Interval: time.Millisecond})
+	gv.readHeap = func() uint64 { return 1 << 30 }
+	gv.Start()
+	waitFor(t, "the governor to shrink the group", func() bool { return gp.CacheBytes() < 64<<10 })
+	gv.Stop()
+	gv.Stop() // 重复停止
+}
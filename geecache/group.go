@@ -3,10 +3,13 @@ package geecache
 import (
 	"bytes"
 	"errors"
-	pb "geecache/geecachepb"
+	"fmt"
+	"geecache/compress"
+	"geecache/disk"
 	"geecache/singleflight"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -23,6 +26,16 @@ func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key)
 }
 
+// TaggedGetter Getter 实现了该接口时，加载时通过 GetTagged 查询源数据，同时返回 key 的标签
+type TaggedGetter interface {
+	GetTagged(key string) (value []byte, tags []string, err error)
+}
+
+// StringGetter Getter 实现了该接口时，加载时通过 GetString 查询源数据，值直接以 string 保存，不需要拷贝
+type StringGetter interface {
+	GetString(key string) (string, error)
+}
+
 /*
 	Group 是 GeeCache 最核心的数据结构，负责与用户的交互，并且控制缓存值存储和获取的流程。
 	+-----------------------------------------------------------------------------------+
@@ -42,7 +55,10 @@ type Group struct {
 	peersOnce sync.Once
 	peers     PeerPicker
 
-	cacheBytes int64 // limit for sum of mainCache and hotCache size
+	// cacheBytes limit for sum of mainCache and hotCache size，运行时可由 SetCacheBytes 或 Governor 修改。
+	// configBytes 为 NewGroup 或 SetCacheBytes 设置的大小，Governor 以它为权重分配内存
+	cacheBytes  atomic.Int64
+	configBytes atomic.Int64
 
 	// mainCache 是此进程（在其对等方中）具有权威性的键的缓存。
 	// 不同数据的key根据一致性哈希原理，是分布在不同的节点上的，每个节点都是一个进程，
@@ -58,11 +74,111 @@ type Group struct {
 	// 保证并发时相同请求只请求一次，返回相同结果
 	loadGroup *singleflight.Set
 
+	// 其他节点转发来的查询单独合并，不与本节点正在转发给其他节点的查询合并，
+	// 否则两个节点互相转发同一个 key 时会互相等待直至超时
+	peerLoadGroup *singleflight.Set
+
 	// 确保无论并发调用方的数量如何，仅远程添加一次key
 	setGroup *singleflight.Set
 
 	// 确保无论并发调用方的数量如何，仅远程移除一次key
 	removeGroup *singleflight.Set
+
+	readQuorum  int           // 从远程副本读取时，需要成功响应的副本数
+	writeQuorum int           // 写入/移除副本时，需要成功确认的副本数
+	fallbackTTL time.Duration // 副本全部不可用、由当前节点代为查询的值在 hotCache 中的存活时间
+	snapshotHot bool          // Snapshot 是否包含 hotCache
+
+	// disk 磁盘上的第二级缓存，为 nil 时不启用。mainCache 中淘汰的条目降级到这里，
+	// lookupCache 在内存中未命中时查找这里，命中后移回 mainCache
+	disk *disk.Store
+
+	// demoting 已从 mainCache 淘汰、等待后台写入磁盘的条目，在 loadGroup.Lock 中读写
+	demoting    map[string]*demotion
+	demoteReady chan struct{} // 有新的条目等待写入磁盘
+	demoteOnce  sync.Once     // 第一次淘汰时启动后台协程
+	demoteMu    sync.Mutex    // 同一时间只有一个 flushDemoted 写入磁盘
+	demoteStop  chan struct{} // Close 时关闭，后台协程退出
+
+	// diskRemoving 正在锁外按标签、前缀删除磁盘条目的操作数，diskEpoch 在每次开始与结束时加一，都在 loadGroup.Lock 中读写
+	diskRemoving int
+	diskEpoch    uint64
+
+	closeOnce sync.Once
+
+	// writer 将主节点上的 Set/Remove 写回数据源，未配置 Setter/Deleter 时为 nil
+	writer *originWriter
+
+	removePolicy RemovePolicy   // Remove 需要多少节点成功
+	removeRetry  *removeRetrier // 后台重试移除失败的节点
+
+	// generation 每次 Purge 加一，在 loadGroup.Lock 中修改。加载开始后 generation 改变时，加载的值不存入缓存
+	generation atomic.Uint64
+
+	// compression 存入缓存前使用的压缩算法，不小于 compressThreshold 字节的值才压缩
+	compression       compress.Algorithm
+	compressThreshold int
+	compressStats     compressionCounters
+
+	ownsGetterValues bool // Getter 返回的切片归 Group 所有，加载时不需要拷贝
+
+	maxEntries int // mainCache 与 hotCache 合计的条目数上限，0 表示只按 cacheBytes 限制
+
+	// keyLocks 按 key 分段的锁，主节点上同一个 key 的写操作（写回数据源、CompareAndSet）依次执行
+	keyLocks [keyLockStripes]sync.Mutex
+
+	versionMu   sync.Mutex
+	lastVersion uint64 // 最近分配的版本号
+}
+
+const keyLockStripes = 64
+
+// GroupOptions Group 的可选配置，零值字段使用默认值
+type GroupOptions struct {
+	// ReadQuorum 当前节点不是 key 的副本时，需要从多少个远程副本成功读取，默认为 1。
+	// 返回值以优先级最高的成功副本为准，某个副本失败时依次回退到下一个副本。
+	ReadQuorum int
+
+	// WriteQuorum Set/Remove 需要得到多少个副本的确认才算成功，默认为 1。
+	// 超过副本数时按副本数计算。
+	WriteQuorum int
+
+	// FallbackTTL key 的副本全部不可用时，当前节点会代为调用 Getter 查询。当前节点并非 key 的所有者，
+	// 因此结果只以 FallbackTTL 为过期时间存入 hotCache；为 0 时不缓存。
+	FallbackTTL time.Duration
+
+	// SnapshotHotCache Snapshot 是否同时保存 hotCache，默认只保存 mainCache
+	SnapshotHotCache bool
+
+	// DiskDir 不为空时启用磁盘上的第二级缓存，每个 Group 需要使用不同的目录。
+	// DiskBytes 为其磁盘占用的上限，与 cacheBytes 分别计算
+	DiskDir   string
+	DiskBytes int64
+
+	// Setter/Deleter 不为空时，key 的主节点在 Set/Remove 时将修改写回数据源，
+	// WriteMode 决定同步写回还是后台批量写回，WriteBehind 为后台写回队列的配置
+	Setter      Setter
+	Deleter     Deleter
+	WriteMode   WriteMode
+	WriteBehind WriteBehindOptions
+
+	// RemovePolicy Remove 需要多少节点成功才算成功，默认 RemoveAll。
+	// 失败的远程节点按 RemoveRetry 在后台重试
+	RemovePolicy RemovePolicy
+	RemoveRetry  RemoveRetryOptions
+
+	// Compression 不为 None 时，值在存入缓存前压缩，节点之间同样传输压缩后的值，
+	// cacheBytes 按压缩后的大小计算。小于 CompressThreshold 字节的值不压缩，默认为 256
+	Compression       compress.Algorithm
+	CompressThreshold int
+
+	// TransferOwnership 为 true 表示 Getter 返回的切片此后不再被 Getter 使用或修改，
+	// 加载时直接存入缓存，省去一次拷贝。默认会拷贝 Getter 返回的切片
+	TransferOwnership bool
+
+	// MaxEntries 大于 0 时，mainCache 与 hotCache 合计至多保存 MaxEntries 个条目，
+	// 与 cacheBytes 同时生效，超出任意一个都会淘汰
+	MaxEntries int
 }
 
 var (
@@ -72,6 +188,11 @@ var (
 
 // NewGroup 实例化 Group，并且将其存储在全局变量 groups 中
 func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+	return NewGroupOpts(name, cacheBytes, getter, nil)
+}
+
+// NewGroupOpts 与 NewGroup 相同，但允许通过 GroupOptions 指定更多配置
+func NewGroupOpts(name string, cacheBytes int64, getter Getter, o *GroupOptions) *Group {
 	if getter == nil {
 		panic("nil Getter")
 	}
@@ -81,17 +202,56 @@ func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
 		panic("duplicate registration of group " + name)
 	}
 	gp := &Group{
-		name:       name,
-		getter:     getter,
-		cacheBytes: cacheBytes,
+		name:   name,
+		getter: getter,
 
 		// peers 通过调用 Get() 方法时执行一次
 		// mainCache 延迟实例化
 
-		loadGroup:   &singleflight.Set{},
-		setGroup:    &singleflight.Set{},
-		removeGroup: &singleflight.Set{},
+		loadGroup:     &singleflight.Set{},
+		peerLoadGroup: &singleflight.Set{},
+		setGroup:      &singleflight.Set{},
+		removeGroup:   &singleflight.Set{},
+
+		readQuorum:  1,
+		writeQuorum: 1,
+	}
+	gp.cacheBytes.Store(cacheBytes)
+	gp.configBytes.Store(cacheBytes)
+	var retry RemoveRetryOptions
+	if o != nil {
+		if o.ReadQuorum > 0 {
+			gp.readQuorum = o.ReadQuorum
+		}
+		if o.WriteQuorum > 0 {
+			gp.writeQuorum = o.WriteQuorum
+		}
+		gp.fallbackTTL = o.FallbackTTL
+		gp.snapshotHot = o.SnapshotHotCache
+		if o.DiskDir != "" {
+			store, err := disk.Open(o.DiskDir, o.DiskBytes)
+			if err != nil {
+				panic(fmt.Sprintf("open disk cache of group %s failed: %v", name, err))
+			}
+			gp.disk = store
+			gp.demoting = make(map[string]*demotion)
+			gp.demoteReady = make(chan struct{}, 1)
+			gp.demoteStop = make(chan struct{})
+		}
+		if o.Setter != nil || o.Deleter != nil {
+			gp.writer = newOriginWriter(o.Setter, o.Deleter, o.WriteMode, o.WriteBehind)
+		}
+		gp.removePolicy = o.RemovePolicy
+		retry = o.RemoveRetry
+		if _, err := compress.Encode(o.Compression, nil); err != nil {
+			panic(fmt.Sprintf("group %s: %v", name, err))
+		}
+		gp.compression = o.Compression
+		gp.compressThreshold = o.CompressThreshold
+		gp.ownsGetterValues = o.TransferOwnership
+		gp.maxEntries = o.MaxEntries
 	}
+	gp.removeRetry = newRemoveRetrier(gp, retry)
 	groups[name] = gp
 	return gp
 }
@@ -104,6 +264,29 @@ func GetGroup(name string) *Group {
 	return g
 }
 
+// Close 将 Group 从 groups 中移除，等待 WriteBehind 队列写回数据源，停止后台降级并关闭、删除磁盘缓存。
+// 调用后不能再使用该 Group，可以用相同的名称重新创建
+func (g *Group) Close() error {
+	var err error
+	g.closeOnce.Do(func() {
+		mu.Lock()
+		if groups[g.name] == g {
+			delete(groups, g.name)
+		}
+		mu.Unlock()
+
+		g.FlushWrites()
+		if g.disk == nil {
+			return
+		}
+		close(g.demoteStop)
+		g.demoteMu.Lock() // 等待正在进行的 flushDemoted
+		defer g.demoteMu.Unlock()
+		err = g.disk.Close()
+	})
+	return err
+}
+
 func (g *Group) initPeers() {
 	if g.peers == nil {
 		g.peers = getPeerPicker()
@@ -118,12 +301,22 @@ func (g *Group) Query(key string) (ByteView, error) {
 	if key == "" {
 		return ByteView{}, nil
 	}
-	if byteView, cacheHit := g.lookupCache(key); cacheHit {
+	byteView, cacheHit := g.lookupCache(key)
+	if cacheHit {
 		log.Println("cache hit")
-		return byteView, nil
+	} else {
+		log.Println("cache not hit, get from load")
+		var err error
+		if byteView, err = g.load(key); err != nil {
+			return ByteView{}, err
+		}
+	}
+	// 压缩的值在返回前解压一次，调用方多次读取时不再解压
+	byteView, err := byteView.decompressOnce()
+	if err != nil {
+		return ByteView{}, fmt.Errorf("decompress %s: %w", key, err)
 	}
-	log.Println("cache not hit, get from load")
-	return g.load(key)
+	return byteView, nil
 }
 
 // 从外部查询 key
@@ -135,18 +328,58 @@ func (g *Group) load(key string) (ByteView, error) {
 		if value, cacheHit := g.lookupCache(key); cacheHit {
 			return value, nil
 		}
-		// 查远程节点，若存在的话。
+		gen := g.generation.Load() // 加载期间发生 Purge 时，加载的值不存入缓存
+		// 当前节点不是 key 的副本时，查远程副本节点
 		if g.peers != nil {
-			if peer, ok := g.peers.PickPeer(key); ok {
-				log.Printf("cache not hit, get from peer--[%v]\n", peer.(*client).name)
-				if value, err := g.getFromPeer(peer, key); err == nil {
-					log.Printf("从远程节点[%v]成功获取数据", peer.(*client).name)
+			if replicas := g.peers.PickPeers(key); !isReplica(replicas) {
+				value, err := g.getFromPeers(replicas, key, gen)
+				if err == nil {
 					return value, nil
 				}
+				// 副本全部不可用。当前节点不是所有者，不能把结果存入 mainCache
+				log.Printf("从远程副本获取数据失败，由本节点代为查询：%v", err)
+				return g.queryFallback(key, gen)
 			}
 		}
 		// 查本地
-		return g.queryLocally(key)
+		return g.queryLocally(key, gen)
+	})
+	if err == nil {
+		return btView.(ByteView), nil
+	}
+	return ByteView{}, err
+}
+
+// getForPeer 处理其他节点转发来的查询。与 Query 不同，缓存未命中时不会再转发给其他节点：
+// 当前节点是副本时从 Getter 加载并存入 mainCache，否则（作为故障节点的顶替者）按 queryFallback 处理。
+// spill 表示有界负载下副本已满而溢出来的查询，此时当前节点不是副本则从副本读取并存入 hotCache，
+// 副本全部不可用时才按 queryFallback 处理
+func (g *Group) getForPeer(key string, spill bool) (ByteView, error) {
+	g.peersOnce.Do(g.initPeers)
+
+	if key == "" {
+		return ByteView{}, nil
+	}
+	if byteView, cacheHit := g.lookupCache(key); cacheHit {
+		return byteView, nil
+	}
+	btView, err := g.peerLoadGroup.Do(key, func() (interface{}, error) {
+		if value, cacheHit := g.lookupCache(key); cacheHit {
+			return value, nil
+		}
+		gen := g.generation.Load()
+		replicas := g.peers.PickPeers(key)
+		if isReplica(replicas) {
+			return g.queryLocally(key, gen)
+		}
+		if spill {
+			value, err := g.getFromPeers(withoutSpill(replicas), key, gen)
+			if err == nil {
+				return value, nil
+			}
+			log.Printf("溢出的查询从副本获取数据失败，由本节点代为查询：%v", err)
+		}
+		return g.queryFallback(key, gen)
 	})
 	if err == nil {
 		return btView.(ByteView), nil
@@ -156,7 +389,7 @@ func (g *Group) load(key string) (ByteView, error) {
 
 // 从两个缓存中查找
 func (g *Group) lookupCache(key string) (value ByteView, ok bool) {
-	if g.cacheBytes <= 0 {
+	if g.cacheBytes.Load() <= 0 {
 		return
 	}
 	value, ok = g.mainCache.get(key)
@@ -164,105 +397,336 @@ func (g *Group) lookupCache(key string) (value ByteView, ok bool) {
 		return
 	}
 	value, ok = g.hotCache.get(key)
-	return
+	if ok || g.disk == nil {
+		return
+	}
+	return g.promote(key)
+}
+
+// isReplica 判断当前节点是否是 PickPeers 返回的副本之一
+func isReplica(replicas []ProtoGetter) bool {
+	for _, peer := range replicas {
+		if peer == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// isPrimary 判断当前节点是否是 PickPeers 返回的主节点，只有主节点将修改写回数据源
+func isPrimary(replicas []ProtoGetter) bool {
+	return len(replicas) > 0 && replicas[0] == nil
+}
+
+// quorum 将配置的法定数限制在 [1, n] 之间
+func quorum(q, n int) int {
+	if q > n {
+		q = n
+	}
+	if q < 1 {
+		q = 1
+	}
+	return q
+}
+
+// 按优先级依次访问远程副本，某个副本失败时回退到下一个，直到 readQuorum 个副本成功响应。
+// 返回优先级最高的成功副本的值，并加入 hotCache。gen 为加载开始时的 generation
+func (g *Group) getFromPeers(replicas []ProtoGetter, key string, gen uint64) (ByteView, error) {
+	need := quorum(g.readQuorum, len(replicas))
+	if need == 1 && len(replicas) > 1 {
+		if h, ok := replicas[0].(hedger); ok {
+			if delay, ok := h.hedgeDelay(); ok {
+				return g.hedgedGetFromPeers(replicas, key, delay, gen)
+			}
+		}
+	}
+	var (
+		value   ByteView
+		success int
+		lastErr error
+	)
+	for _, peer := range replicas {
+		v, err := g.getFromPeer(peer, key)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if success == 0 {
+			value = v
+		}
+		if success++; success >= need {
+			// TODO 这里把热点数据加入hotCache 的策略有待进一步优化，这里采取每次都加入
+			g.populateLoaded(key, value, &g.hotCache, gen)
+			return value, nil
+		}
+	}
+	return ByteView{}, fmt.Errorf("read quorum not reached (%d/%d): %v", success, need, lastErr)
+}
+
+// hedger 由支持对冲请求的 ProtoGetter 实现，返回发起对冲请求前等待的时间
+type hedger interface {
+	hedgeDelay() (time.Duration, bool)
+}
+
+// hedgedGetFromPeers 先向主副本发起请求，超过 delay 仍未返回，或者返回失败时，再向下一个副本发起请求，
+// 以最先成功返回的结果为准。其余仍在进行的请求在后台完成，结果被丢弃
+func (g *Group) hedgedGetFromPeers(replicas []ProtoGetter, key string, delay time.Duration, gen uint64) (ByteView, error) {
+	type result struct {
+		value ByteView
+		err   error
+	}
+	results := make(chan result, len(replicas)) // 带缓冲，提前返回后剩余的协程不会阻塞
+	launch := func(peer ProtoGetter) {
+		go func() {
+			v, err := g.getFromPeer(peer, key)
+			results <- result{v, err}
+		}()
+	}
+
+	launch(replicas[0])
+	next, pending := 1, 1
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var lastErr error
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				g.populateLoaded(key, r.value, &g.hotCache, gen)
+				return r.value, nil
+			}
+			lastErr = r.err
+			if !timer.Stop() { // 丢弃已经触发但尚未读取的计时，以便重新计时
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		case <-timer.C:
+			log.Printf("请求超过 %v 未返回，发起对冲请求", delay)
+		}
+		// 超时或失败，向下一个副本发起请求
+		if next < len(replicas) {
+			launch(replicas[next])
+			next++
+			pending++
+			timer.Reset(delay)
+		}
+	}
+	return ByteView{}, fmt.Errorf("all %d replicas failed: %v", len(replicas), lastErr)
 }
 
 // 访问远程节点，获取缓存值
 func (g *Group) getFromPeer(peer ProtoGetter, key string) (ByteView, error) {
-	request := &pb.Request{
-		Group: g.name,
-		Key:   key,
-	}
-	response := &pb.Response{}
+	request, response := getRequest(g.name, key), getResponse()
+	defer putRequest(request)
+	defer putResponse(response)
 	if err := peer.Get(request, response); err != nil {
 		return ByteView{}, err
 	}
-	value := ByteView{b: response.Value}
+	return ByteView{b: response.Value, v: response.Version, t: response.Tags, z: response.Compressed}, nil
+}
 
-	// TODO 这里把热点数据加入hotCache 的策略有待进一步优化，这里采取每次都加入
-	g.populateCache(key, value, &g.hotCache)
+// 调用回调函数 g.getter.Get() 从其他地方获取源数据，
+// 并将源数据添加到缓存 mainCache 中（通过 populateLoaded 方法）
+func (g *Group) queryLocally(key string, gen uint64) (ByteView, error) {
+	value, err := g.fromGetter(key)
+	if err != nil {
+		return ByteView{}, err
+	}
+	value.v = g.nextVersion()                       // e 为零值，默认不过期
+	g.populateLoaded(key, value, &g.mainCache, gen) // 将获取到的源数据添加到缓存 mainCache 中
 	return value, nil
 }
 
-// 调用回调函数 g.getter.Get() 从其他地方获取源数据，
-// 并将源数据添加到缓存 mainCache 中（通过 populateCache 方法）
-func (g *Group) queryLocally(key string) (ByteView, error) {
-	b, err := g.getter.Get(key)
+// queryFallback 在当前节点不是 key 的所有者时代为调用 Getter 查询，
+// 结果只以 fallbackTTL 为过期时间存入 hotCache，fallbackTTL 为 0 时不缓存
+func (g *Group) queryFallback(key string, gen uint64) (ByteView, error) {
+	value, err := g.fromGetter(key)
 	if err != nil {
 		return ByteView{}, err
 	}
-	value := ByteView{bytes.Clone(b), time.Time{}} // 空结构体表示零值，默认不过期
-	g.populateCache(key, value, &g.mainCache)      // 将获取到的源数据添加到缓存 mainCache 中
+	if g.fallbackTTL <= 0 {
+		return value, nil
+	}
+	value.e = time.Now().Add(g.fallbackTTL)
+	g.populateLoaded(key, value, &g.hotCache, gen)
 	return value, nil
 }
 
+// fromGetter 调用 Getter 查询源数据，Getter 实现了 TaggedGetter 时同时返回标签。
+// 未开启 TransferOwnership 时，Getter 返回的切片可能被其继续使用，因此保存其拷贝
+func (g *Group) fromGetter(key string) (ByteView, error) {
+	if sg, ok := g.getter.(StringGetter); ok {
+		s, err := sg.GetString(key)
+		return ByteView{s: s}, err
+	}
+	var (
+		b    []byte
+		tags []string
+		err  error
+	)
+	if tg, ok := g.getter.(TaggedGetter); ok {
+		b, tags, err = tg.GetTagged(key)
+	} else {
+		b, err = g.getter.Get(key)
+	}
+	if err != nil {
+		return ByteView{}, err
+	}
+	if !g.ownsGetterValues {
+		b = bytes.Clone(b)
+	}
+	return ByteView{b: b, t: tags}, nil
+}
+
 // 根据传入的 cache 参数确定是 hotCache 还是 mainCache，将 key value 存入 cache 中。
 func (g *Group) populateCache(key string, value ByteView, cache *cache) {
-	if g.cacheBytes <= 0 {
+	if g.cacheBytes.Load() <= 0 {
 		return
 	}
+	if cache == &g.mainCache {
+		if value.v == 0 { // 没有版本号的来源，例如第一版的快照
+			value.v = g.nextVersion()
+		} else {
+			g.observeVersion(value.v) // 来自其他节点的版本号，例如副本写入与交接
+		}
+	}
+	value = g.compress(value)
 	cache.add(key, value)
+	g.evict()
+}
+
+// evict 淘汰条目直至不超过 cacheBytes 与 maxEntries，调用方持有 loadGroup.Lock
+func (g *Group) evict() {
+	limit := g.cacheBytes.Load()
 	for {
 		mainBytes, hotBytes := g.mainCache.bytes(), g.hotCache.bytes()
-		if mainBytes+hotBytes <= g.cacheBytes {
+		mainLen, hotLen := g.mainCache.len(), g.hotCache.len()
+		overBytes := mainBytes+hotBytes > limit
+		if !overBytes && (g.maxEntries <= 0 || mainLen+hotLen <= g.maxEntries) {
 			return
 		}
-		if hotBytes > mainBytes/8 {
+		// hotCache 至多占 mainCache 的 1/8，按超出的限制比较
+		if overBytes && hotBytes > mainBytes/8 || !overBytes && hotLen > mainLen/8 {
 			(&g.hotCache).removeOldest()
-		} else {
-			(&g.mainCache).removeOldest()
+		} else if key, value, ok := (&g.mainCache).removeOldest(); ok {
+			if g.disk != nil {
+				g.demote(key, value) // mainCache 中淘汰的条目降级到磁盘，由后台协程在锁外写入
+			}
+		} else if _, _, ok := (&g.hotCache).removeOldest(); !ok {
+			return // 两个缓存都已为空
 		}
 	}
 }
 
-// Set 向对应节点的缓存中加入 key value
-func (g *Group) Set(key string, value []byte, expire time.Time, isHotCache bool) error {
+// populateIfAbsent key 不在 cache 中时写入，返回是否写入。用于交接、预热与恢复快照，已存在的值可能更新，不会被覆盖
+func (g *Group) populateIfAbsent(key string, value ByteView, cache *cache) (ok bool) {
+	if g.cacheBytes.Load() <= 0 {
+		return false
+	}
+	value = g.compress(value)
+	g.loadGroup.Lock(func() {
+		if _, exist := cache.peek(key); exist {
+			return
+		}
+		g.populateCache(key, value, cache)
+		ok = true
+	})
+	return ok
+}
+
+// Set 向对应节点的缓存中加入 key value，tags 为 key 的标签，可以通过 RemoveByTag 批量移除
+func (g *Group) Set(key string, value []byte, expire time.Time, isHotCache bool, tags ...string) error {
 	g.peersOnce.Do(g.initPeers)
 	if key == "" {
 		return errors.New("empty Set() key not allowed")
 	}
 
 	_, err := g.setGroup.Do(key, func() (interface{}, error) {
-		// if remote peer owns this key
-		if peer, ok := g.peers.PickPeer(key); ok {
-			if err := g.setFromPeer(peer, key, value, expire); err != nil {
-				return nil, err
+		replicas := g.peers.PickPeers(key)
+		primary := isPrimary(replicas)
+		// 全部副本使用同一个版本号，值只压缩一次，以压缩后的形式发送给其他副本
+		view := g.compress(ByteView{b: value, e: expire, v: g.nextVersion(), t: tags})
+		// 主节点负责写回数据源。开启写穿透时必须等到主节点确认，即使其他副本已经凑满 WriteQuorum，
+		// 否则数据源可能没有写入；主节点是当前节点时，写回失败同样返回错误
+		primaryErr := make(chan error, 1)
+		err := g.writeReplicas(replicas, func(peer ProtoGetter) error {
+			var err error
+			if peer == nil { // we own this key
+				err = g.ownerSet(primary, key, view)
+			} else {
+				err = g.setFromPeer(peer, key, view)
 			}
-			if isHotCache {
-				g.localSet(key, value, expire, &g.hotCache)
+			if peer == replicas[0] {
+				primaryErr <- err
 			}
-			return nil, nil
+			return err
+		})
+		if err != nil {
+			return nil, err
 		}
-		// else we own this key
-		g.localSet(key, value, expire, &g.mainCache)
+		if primary || g.writer.writesThrough(false) {
+			if err := <-primaryErr; err != nil {
+				return nil, fmt.Errorf("primary write failed: %w", err)
+			}
+		}
+		if isHotCache && !isReplica(replicas) {
+			g.localSet(key, view, &g.hotCache)
+		}
+		g.invalidate(key)
 		return nil, nil
 	})
 	return err
 }
 
-func (g *Group) setFromPeer(peer ProtoGetter, key string, value []byte, expire time.Time) error {
-	var e int64
-	if !expire.IsZero() {
-		e = expire.UnixNano()
+// writeReplicas 并发地对每个副本执行 write（当前节点对应 nil），得到 writeQuorum 个确认后即返回，
+// 剩余副本的写入在后台继续完成。确认数不足时返回最后一个错误
+func (g *Group) writeReplicas(replicas []ProtoGetter, write func(peer ProtoGetter) error) error {
+	need := quorum(g.writeQuorum, len(replicas))
+	errs := make(chan error, len(replicas)) // 带缓冲，提前返回后剩余的协程不会阻塞
+	for _, peer := range replicas {
+		go func(peer ProtoGetter) {
+			errs <- write(peer)
+		}(peer)
 	}
 
-	req := &pb.SetRequest{
-		Group:  g.name,
-		Key:    key,
-		Value:  value,
-		Expire: e,
+	var (
+		acks    int
+		lastErr error
+	)
+	for range replicas {
+		if err := <-errs; err != nil {
+			lastErr = err
+			continue
+		}
+		if acks++; acks >= need {
+			return nil
+		}
 	}
+	return fmt.Errorf("write quorum not reached (%d/%d): %v", acks, need, lastErr)
+}
+
+func (g *Group) setFromPeer(peer ProtoGetter, key string, value ByteView) error {
+	req := getSetRequest()
+	defer putSetRequest(req)
+	req.Group = g.name
+	req.Key = key
+	req.Value = value.encoded()
+	req.Expire = toUnixNano(value.e)
+	req.Version = value.v
+	req.Tags = value.t
+	req.Compressed = value.z
 	return peer.Set(req)
 }
 
-func (g *Group) localSet(key string, value []byte, expire time.Time, cache *cache) {
-	if g.cacheBytes <= 0 {
+func (g *Group) localSet(key string, value ByteView, cache *cache) {
+	if g.cacheBytes.Load() <= 0 {
 		return
 	}
-	btv := ByteView{
-		b: value,
-		e: expire,
-	}
+	btv := g.compress(value) // 在锁外压缩
 	// 在g.loadGroup.Do() 执行期间，会进行缓存的增/改；在执行 localRemove 操作时也会进行缓存的删除，
 	// 加上这里的增加缓存操作，这三者之间不能与之并发进行，只有能获取到锁的一方才能执行，其他等待。
 	g.loadGroup.Lock(func() {
@@ -270,6 +734,32 @@ func (g *Group) localSet(key string, value []byte, expire time.Time, cache *cach
 	})
 }
 
+// ownerSet 在 key 的副本节点上写入 mainCache，主节点同时写回数据源
+func (g *Group) ownerSet(primary bool, key string, value ByteView) error {
+	if !primary {
+		g.localSet(key, value, &g.mainCache)
+		return nil
+	}
+	b, err := value.raw() // 数据源保存解压后的值
+	if err != nil {
+		return err
+	}
+	return g.writeOrigin(WriteOp{Key: key, Value: b, Expire: value.e}, func() {
+		g.localSet(key, value, &g.mainCache)
+	})
+}
+
+// ownerRemove 在 key 的副本节点上移除缓存，主节点同时从数据源删除
+func (g *Group) ownerRemove(primary bool, key string) error {
+	if !primary {
+		g.localRemove(key)
+		return nil
+	}
+	return g.writeOrigin(WriteOp{Key: key, Delete: true}, func() {
+		g.localRemove(key)
+	})
+}
+
 // Remove 向对应节点的缓存中移除 key value
 func (g *Group) Remove(key string) error {
 	g.peersOnce.Do(g.initPeers)
@@ -278,55 +768,59 @@ func (g *Group) Remove(key string) error {
 	}
 
 	_, err := g.removeGroup.Do(key, func() (interface{}, error) {
-		// Remove from key owner first
-		owner, ok := g.peers.PickPeer(key)
-		if ok {
-			if err := g.removeFromPeer(key, owner); err != nil {
-				return nil, err
+		// Remove from key owners first
+		replicas := g.peers.PickPeers(key)
+		primary := isPrimary(replicas)
+		results := removeFromPeers(replicas, true, func(peer ProtoGetter) error {
+			if peer == nil {
+				return g.ownerRemove(primary, key)
 			}
+			return g.removeFromPeer(key, peer)
+		})
+		if !g.ownersRemoved(results) {
+			g.removeRetry.add(removeTarget{key: key}, results)
+			return nil, &RemoveError{Key: key, Policy: g.removePolicy, Results: results}
 		}
 		// Remove from our cache next
-		g.localRemove(key)
+		// 当前节点是副本时已在上一步移除，再次移除可能删掉此后写入的新值
+		if !isReplica(replicas) {
+			g.localRemove(key)
+		}
+		g.invalidate(key)
 
-		// 异步清除其他节点中所有的 hot and main caches
-		wg := sync.WaitGroup{}
-		errs := make(chan error)
+		owners := make(map[ProtoGetter]bool, len(replicas))
+		for _, peer := range replicas {
+			owners[peer] = true
+		}
+		var others []ProtoGetter
 		for _, peer := range g.peers.GetAll() {
-			if peer == owner {
-				continue
+			if !owners[peer] {
+				others = append(others, peer)
 			}
-			wg.Add(1)
-			go func(peer ProtoGetter) {
-				errs <- g.removeFromPeer(key, peer)
-				wg.Done()
-			}(peer)
 		}
-		go func() {
-			wg.Wait()
-			close(errs)
-		}()
-		// TODO(thrawn01): Should we report all errors? Reporting context
-		//  cancelled error for each peer doesn't make much sense.
-		var err error
-		for e := range errs {
-			err = e
+
+		// 并发清除其他节点中所有的 hot and main caches，失败的节点在后台重试
+		results = append(results, removeFromPeers(others, false, func(peer ProtoGetter) error {
+			return g.removeFromPeer(key, peer)
+		})...)
+		g.removeRetry.add(removeTarget{key: key}, results)
+		if !g.removeSucceeded(results) {
+			return nil, &RemoveError{Key: key, Policy: g.removePolicy, Results: results}
 		}
-		return nil, err
+		return nil, nil
 	})
 	return err
 }
 
 func (g *Group) removeFromPeer(key string, peer ProtoGetter) error {
-	req := &pb.Request{
-		Group: g.name,
-		Key:   key,
-	}
+	req := getRequest(g.name, key)
+	defer putRequest(req)
 	return peer.Remove(req)
 }
 
 func (g *Group) localRemove(key string) {
 	// Clear key from our local cache
-	if g.cacheBytes <= 0 {
+	if g.cacheBytes.Load() <= 0 {
 		return
 	}
 
@@ -335,5 +829,9 @@ func (g *Group) localRemove(key string) {
 	g.loadGroup.Lock(func() {
 		g.hotCache.remove(key)
 		g.mainCache.remove(key)
+		if g.disk != nil {
+			g.cancelDemotions(func(k string, _ ByteView) bool { return k == key })
+			g.disk.Delete(key)
+		}
 	})
 }
@@ -1,9 +1,17 @@
 package geecache
 
 import (
+	"errors"
 	"fmt"
+	"geecache/compress"
+	pb "geecache/geecachepb"
 	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 var db = map[string]string{
@@ -37,3 +45,389 @@ func TestGet(t *testing.T) {
 		}
 	}
 }
+
+// fakePeer 是保存在内存中的远程节点，实现 ProtoGetter 接口；down 为 true 时模拟节点宕机
+type fakePeer struct {
+	mu       sync.Mutex
+	data     map[string][]byte
+	versions map[string]uint64
+	tags     map[string][]string
+	down     bool
+	gets     int
+}
+
+func newFakePeer(down bool) *fakePeer {
+	return &fakePeer{data: make(map[string][]byte), versions: make(map[string]uint64), tags: make(map[string][]string), down: down}
+}
+
+func (p *fakePeer) Get(in *pb.Request, out *pb.Response) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.gets++
+	if p.down {
+		return errors.New("peer down")
+	}
+	v, ok := p.data[in.GetKey()]
+	if !ok {
+		return fmt.Errorf("%s not exist", in.GetKey())
+	}
+	out.Value = v
+	out.Version = p.versions[in.GetKey()]
+	out.Tags = p.tags[in.GetKey()]
+	return nil
+}
+
+func (p *fakePeer) Set(in *pb.SetRequest) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.down {
+		return errors.New("peer down")
+	}
+	value := in.GetValue()
+	if in.GetCompressed() { // 保存解压后的值，便于测试检查
+		var err error
+		if value, err = compress.Decode(value); err != nil {
+			return err
+		}
+	}
+	p.data[in.GetKey()] = value
+	p.versions[in.GetKey()] = in.GetVersion()
+	p.tags[in.GetKey()] = in.GetTags()
+	return nil
+}
+
+func (p *fakePeer) CompareAndSet(in *pb.CompareAndSetRequest, out *pb.CompareAndSetResponse) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.down {
+		return errors.New("peer down")
+	}
+	if p.versions[in.GetKey()] != in.GetExpectedVersion() {
+		return ErrVersionConflict
+	}
+	p.data[in.GetKey()] = in.GetValue()
+	p.versions[in.GetKey()]++
+	out.Version = p.versions[in.GetKey()]
+	return nil
+}
+
+func (p *fakePeer) Incr(in *pb.IncrRequest, out *pb.IncrResponse) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.down {
+		return errors.New("peer down")
+	}
+	n, err := parseCounter(p.data[in.GetKey()])
+	if err != nil {
+		return err
+	}
+	n += in.GetDelta()
+	p.data[in.GetKey()] = []byte(strconv.FormatInt(n, 10))
+	out.Value = n
+	return nil
+}
+
+func (p *fakePeer) Remove(in *pb.Request) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.down {
+		return errors.New("peer down")
+	}
+	delete(p.data, in.GetKey())
+	return nil
+}
+
+func (p *fakePeer) RemoveMatching(in *pb.RemoveMatchingRequest, out *pb.RemoveMatchingResponse) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.down {
+		return errors.New("peer down")
+	}
+	for key := range p.data {
+		tagged := false
+		for _, tag := range p.tags[key] {
+			tagged = tagged || tag == in.GetTag()
+		}
+		if in.GetPrefix() != "" && strings.HasPrefix(key, in.GetPrefix()) || tagged {
+			delete(p.data, key)
+			out.Removed++
+		}
+	}
+	return nil
+}
+
+func (p *fakePeer) Purge(in *pb.PurgeRequest) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.down {
+		return errors.New("peer down")
+	}
+	p.data = make(map[string][]byte)
+	return nil
+}
+
+// fakePicker 对任意 key 都返回固定的副本列表
+type fakePicker struct {
+	replicas []ProtoGetter
+	all      []ProtoGetter
+}
+
+func (f *fakePicker) PickPeer(string) (ProtoGetter, bool) {
+	return f.replicas[0], f.replicas[0] != nil
+}
+func (f *fakePicker) PickPeers(string) []ProtoGetter { return f.replicas }
+func (f *fakePicker) GetAll() []ProtoGetter          { return f.all }
+
+func TestReplicaRead(t *testing.T) {
+	p1, p2, p3 := newFakePeer(true), newFakePeer(false), newFakePeer(false)
+	p2.data["Tom"] = []byte("from p2")
+	p3.data["Tom"] = []byte("from p3")
+
+	var loads int
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte(db[key]), nil
+	})
+
+	// 主节点 p1 宕机，回退到 p2
+	gp := NewGroup("replica-read", 2<<10, getter)
+	gp.peers = &fakePicker{replicas: []ProtoGetter{p1, p2, p3}}
+	if view, err := gp.Query("Tom"); err != nil || view.String() != "from p2" {
+		t.Fatalf("Query = %q, %v; want value from p2", view, err)
+	}
+	if loads != 0 || p3.gets != 0 {
+		t.Fatalf("should not load locally or ask p3 when p2 answers")
+	}
+
+	// 读法定数为 2，需要 p2 和 p3 都成功，以优先级更高的 p2 为准
+	gp = NewGroupOpts("replica-read-quorum", 2<<10, getter, &GroupOptions{ReadQuorum: 2})
+	gp.peers = &fakePicker{replicas: []ProtoGetter{p1, p2, p3}}
+	if view, err := gp.Query("Tom"); err != nil || view.String() != "from p2" {
+		t.Fatalf("Query = %q, %v; want value from p2", view, err)
+	}
+	if p3.gets != 1 {
+		t.Fatalf("p3 should be asked once to reach read quorum, got %d", p3.gets)
+	}
+}
+
+func TestReplicaWrite(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%s not exist", key)
+	})
+	p1, p2 := newFakePeer(false), newFakePeer(true)
+
+	// 当前节点与 p1 成功，满足写法定数 2
+	gp := NewGroupOpts("replica-write", 2<<10, getter, &GroupOptions{WriteQuorum: 2})
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil, p1, p2}, all: []ProtoGetter{p1, p2}}
+	if err := gp.Set("Tom", []byte("630"), time.Time{}, false); err != nil {
+		t.Fatalf("Set should reach write quorum: %v", err)
+	}
+	if view, ok := gp.mainCache.get("Tom"); !ok || view.String() != "630" {
+		t.Fatalf("local replica not written")
+	}
+	p1.mu.Lock()
+	if string(p1.data["Tom"]) != "630" {
+		t.Fatalf("remote replica not written")
+	}
+	p1.mu.Unlock()
+
+	// p2 宕机，无法满足写法定数 3
+	gp = NewGroupOpts("replica-write-all", 2<<10, getter, &GroupOptions{WriteQuorum: 3})
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil, p1, p2}, all: []ProtoGetter{p1, p2}}
+	if err := gp.Set("Tom", []byte("630"), time.Time{}, false); err == nil {
+		t.Fatalf("Set should fail when write quorum is not reached")
+	}
+}
+
+func TestFailover(t *testing.T) {
+	var loads int
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte(db[key]), nil
+	})
+	down := newFakePeer(true)
+
+	// 副本全部不可用，本节点代为查询，但不缓存
+	gp := NewGroup("failover-nocache", 2<<10, getter)
+	gp.peers = &fakePicker{replicas: []ProtoGetter{down}}
+	if view, err := gp.Query("Tom"); err != nil || view.String() != db["Tom"] {
+		t.Fatalf("Query = %q, %v; want fallback value", view, err)
+	}
+	if _, ok := gp.mainCache.get("Tom"); ok {
+		t.Fatalf("fallback value must not be stored in mainCache")
+	}
+	if _, ok := gp.hotCache.get("Tom"); ok {
+		t.Fatalf("fallback value must not be cached when FallbackTTL is 0")
+	}
+
+	// 设置了 FallbackTTL，结果只存入 hotCache 并带有过期时间
+	gp = NewGroupOpts("failover-hot", 2<<10, getter, &GroupOptions{FallbackTTL: time.Minute})
+	gp.peers = &fakePicker{replicas: []ProtoGetter{down}}
+	if _, err := gp.Query("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := gp.mainCache.get("Tom"); ok {
+		t.Fatalf("fallback value must not be stored in mainCache")
+	}
+	if view, ok := gp.hotCache.get("Tom"); !ok || view.e.IsZero() {
+		t.Fatalf("fallback value should be stored in hotCache with a TTL")
+	}
+}
+
+// 其他节点转发来的查询不会被再次转发
+func TestGetForPeer(t *testing.T) {
+	var loads int
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte(db[key]), nil
+	})
+	owner := newFakePeer(false)
+	owner.data["Tom"] = []byte("from owner")
+
+	gp := NewGroup("get-for-peer", 2<<10, getter)
+	gp.peers = &fakePicker{replicas: []ProtoGetter{owner}}
+	if view, err := gp.getForPeer("Tom", false); err != nil || view.String() != db["Tom"] {
+		t.Fatalf("getForPeer = %q, %v; want value from getter", view, err)
+	}
+	if owner.gets != 0 || loads != 1 {
+		t.Fatalf("getForPeer should load locally, peer gets = %d, loads = %d", owner.gets, loads)
+	}
+}
+
+func TestDiskTier(t *testing.T) {
+	loads := make(map[string]int)
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		loads[key]++
+		return []byte(strings.Repeat("v", 40)), nil
+	})
+	// 内存只能容纳 2 个条目
+	gp := NewGroupOpts("disk-tier", 2<<10, getter, &GroupOptions{MaxEntries: 2, DiskDir: t.TempDir(), DiskBytes: 1 << 20})
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil}}
+
+	for _, key := range []string{"k1", "k2", "k3", "k4"} {
+		if _, err := gp.Query(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := gp.mainCache.peek("k1"); ok {
+		t.Fatalf("k1 should be evicted from mainCache")
+	}
+	gp.flushDemoted()
+	if gp.disk.Len() != 2 {
+		t.Fatalf("evicted entries should be demoted to disk, got %d", gp.disk.Len())
+	}
+
+	// 内存未命中时从磁盘读取并移回 mainCache，不再调用 Getter
+	if view, err := gp.Query("k1"); err != nil || view.Len() != 40 || loads["k1"] != 1 {
+		t.Fatalf("Query k1 = %q, %v; loaded %d times, want a disk hit", view, err, loads["k1"])
+	}
+	if _, ok := gp.mainCache.peek("k1"); !ok {
+		t.Errorf("k1 should be promoted back to mainCache")
+	}
+	if _, _, ok := gp.disk.Get("k1"); ok {
+		t.Errorf("promoted k1 should be removed from disk")
+	}
+
+	// 删除 key 时同时删除磁盘中的条目
+	gp.localRemove("k2")
+	if _, _, ok := gp.disk.Get("k2"); ok {
+		t.Errorf("removed k2 should not stay on disk")
+	}
+	if gp.Query("k2"); loads["k2"] != 2 {
+		t.Errorf("removed k2 should be loaded from the Getter again")
+	}
+}
+
+// 淘汰的条目在后台写入磁盘：写入前可以直接移回 mainCache，写入前后被移除的条目都不会留在磁盘上
+func TestDiskTierPending(t *testing.T) {
+	loads := make(map[string]int)
+	var mu sync.Mutex
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		loads[key]++
+		return []byte("db-" + key), nil
+	})
+	gp := NewGroupOpts("disk-tier-pending", 2<<10, getter, &GroupOptions{MaxEntries: 1, DiskDir: t.TempDir(), DiskBytes: 1 << 20})
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil}}
+
+	gp.localSet("k1", ByteView{b: []byte("v1")}, &gp.mainCache)
+	gp.localSet("k2", ByteView{b: []byte("v2")}, &gp.mainCache) // k1 被淘汰，可能尚未写入磁盘
+	if view, err := gp.Query("k1"); err != nil || view.String() != "v1" || loads["k1"] != 0 {
+		t.Fatalf("Query k1 = %q, %v; loaded %d times, want the demoted value", view, err, loads["k1"])
+	}
+
+	gp.localSet("k3", ByteView{b: []byte("v3")}, &gp.mainCache) // k1 再次被淘汰
+	gp.localRemove("k1")
+	gp.flushDemoted()
+	if _, _, ok := gp.disk.Get("k1"); ok {
+		t.Fatalf("removed k1 should not be written to disk")
+	}
+	if view, _ := gp.Query("k1"); view.String() != "db-k1" || loads["k1"] != 1 {
+		t.Fatalf("removed k1 = %q, should be loaded from the Getter", view)
+	}
+
+	// 并发的加载、写入与移除在 -race 下检查锁的使用
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				key := "c" + strconv.Itoa(j%5)
+				switch (i + j) % 3 {
+				case 0:
+					gp.Query(key)
+				case 1:
+					gp.localSet(key, ByteView{b: []byte("v")}, &gp.mainCache)
+				default:
+					gp.localRemove(key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// Close 关闭并删除磁盘缓存的段文件，将 Group 从 groups 中移除
+func TestGroupClose(t *testing.T) {
+	dir := t.TempDir()
+	gp := NewGroupOpts("group-close", 2<<10, GetterFunc(notFound), &GroupOptions{MaxEntries: 1, DiskDir: dir, DiskBytes: 1 << 20})
+	gp.localSet("k1", ByteView{b: []byte("v1")}, &gp.mainCache)
+	gp.localSet("k2", ByteView{b: []byte("v2")}, &gp.mainCache)
+	gp.flushDemoted()
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.seg")); len(files) == 0 {
+		t.Fatalf("demoted entry should be written to a segment file")
+	}
+
+	if err := gp.Close(); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.seg")); len(files) != 0 {
+		t.Fatalf("segment files left after Close: %v", files)
+	}
+	if GetGroup("group-close") != nil {
+		t.Fatalf("closed group should be unregistered")
+	}
+	if err := gp.Close(); err != nil {
+		t.Fatalf("second Close error: %v", err)
+	}
+	NewGroup("group-close", 2<<10, GetterFunc(notFound)).Close() // 可以用相同的名称重新创建
+}
+
+func TestTransferOwnership(t *testing.T) {
+	for _, owned := range []bool{false, true} {
+		buf := []byte("630")
+		gp := NewGroupOpts(fmt.Sprintf("ownership-%v", owned), 2<<10, GetterFunc(func(key string) ([]byte, error) {
+			return buf, nil
+		}), &GroupOptions{TransferOwnership: owned})
+		gp.peers = &fakePicker{replicas: []ProtoGetter{nil}}
+		view, err := gp.Query("Tom")
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		if shared := &view.b[0] == &buf[0]; shared != owned {
+			t.Fatalf("TransferOwnership %v: cached value shares the Getter's slice = %v", owned, shared)
+		}
+	}
+}
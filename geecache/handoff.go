@@ -0,0 +1,213 @@
+package geecache
+
+import (
+	"geecache/consistenthash"
+	pb "geecache/geecachepb"
+	"io"
+	"sync"
+	"time"
+)
+
+/*
+	key 交接（handoff）：哈希环变化后，key 的所有者可能发生变化，旧所有者 mainCache 中的数据将不再被访问，
+	而新所有者从空缓存开始，大量请求会直接打到数据库。开启交接后，每个节点在 SetPeers 时：
+	1. 找出 mainCache 中自己不再负责的 key；
+	2. 通过 Handoff 流式 RPC 按新的哈希环把它们交给新的所有者（限速发送）；
+	3. 交接成功的 key 从本地 mainCache 中移除。
+	WarmBeforeSwitch 模式下先完成交接再切换哈希环，切换期间请求仍由旧所有者处理，新所有者切换后即是热的；
+	否则先切换哈希环，再在后台交接。
+*/
+
+// HandoffOptions 哈希环变化时的 key 交接配置
+type HandoffOptions struct {
+	// Enabled 是否在 SetPeers 改变哈希环时交接 key，默认不交接
+	Enabled bool
+
+	// Rate 每秒最多发送的条目数（所有目标节点合计），为 0 时不限速
+	Rate int
+
+	// WarmBeforeSwitch 为 true 时 SetPeers 先把 key 交给新的所有者，再切换哈希环，
+	// 交接完成前 SetPeers 不返回；自定义的 Placement 无法预先计算新的放置结果，此时退化为先切换再交接
+	WarmBeforeSwitch bool
+}
+
+// handoffKey 一个已交接的 key，切换哈希环后从本地 mainCache 中移除
+type handoffKey struct {
+	group *Group
+	key   string
+}
+
+// updatePeers 更新哈希环，并按照 HandoffOptions 交接不再属于当前节点的 key
+func (s *Server) updatePeers(peers map[string]int) {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+	if !s.handoffOpts.Enabled {
+		s.applyPeers(peers)
+		return
+	}
+
+	if s.handoffOpts.WarmBeforeSwitch {
+		s.mu.Lock()
+		next, ok := consistenthash.ClonePlacement(s.peers)
+		if ok {
+			for peer := range peers { // 交接需要新节点的客户端，哈希环切换前它们不会被 PickPeers 选中
+				if _, exist := s.clients[peer]; !exist {
+					s.clients[peer] = s.newPeerClient(peer)
+				}
+			}
+		}
+		s.mu.Unlock()
+
+		if ok {
+			if added, removed := next.SetNodes(peers); len(added) == 0 && len(removed) == 0 {
+				return
+			}
+			moved := s.handoff(func(key string) []string {
+				return next.FindNodes(key, s.replication)
+			})
+			s.applyPeers(peers)
+			s.dropMoved(moved)
+			return
+		}
+		s.Log("placement %T cannot be cloned, hand off keys after switching", s.peers)
+	}
+
+	if added, removed := s.applyPeers(peers); len(added) == 0 && len(removed) == 0 {
+		return
+	}
+	go func() {
+		s.updateMu.Lock() // 与其他哈希环更新及交接串行，避免重复交接同一个 key
+		defer s.updateMu.Unlock()
+		s.dropMoved(s.handoff(s.owners))
+	}()
+}
+
+// owners 按当前的哈希环返回 key 的副本节点
+func (s *Server) owners(key string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.peers.FindNodes(key, s.replication)
+}
+
+// handoff 把 mainCache 中不再由当前节点负责的 key 交给 owners 返回的新所有者，返回全部新所有者都已接收的 key
+func (s *Server) handoff(owners func(key string) []string) []handoffKey {
+	entries := make(map[string][]*pb.SetRequest) // 目标节点 -> 待发送的条目
+	keys := make(map[string][]handoffKey)        // 目标节点 -> 与 entries 一一对应的 key
+	targets := make(map[handoffKey]int)          // key -> 目标节点数
+
+	mu.RLock()
+	gs := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		gs = append(gs, g)
+	}
+	mu.RUnlock()
+
+	for _, g := range gs {
+		for _, key := range g.mainCache.keys() { // 热点 key 排在前面，优先交接
+			nodes := owners(key)
+			if len(nodes) == 0 || contains(nodes, s.addr) {
+				continue
+			}
+			view, ok := g.mainCache.peek(key)
+			if !ok {
+				continue
+			}
+			hk := handoffKey{g, key}
+			for _, node := range nodes {
+				entries[node] = append(entries[node], &pb.SetRequest{Group: g.name, Key: key, Value: view.encoded(), Expire: toUnixNano(view.e), Version: view.v, Tags: view.t, Compressed: view.z})
+				keys[node] = append(keys[node], hk)
+			}
+			targets[hk] = len(nodes)
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	wait := func() {}
+	if s.handoffOpts.Rate > 0 {
+		limiter := time.NewTicker(time.Second / time.Duration(s.handoffOpts.Rate))
+		defer limiter.Stop()
+		wait = func() { <-limiter.C }
+	}
+
+	var (
+		wg    sync.WaitGroup
+		resMu sync.Mutex
+		acked = make(map[handoffKey]int)
+	)
+	for node := range entries {
+		s.mu.Lock()
+		c := s.clients[node]
+		s.mu.Unlock()
+		if c == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(node string, c *client) {
+			defer wg.Done()
+			accepted, err := c.handoff(entries[node], wait)
+			if err != nil {
+				s.Log("hand off %d keys to %s failed: %v", len(entries[node]), node, err)
+				return
+			}
+			s.Log("handed off %d keys to %s, %d accepted", len(entries[node]), node, accepted)
+			resMu.Lock()
+			for _, hk := range keys[node] {
+				acked[hk]++
+			}
+			resMu.Unlock()
+		}(node, c)
+	}
+	wg.Wait()
+
+	moved := make([]handoffKey, 0, len(acked))
+	for hk, n := range acked {
+		if n == targets[hk] {
+			moved = append(moved, hk)
+		}
+	}
+	return moved
+}
+
+// dropMoved 从 mainCache 中移除已交接的 key。哈希环可能再次变化，仍由当前节点负责的 key 会被保留
+func (s *Server) dropMoved(moved []handoffKey) {
+	for _, hk := range moved {
+		if contains(s.owners(hk.key), s.addr) {
+			continue
+		}
+		hk.group.loadGroup.Lock(func() {
+			hk.group.mainCache.remove(hk.key)
+		})
+	}
+}
+
+// Handoff 接收其他节点交接过来的 key，写入 mainCache。已存在的 key 可能是更新的值，不会被覆盖
+func (s *Server) Handoff(stream pb.GroupCache_HandoffServer) error {
+	var accepted int64
+	for {
+		in, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&pb.HandoffResponse{Accepted: accepted})
+		}
+		if err != nil {
+			return err
+		}
+		group := GetGroup(in.GetGroup())
+		if group == nil {
+			continue // 当前节点没有这个 group，忽略
+		}
+		if group.populateIfAbsent(in.Key, ByteView{b: in.Value, e: fromUnixNano(in.Expire), v: in.Version, t: in.Tags, z: in.Compressed}, &group.mainCache) {
+			accepted++
+		}
+	}
+}
+
+func contains(nodes []string, node string) bool {
+	for _, n := range nodes {
+		if n == node {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,192 @@
+package geecache
+
+import (
+	"geecache/breaker"
+	pb "geecache/geecachepb"
+	"google.golang.org/grpc"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newHandoffGroup 返回 mainCache 中预先存有 n 个 key 的 Group
+func newHandoffGroup(name string, n int, expire time.Time) *Group {
+	g := NewGroup(name, 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("db-" + key), nil
+	}))
+	for i := 0; i < n; i++ {
+		key := "key" + strconv.Itoa(i)
+		g.localSet(key, ByteView{b: []byte("v-" + key), e: expire}, &g.mainCache)
+	}
+	return g
+}
+
+// movedKeys 返回在新哈希环上属于 peer 的 key
+func movedKeys(s *Server, n int, peer string) map[string]bool {
+	keys := make(map[string]bool)
+	for i := 0; i < n; i++ {
+		key := "key" + strconv.Itoa(i)
+		if s.owners(key)[0] == peer {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
+func TestHandoffWarmBeforeSwitch(t *testing.T) {
+	const n, rate = 60, 1000
+	expire := time.Now().Add(time.Hour)
+	g := newHandoffGroup("handoff-warm", n, expire)
+	s := newServer("127.0.0.1:8001", &ServerOptions{
+		Handoff: HandoffOptions{Enabled: true, WarmBeforeSwitch: true, Rate: rate},
+	})
+	s.SetPeers("127.0.0.1:8001")
+	g.peers = s
+
+	peer := "127.0.0.1:8002"
+	fake := &faultyGrpcClient{delay: 50 * time.Millisecond}
+	s.clients[peer] = newFakeClient(fake, ClientOptions{}, breaker.Options{})
+
+	done := make(chan struct{})
+	start := time.Now()
+	go func() {
+		s.SetPeers("127.0.0.1:8001", peer)
+		close(done)
+	}()
+
+	// 交接完成前，仍按旧的哈希环由当前节点负责全部 key
+	time.Sleep(20 * time.Millisecond)
+	for i := 0; i < n; i++ {
+		if !isReplica(s.PickPeers("key" + strconv.Itoa(i))) {
+			t.Fatalf("ring should not switch before handoff finishes")
+		}
+	}
+	<-done
+
+	moved := movedKeys(s, n, peer)
+	if len(moved) == 0 || len(moved) == n {
+		t.Fatalf("new peer should own some of the keys, got %d/%d", len(moved), n)
+	}
+	if min := time.Duration(len(moved)-1) * time.Second / rate; time.Since(start) < min {
+		t.Errorf("handoff of %d keys took %v, rate limit %d/s not applied", len(moved), time.Since(start), rate)
+	}
+
+	got := make(map[string]bool)
+	for _, in := range fake.handedOff() {
+		if in.Group != g.name {
+			continue // 其他测试遗留的 group
+		}
+		got[in.Key] = true
+		if !moved[in.Key] || string(in.Value) != "v-"+in.Key || in.Expire != expire.UnixNano() || in.Version == 0 {
+			t.Errorf("unexpected handoff entry %v", in)
+		}
+	}
+	if len(got) != len(moved) {
+		t.Errorf("handed off %d keys, want %d", len(got), len(moved))
+	}
+	for i := 0; i < n; i++ {
+		key := "key" + strconv.Itoa(i)
+		if _, ok := g.mainCache.peek(key); ok == moved[key] {
+			t.Errorf("%s: in mainCache = %v, moved = %v", key, ok, moved[key])
+		}
+	}
+}
+
+func TestHandoffAfterSwitch(t *testing.T) {
+	const n = 40
+	g := newHandoffGroup("handoff-async", n, time.Time{})
+	s := newServer("127.0.0.1:8001", &ServerOptions{Handoff: HandoffOptions{Enabled: true}})
+	s.SetPeers("127.0.0.1:8001")
+	g.peers = s
+
+	down, up := "127.0.0.1:8002", "127.0.0.1:8003"
+	s.clients[down] = newFakeClient(&faultyGrpcClient{err: errUnavailable}, ClientOptions{}, breaker.Options{})
+	fake := &faultyGrpcClient{}
+	s.clients[up] = newFakeClient(fake, ClientOptions{}, breaker.Options{})
+	s.SetPeers("127.0.0.1:8001", down, up)
+
+	// 哈希环立即切换，交接在后台进行
+	toUp := movedKeys(s, n, up)
+	deadline := time.Now().Add(time.Second)
+	for {
+		var count int
+		for _, in := range fake.handedOff() {
+			if in.Group == g.name {
+				count++
+			}
+		}
+		if count == len(toUp) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("handed off %d keys to %s, want %d", count, up, len(toUp))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond) // 等待移除已交接的 key
+
+	for i := 0; i < n; i++ {
+		key := "key" + strconv.Itoa(i)
+		_, ok := g.mainCache.peek(key)
+		if toUp[key] && ok {
+			t.Errorf("%s was handed off to %s and should be dropped", key, up)
+		}
+		if !toUp[key] && !ok {
+			t.Errorf("%s should stay in mainCache (owned locally or handoff to %s failed)", key, down)
+		}
+	}
+}
+
+// fakeHandoffServer 依次返回 entries 中的条目
+type fakeHandoffServer struct {
+	grpc.ServerStream
+	entries []*pb.SetRequest
+	resp    *pb.HandoffResponse
+}
+
+func (f *fakeHandoffServer) Recv() (*pb.SetRequest, error) {
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	in := f.entries[0]
+	f.entries = f.entries[1:]
+	return in, nil
+}
+
+func (f *fakeHandoffServer) SendAndClose(resp *pb.HandoffResponse) error {
+	f.resp = resp
+	return nil
+}
+
+func TestServerHandoff(t *testing.T) {
+	g := newHandoffGroup("handoff-recv", 1, time.Time{}) // key0 已存在
+	s := newServer("127.0.0.1:8001", nil)
+
+	expire := time.Now().Add(time.Hour)
+	version := uint64(expire.UnixNano()) // 原所有者的时钟比当前节点快
+	stream := &fakeHandoffServer{entries: []*pb.SetRequest{
+		{Group: g.name, Key: "key0", Value: []byte("stale")},
+		{Group: g.name, Key: "key1", Value: []byte("v1"), Expire: expire.UnixNano(), Version: version},
+		{Group: "no-such-group", Key: "key2", Value: []byte("v2")},
+	}}
+	if err := s.Handoff(stream); err != nil {
+		t.Fatalf("Handoff error: %v", err)
+	}
+	if stream.resp.GetAccepted() != 1 {
+		t.Errorf("accepted = %d, want 1", stream.resp.GetAccepted())
+	}
+	if v, _ := g.mainCache.peek("key0"); v.String() != "v-key0" {
+		t.Errorf("existing key should not be overwritten, got %q", v)
+	}
+	if v, ok := g.mainCache.peek("key1"); !ok || v.String() != "v1" || !v.e.Equal(expire) {
+		t.Errorf("handed off key1 = %q (expire %v), want v1 (expire %v)", v, v.e, expire)
+	}
+	// 保留原所有者的版本号，CompareAndSet 仍可使用交接前读到的版本号，此后分配的版本号更大
+	if v, _ := g.mainCache.peek("key1"); v.v != version {
+		t.Errorf("handed off key1 version = %d, want %d", v.v, version)
+	}
+	if next := g.nextVersion(); next <= version {
+		t.Errorf("next version %d should be greater than the handed off version %d", next, version)
+	}
+}
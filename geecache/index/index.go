@@ -0,0 +1,220 @@
+package index
+
+import (
+	"sort"
+	"strings"
+	"unsafe"
+)
+
+/*
+	Index 缓存 key 的二级索引，用于按标签或前缀批量移除，不需要扫描全部 key：
+	1. tags：标签 -> 带有该标签的 key 的集合；
+	2. 压缩前缀树（radix tree）：边上保存 key 的一段，只有一个子节点的中间节点与子节点合并，
+	   节点数不超过 key 数的两倍；查找前缀时只遍历该前缀下的子树。
+	Index 不是并发安全的，由调用方加锁（与 lru.LRUCache 相同）。
+	Bytes 估算索引占用的内存，缓存据此将索引计入已使用的内存。
+*/
+
+type Index struct {
+	keyTags map[string][]string            // key -> 标签，Add 覆盖与 Remove 时用于从 tags 中移除
+	tags    map[string]map[string]struct{} // 标签 -> key 的集合
+	root    *node                          // key 的前缀树
+	bytes   int64                          // 估算的内存占用
+}
+
+type node struct {
+	label    string  // 父节点到此节点的边上的字节，与 key 共享内存
+	children []*node // 按 label 的首字节排序
+	end      bool    // 是否有 key 在此结束
+}
+
+// 估算内存占用时使用的常量：Go 的 map 每个条目另有一个字节的控制信息，最多装满 7/8
+const (
+	stringSize = int64(unsafe.Sizeof(""))
+	sliceSize  = int64(unsafe.Sizeof([]string(nil)))
+	ptrSize    = int64(unsafe.Sizeof(uintptr(0)))
+	nodeSize   = int64(unsafe.Sizeof(node{})) + ptrSize // 节点与父节点中指向它的指针
+	mapSize    = 48                                     // map 的头部
+)
+
+func mapEntrySize(kv int64) int64 {
+	return (kv + 1) * 8 / 7
+}
+
+// New 实例化 Index
+func New() *Index {
+	return &Index{
+		keyTags: make(map[string][]string),
+		tags:    make(map[string]map[string]struct{}),
+		root:    &node{},
+	}
+}
+
+// Add 加入 key 及其标签，key 已存在时标签替换为新的标签
+func (x *Index) Add(key string, tags []string) {
+	if old, ok := x.keyTags[key]; ok {
+		x.untag(key, old)
+	} else {
+		x.insert(key)
+		x.bytes += mapEntrySize(stringSize + sliceSize)
+	}
+	x.keyTags[key] = tags
+	for _, tag := range tags {
+		keys, ok := x.tags[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			x.tags[tag] = keys
+			x.bytes += mapSize + mapEntrySize(stringSize+ptrSize)
+		}
+		if _, ok := keys[key]; !ok {
+			keys[key] = struct{}{}
+			x.bytes += mapEntrySize(stringSize)
+		}
+	}
+}
+
+// Remove 移除 key，key 不存在时忽略
+func (x *Index) Remove(key string) {
+	tags, ok := x.keyTags[key]
+	if !ok {
+		return
+	}
+	delete(x.keyTags, key)
+	x.bytes -= mapEntrySize(stringSize + sliceSize)
+	x.untag(key, tags)
+	x.delete(x.root, key)
+}
+
+// Len 返回 key 的数量
+func (x *Index) Len() int {
+	return len(x.keyTags)
+}
+
+// Bytes 返回估算的内存占用，不包括与 key 共享的字符串
+func (x *Index) Bytes() int64 {
+	return x.bytes
+}
+
+// Tagged 返回带有 tag 标签的全部 key，按字典序排列
+func (x *Index) Tagged(tag string) []string {
+	keys := make([]string, 0, len(x.tags[tag]))
+	for key := range x.tags[tag] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// WithPrefix 返回以 prefix 开头的全部 key，按字典序排列
+func (x *Index) WithPrefix(prefix string) []string {
+	n, path, rest := x.root, "", prefix
+	for rest != "" {
+		c := n.child(rest[0])
+		switch {
+		case c == nil:
+			return nil
+		case strings.HasPrefix(c.label, rest): // 前缀在边 c 的中间结束
+			rest = ""
+		case strings.HasPrefix(rest, c.label):
+			rest = rest[len(c.label):]
+		default:
+			return nil
+		}
+		n, path = c, path+c.label
+	}
+	var keys []string
+	collect(n, []byte(path), &keys)
+	return keys
+}
+
+func (x *Index) untag(key string, tags []string) {
+	for _, tag := range tags {
+		if keys := x.tags[tag]; keys != nil {
+			if _, ok := keys[key]; ok {
+				delete(keys, key)
+				x.bytes -= mapEntrySize(stringSize)
+			}
+			if len(keys) == 0 {
+				delete(x.tags, tag)
+				x.bytes -= mapSize + mapEntrySize(stringSize+ptrSize)
+			}
+		}
+	}
+}
+
+// child 返回 label 以 b 开头的子节点
+func (n *node) child(b byte) *node {
+	if i, ok := n.search(b); ok {
+		return n.children[i]
+	}
+	return nil
+}
+
+// search 返回 label 以 b 开头的子节点的下标，不存在时返回应插入的位置
+func (n *node) search(b byte) (int, bool) {
+	i := sort.Search(len(n.children), func(i int) bool { return n.children[i].label[0] >= b })
+	return i, i < len(n.children) && n.children[i].label[0] == b
+}
+
+// insert 将 key 加入前缀树
+func (x *Index) insert(key string) {
+	n, rest := x.root, key
+	for rest != "" {
+		i, ok := n.search(rest[0])
+		if !ok {
+			n.children = append(n.children, nil)
+			copy(n.children[i+1:], n.children[i:])
+			n.children[i] = &node{label: rest, end: true}
+			x.bytes += nodeSize
+			return
+		}
+		c := n.children[i]
+		common := commonPrefix(c.label, rest)
+		if common < len(c.label) { // 拆分边 c，中间节点继承 c 的前半段
+			mid := &node{label: c.label[:common], children: []*node{c}}
+			c.label = c.label[common:]
+			n.children[i] = mid
+			x.bytes += nodeSize
+			c = mid
+		}
+		n, rest = c, rest[common:]
+	}
+	n.end = true
+}
+
+// delete 从 n 的子树中删除 rest，返回 n 是否已经为空，为空的节点由父节点删除
+func (x *Index) delete(n *node, rest string) bool {
+	if rest == "" {
+		n.end = false
+	} else if i, ok := n.search(rest[0]); ok {
+		c := n.children[i]
+		if strings.HasPrefix(rest, c.label) && x.delete(c, rest[len(c.label):]) {
+			n.children = append(n.children[:i], n.children[i+1:]...)
+			x.bytes -= nodeSize
+		} else if !c.end && len(c.children) == 1 { // 合并只有一个子节点的中间节点
+			gc := c.children[0]
+			gc.label = c.label + gc.label
+			n.children[i] = gc
+			x.bytes -= nodeSize
+		}
+	}
+	return !n.end && len(n.children) == 0
+}
+
+func commonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// collect 按字典序收集 n 的子树中的全部 key，path 为 n 对应的前缀
+func collect(n *node, path []byte, keys *[]string) {
+	if n.end {
+		*keys = append(*keys, string(path))
+	}
+	for _, c := range n.children {
+		collect(c, append(path, c.label...), keys)
+	}
+}
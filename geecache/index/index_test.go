@@ -0,0 +1,102 @@
+package index
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTagged(t *testing.T) {
+	x := New()
+	x.Add("user:42:profile", []string{"user:42"})
+	x.Add("user:42:orders", []string{"user:42", "orders"})
+	x.Add("user:7:orders", []string{"user:7", "orders"})
+
+	if got, want := x.Tagged("orders"), []string{"user:42:orders", "user:7:orders"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Tagged(orders) = %v, want %v", got, want)
+	}
+
+	// 覆盖时替换标签
+	x.Add("user:42:orders", []string{"archived"})
+	if got, want := x.Tagged("orders"), []string{"user:7:orders"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Tagged(orders) = %v after retag, want %v", got, want)
+	}
+
+	x.Remove("user:42:profile")
+	x.Remove("user:42:profile") // 重复移除
+	if got := x.Tagged("user:42"); len(got) != 0 {
+		t.Fatalf("Tagged(user:42) = %v after remove, want none", got)
+	}
+	if len(x.tags) != 3 { // 为空的标签被删除
+		t.Fatalf("empty tags should be dropped, got %v", x.tags)
+	}
+}
+
+func TestWithPrefix(t *testing.T) {
+	x := New()
+	for _, key := range []string{"user:7", "user:42:orders", "user:42", "user:420", "item:1", ""} {
+		x.Add(key, nil)
+	}
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"user:42", []string{"user:42", "user:420", "user:42:orders"}},
+		{"user:42:", []string{"user:42:orders"}},
+		{"item", []string{"item:1"}},
+		{"order", nil},
+		{"", []string{"", "item:1", "user:42", "user:420", "user:42:orders", "user:7"}},
+	}
+	for _, tt := range tests {
+		if got := x.WithPrefix(tt.prefix); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("WithPrefix(%q) = %v, want %v", tt.prefix, got, tt.want)
+		}
+	}
+
+	for _, key := range []string{"user:7", "user:42:orders", "user:42", "user:420", "item:1", ""} {
+		x.Remove(key)
+	}
+	if x.Len() != 0 || len(x.root.children) != 0 || x.root.end {
+		t.Fatalf("trie should be empty after removing every key")
+	}
+}
+
+func countNodes(n *node) int {
+	count := 1
+	for _, c := range n.children {
+		count += countNodes(c)
+	}
+	return count
+}
+
+func TestRadixAndBytes(t *testing.T) {
+	x := New()
+	keys := []string{"romane", "romanus", "romulus", "rubens", "ruber", "rubicon", "rubicundus", "rom"}
+	for _, key := range keys {
+		x.Add(key, []string{"latin"})
+	}
+	if n := countNodes(x.root) - 1; n > 2*len(keys) {
+		t.Fatalf("%d nodes for %d keys, want at most %d", n, len(keys), 2*len(keys))
+	}
+	if got, want := x.WithPrefix("rom"), []string{"rom", "romane", "romanus", "romulus"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("WithPrefix(rom) = %v, want %v", got, want)
+	}
+	if got, want := x.WithPrefix("rubic"), []string{"rubicon", "rubicundus"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("WithPrefix(rubic) = %v, want %v", got, want)
+	}
+	if x.Bytes() <= 0 {
+		t.Fatalf("Bytes = %d, want a positive estimate", x.Bytes())
+	}
+
+	// 删除后中间节点合并，WithPrefix 仍然正确
+	x.Remove("romane")
+	x.Remove("rom")
+	if got, want := x.WithPrefix("roma"), []string{"romanus"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("WithPrefix(roma) = %v after remove, want %v", got, want)
+	}
+	for _, key := range keys {
+		x.Remove(key)
+	}
+	if x.Bytes() != 0 || countNodes(x.root) != 1 {
+		t.Fatalf("Bytes = %d with %d nodes after removing every key, want 0 and only the root", x.Bytes(), countNodes(x.root))
+	}
+}
@@ -0,0 +1,248 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	pb "geecache/geecachepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"sync"
+	"time"
+)
+
+/*
+	失效总线：hotCache 保存的是其他节点负责的 key 的副本，Set/Remove 之后这些副本就过时了。
+	1. 发起 Set/Remove 的节点（CompareAndSet/Incr 为执行它们的主节点）在写入成功后发布一个失效事件，
+	   事件带有连续递增的序号，最近 LogSize 个事件保留在内存中；
+	2. 每个节点通过 Invalidations 流式 RPC 订阅其他全部节点的事件，收到后从 hotCache 中移除对应的 key；
+	3. 连接断开后按上次收到的 epoch 与序号重新订阅，发布方补发期间错过的事件；
+	   发布方已重启（epoch 不同）或事件已被丢弃时发送 reset_all 事件，订阅方清空全部 hotCache。
+*/
+
+const (
+	defaultInvalidationLogSize = 4096
+	defaultInvalidationRetry   = time.Second
+)
+
+// InvalidationOptions 失效总线的配置
+type InvalidationOptions struct {
+	// Enabled 是否发布并订阅失效事件，集群中的节点需要统一开启
+	Enabled bool
+
+	// LogSize 保留最近多少个事件，供断线重连的订阅方补发，默认 4096
+	LogSize int
+
+	// RetryInterval 订阅断开后重连、以及检查节点列表变化的间隔，默认 1s
+	RetryInterval time.Duration
+}
+
+// invalidationPublisher 由 PeerPicker（Server）实现，Group 写入成功后通过它发布失效事件
+type invalidationPublisher interface {
+	publishInvalidation(group, key string)
+}
+
+// invalidate 通知其他节点丢弃 hotCache 中 key 的副本
+func (g *Group) invalidate(key string) {
+	if p, ok := g.peers.(invalidationPublisher); ok {
+		p.publishInvalidation(g.name, key)
+	}
+}
+
+// invalidationLog 本节点发布的最近的失效事件
+type invalidationLog struct {
+	mu     sync.Mutex
+	epoch  uint64 // 创建时间，节点重启后改变
+	size   int
+	events []*pb.Invalidation // 序号连续，最后一个的序号为 next-1
+	next   uint64             // 下一个事件的序号，从 1 开始
+	notify chan struct{}      // 发布新事件时关闭并替换，唤醒等待中的订阅方
+}
+
+func newInvalidationLog(size int) *invalidationLog {
+	return &invalidationLog{
+		epoch:  uint64(time.Now().UnixNano()),
+		size:   size,
+		next:   1,
+		notify: make(chan struct{}),
+	}
+}
+
+func (l *invalidationLog) publish(group, key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, &pb.Invalidation{Epoch: l.epoch, Seq: l.next, Group: group, Key: key})
+	l.next++
+	if len(l.events) > l.size {
+		l.events = l.events[len(l.events)-l.size:]
+	}
+	close(l.notify)
+	l.notify = make(chan struct{})
+}
+
+// since 返回订阅方上次收到 epoch/afterSeq 之后的事件，没有新事件时通过 notify 等待。
+// 订阅方错过的事件已无法补发时 reset 为 true，此时 afterSeq 之后的事件从 last 之后开始
+func (l *invalidationLog) since(epoch, afterSeq uint64) (events []*pb.Invalidation, reset bool, last uint64, notify <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	first := l.next - uint64(len(l.events))
+	if epoch != l.epoch || afterSeq+1 < first || afterSeq >= l.next {
+		return nil, true, l.next - 1, l.notify
+	}
+	events = append(events, l.events[afterSeq+1-first:]...)
+	return events, false, l.next - 1, l.notify
+}
+
+// publishInvalidation 实现 invalidationPublisher 接口，未开启失效总线时忽略
+func (s *Server) publishInvalidation(group, key string) {
+	if s.invalidations != nil {
+		s.invalidations.publish(group, key)
+	}
+}
+
+// Invalidations 向订阅方推送 in.AfterSeq 之后的失效事件，直到订阅方断开
+func (s *Server) Invalidations(in *pb.InvalidationsRequest, stream pb.GroupCache_InvalidationsServer) error {
+	if s.invalidations == nil {
+		return status.Error(codes.Unimplemented, "invalidation bus is disabled")
+	}
+	epoch, after := in.GetEpoch(), in.GetAfterSeq()
+	for {
+		events, reset, last, notify := s.invalidations.since(epoch, after)
+		if reset {
+			epoch, after = s.invalidations.epoch, last
+			if err := stream.Send(&pb.Invalidation{Epoch: epoch, Seq: last, ResetAll: true}); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, ev := range events {
+			if err := stream.Send(ev); err != nil {
+				return err
+			}
+			after = ev.Seq
+		}
+		if len(events) > 0 {
+			continue
+		}
+		select {
+		case <-notify:
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// invalidationLoop 订阅全部远程节点的失效事件，每隔 RetryInterval 按节点列表增删订阅，直到 stop 被关闭
+func (s *Server) invalidationLoop(stop chan struct{}) {
+	subs := make(map[string]chan struct{}) // 节点地址 -> 通知订阅退出
+	defer func() {
+		for _, done := range subs {
+			close(done)
+		}
+	}()
+	ticker := time.NewTicker(s.invalidationOpts.RetryInterval)
+	defer ticker.Stop()
+	for {
+		s.mu.Lock()
+		peers := make(map[string]*client, len(s.clients))
+		for addr, c := range s.clients {
+			if addr != s.addr {
+				peers[addr] = c
+			}
+		}
+		s.mu.Unlock()
+
+		for addr, c := range peers {
+			if _, ok := subs[addr]; !ok {
+				subs[addr] = make(chan struct{})
+				go s.subscribe(addr, c, subs[addr])
+			}
+		}
+		for addr, done := range subs {
+			if _, ok := peers[addr]; !ok {
+				close(done)
+				delete(subs, addr)
+			}
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// subscribe 订阅 addr 的失效事件，断开后从上次收到的事件之后重新订阅，直到 done 被关闭
+func (s *Server) subscribe(addr string, c *client, done chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var epoch, seq uint64
+	for {
+		err := c.invalidations(ctx, &pb.InvalidationsRequest{Epoch: epoch, AfterSeq: seq}, func(ev *pb.Invalidation) {
+			applyInvalidation(ev)
+			epoch, seq = ev.Epoch, ev.Seq
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		s.Log("invalidation stream from %s broken after seq %d: %v", addr, seq, err)
+		select {
+		case <-done:
+			return
+		case <-time.After(s.invalidationOpts.RetryInterval):
+		}
+	}
+}
+
+// applyInvalidation 从 hotCache 中移除事件对应的 key，ResetAll 事件清空全部 group 的 hotCache
+func applyInvalidation(ev *pb.Invalidation) {
+	if ev.ResetAll {
+		mu.RLock()
+		gs := make([]*Group, 0, len(groups))
+		for _, g := range groups {
+			gs = append(gs, g)
+		}
+		mu.RUnlock()
+		for _, g := range gs {
+			g.loadGroup.Lock(g.hotCache.clear)
+		}
+		return
+	}
+	if g := GetGroup(ev.Group); g != nil {
+		g.loadGroup.Lock(func() {
+			g.hotCache.remove(ev.Key)
+		})
+	}
+}
+
+// invalidations 订阅节点的失效事件，每收到一个调用一次 fn，直到流出错或 ctx 被取消。
+// 流会一直保持，因此不受 Timeout 限制，也不经过熔断器
+func (c *client) invalidations(ctx context.Context, in *pb.InvalidationsRequest, fn func(*pb.Invalidation)) error {
+	grpcClient, err := c.getGrpcClient()
+	if err != nil {
+		return err
+	}
+	stream, err := grpcClient.Invalidations(ctx, in)
+	for err == nil {
+		var ev *pb.Invalidation
+		if ev, err = stream.Recv(); err == nil {
+			fn(ev)
+		}
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("grpc client Invalidations() error: %w", err)
+	}
+	return nil
+}
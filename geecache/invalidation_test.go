@@ -0,0 +1,213 @@
+package geecache
+
+import (
+	"context"
+	"geecache/breaker"
+	pb "geecache/geecachepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInvalidationLog(t *testing.T) {
+	l := newInvalidationLog(3)
+	for _, key := range []string{"k1", "k2", "k3", "k4", "k5"} {
+		l.publish("g", key)
+	}
+	if events, reset, _, _ := l.since(l.epoch, 2); reset || len(events) != 3 || events[0].Key != "k3" {
+		t.Fatalf("since(2) = %v, reset %v; want k3..k5", events, reset)
+	}
+	if _, reset, last, _ := l.since(l.epoch, 1); !reset || last != 5 {
+		t.Fatalf("dropped events should reset to 5, got reset %v at %d", reset, last)
+	}
+	if _, reset, _, _ := l.since(l.epoch+1, 5); !reset {
+		t.Fatalf("another epoch should reset")
+	}
+
+	events, reset, _, notify := l.since(l.epoch, 5)
+	if reset || len(events) != 0 {
+		t.Fatalf("up-to-date subscriber got %v, reset %v", events, reset)
+	}
+	l.publish("g", "k6")
+	select {
+	case <-notify:
+	default:
+		t.Fatalf("publish should wake up waiting subscribers")
+	}
+}
+
+// loopbackClient 在进程内直接调用 s.Invalidations；down 为 true 时拒绝连接，setDown(true) 同时断开当前的流
+type loopbackClient struct {
+	pb.GroupCacheClient
+	s *Server
+
+	mu     sync.Mutex
+	down   bool
+	cancel context.CancelFunc
+	reqs   []*pb.InvalidationsRequest
+}
+
+func (c *loopbackClient) Invalidations(ctx context.Context, in *pb.InvalidationsRequest, opts ...grpc.CallOption) (pb.GroupCache_InvalidationsClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.down {
+		return nil, status.Error(codes.Unavailable, "connection refused")
+	}
+	c.reqs = append(c.reqs, in)
+	ctx, c.cancel = context.WithCancel(ctx)
+	stream := &loopbackStream{ctx: ctx, events: make(chan *pb.Invalidation), done: make(chan error, 1)}
+	go func() {
+		stream.done <- c.s.Invalidations(in, loopbackServerStream{loopbackStream: stream})
+	}()
+	return loopbackClientStream{loopbackStream: stream}, nil
+}
+
+func (c *loopbackClient) setDown(down bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.down = down
+	if down && c.cancel != nil {
+		c.cancel()
+	}
+}
+
+func (c *loopbackClient) requests() []*pb.InvalidationsRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*pb.InvalidationsRequest(nil), c.reqs...)
+}
+
+// loopbackStream 连接进程内的服务端与客户端
+type loopbackStream struct {
+	ctx    context.Context
+	events chan *pb.Invalidation
+	done   chan error // 服务端返回的错误
+}
+
+// loopbackServerStream 服务端的流
+type loopbackServerStream struct {
+	grpc.ServerStream
+	*loopbackStream
+}
+
+func (s loopbackServerStream) Context() context.Context { return s.ctx }
+
+func (s loopbackServerStream) Send(ev *pb.Invalidation) error {
+	select {
+	case s.events <- ev:
+		return nil
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+// loopbackClientStream 客户端的流
+type loopbackClientStream struct {
+	grpc.ClientStream
+	*loopbackStream
+}
+
+func (s loopbackClientStream) Recv() (*pb.Invalidation, error) {
+	select {
+	case ev := <-s.events:
+		return ev, nil
+	case err := <-s.done:
+		if err == nil {
+			err = io.EOF
+		}
+		return nil, err
+	}
+}
+
+// waitFor 等待 cond 成立，超时后测试失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestInvalidationBus(t *testing.T) {
+	opts := &ServerOptions{Invalidation: InvalidationOptions{Enabled: true, LogSize: 2, RetryInterval: 10 * time.Millisecond}}
+	pub := newServer("127.0.0.1:8001", opts)
+	sub := newServer("127.0.0.1:8002", opts)
+	bus := &loopbackClient{s: pub}
+	sub.clients["127.0.0.1:8001"] = newFakeClient(bus, ClientOptions{}, breaker.Options{})
+
+	gp := NewGroup("invalidation", 2<<10, GetterFunc(notFound))
+	hot := func(key string) bool {
+		_, ok := gp.hotCache.peek(key)
+		return ok
+	}
+	setHot := func(keys ...string) {
+		for _, key := range keys {
+			gp.localSet(key, ByteView{b: []byte("stale")}, &gp.hotCache)
+		}
+	}
+
+	// 首次订阅时无法得知此前错过的事件，清空 hotCache
+	setHot("Tom")
+	stop := make(chan struct{})
+	defer close(stop)
+	go sub.invalidationLoop(stop)
+	waitFor(t, "reset on first subscription", func() bool { return !hot("Tom") })
+
+	setHot("Tom", "Jack", "Sam")
+	pub.publishInvalidation(gp.name, "Tom")
+	waitFor(t, "Tom invalidated", func() bool { return !hot("Tom") })
+	if !hot("Jack") {
+		t.Fatalf("Jack should not be invalidated")
+	}
+
+	// 断线期间发布的事件在重连后补发
+	bus.setDown(true)
+	pub.publishInvalidation(gp.name, "Jack")
+	time.Sleep(30 * time.Millisecond)
+	bus.setDown(false)
+	waitFor(t, "Jack invalidated after reconnect", func() bool { return !hot("Jack") })
+	if !hot("Sam") {
+		t.Fatalf("replay should not reset hotCache")
+	}
+	reqs := bus.requests()
+	if last := reqs[len(reqs)-1]; last.Epoch != pub.invalidations.epoch || last.AfterSeq != 1 {
+		t.Fatalf("reconnect should resume after seq 1, got %v", last)
+	}
+
+	// 错过的事件超过 LogSize，重连后清空 hotCache
+	bus.setDown(true)
+	for _, key := range []string{"k1", "k2", "k3"} {
+		pub.publishInvalidation(gp.name, key)
+	}
+	bus.setDown(false)
+	waitFor(t, "reset after dropped events", func() bool { return !hot("Sam") })
+}
+
+func TestWritesPublishInvalidations(t *testing.T) {
+	s := newServer("127.0.0.1:8001", &ServerOptions{Invalidation: InvalidationOptions{Enabled: true}})
+	gp := NewGroup("invalidation-publish", 2<<10, GetterFunc(func(string) ([]byte, error) { return nil, nil }))
+	gp.peers = s
+
+	gp.Set("Tom", []byte("630"), time.Time{}, false)
+	gp.Remove("Tom")
+	version, _ := gp.CompareAndSet("Jack", []byte("589"), time.Time{}, 0)
+	gp.CompareAndSet("Jack", []byte("590"), time.Time{}, version+1) // 冲突，不发布
+	gp.Incr("hits", 1, 0)
+
+	events, _, _, _ := s.invalidations.since(s.invalidations.epoch, 0)
+	var keys []string
+	for _, ev := range events {
+		keys = append(keys, ev.Key)
+	}
+	if got, want := strings.Join(keys, ","), "Tom,Tom,Jack,hits"; got != want {
+		t.Fatalf("published %s, want %s", got, want)
+	}
+}
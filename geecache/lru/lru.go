@@ -1,19 +1,26 @@
 package lru
 
 import (
-	"container/list"
 	"time"
+	"unsafe"
 )
 
+/*
+	Cache[V] 的值直接以 V 类型保存在条目中，不经过 interface{} 装箱；条目自身组成双向链表，
+	不再使用 container/list，新增一个条目只分配一次内存。LRUCache 即 Cache[any]，保持原来的用法。
+*/
+
 type NowFunc func() time.Time
 
-type LRUCache struct {
-	maxEntries int                      // 允许的最大缓存条目数。零表示没有限制
-	ll         *list.List               // 直接使用 Go 语言标准库实现的双向链表list.List
-	keyLink    map[string]*list.Element // 键是字符串，值是双向链表中对应节点的指针
+// Cache 值为 V 类型的 LRU 缓存，不是并发安全的
+type Cache[V any] struct {
+	maxEntries int                  // 允许的最大缓存条目数。零表示没有限制
+	root       entry[V]             // 链表的哨兵节点，root.next 为队首（最近访问），root.prev 为队尾
+	keyLink    map[string]*entry[V] // 键是字符串，值是双向链表中对应节点的指针
+	len        int
 
 	// 某条记录从缓存中被移除时的回调函数，可以为 nil
-	OnEvicted func(key string, value interface{})
+	OnEvicted func(key string, value V)
 
 	// Now is the Now() function the cache will use to determine
 	// the current time which is used to calculate expired values
@@ -21,10 +28,14 @@ type LRUCache struct {
 	Now NowFunc
 }
 
-type entry struct {
-	key    string
-	value  interface{}
-	expire time.Time // 0 表示永不过期
+// LRUCache 值为任意类型的 LRU 缓存
+type LRUCache = Cache[any]
+
+type entry[V any] struct {
+	prev, next *entry[V]
+	key        string
+	value      V
+	expire     time.Time // 0 表示永不过期
 }
 
 //type Value interface {
@@ -33,88 +44,149 @@ type entry struct {
 
 // New 实例化 LRUCache
 func New(maxEntries int, onEvicted func(string, interface{})) *LRUCache {
-	return &LRUCache{
+	return NewCache[any](maxEntries, onEvicted)
+}
+
+// NewCache 实例化值为 V 类型的 Cache
+func NewCache[V any](maxEntries int, onEvicted func(string, V)) *Cache[V] {
+	c := &Cache[V]{
 		maxEntries: maxEntries,
-		ll:         list.New(),
-		keyLink:    make(map[string]*list.Element),
+		keyLink:    make(map[string]*entry[V]),
 		OnEvicted:  onEvicted,
 		Now:        time.Now,
 	}
+	c.root.next, c.root.prev = &c.root, &c.root
+	return c
 }
 
 // Get 查找功能：第一步从字典中找到对应的双向链表的节点，判断是否过期
 // 若过期，则进行删除操作；不过期，则将该节点移动到队首。
-func (c *LRUCache) Get(key string) (interface{}, bool) {
+func (c *Cache[V]) Get(key string) (value V, ok bool) {
 	if c.keyLink == nil {
-		return nil, false
+		return value, false
 	}
-	if ele, exist := c.keyLink[key]; exist {
-		kv := ele.Value.(*entry)                              // 断言
-		if !kv.expire.IsZero() && kv.expire.Before(c.Now()) { // 判断是否过期
-			c.removeElement(ele)
-			return nil, false
+	if e, exist := c.keyLink[key]; exist {
+		if !e.expire.IsZero() && e.expire.Before(c.Now()) { // 判断是否过期
+			c.removeElement(e)
+			return value, false
 		}
-		c.ll.MoveToFront(ele)
-		return kv.value, true
+		c.moveToFront(e)
+		return e.value, true
 	}
-	return nil, false
+	return value, false
 }
 
 // Add 新增/修改
-func (c *LRUCache) Add(key string, value interface{}, expire time.Time) {
+func (c *Cache[V]) Add(key string, value V, expire time.Time) {
 
 	// 由于本方法只在cache.go 中的 add() 方法中被调用，
 	// add() 方法在前面已经判断 LRUCache 是否为nil，是 nil 则调用 New() 初始化，
-	// 所以此处不需要再判断 keyLink 和 ll 是否为nil
+	// 所以此处不需要再判断 keyLink 是否为nil
 
 	// 如果键存在，则更新对应节点的值，并将该节点移到队首
-	if ele, ok := c.keyLink[key]; ok {
-		c.ll.MoveToFront(ele)
-		kv := ele.Value.(*entry)
-		kv.value = value
-		kv.expire = expire
+	if e, ok := c.keyLink[key]; ok {
+		c.moveToFront(e)
+		e.value = value
+		e.expire = expire
 		return
 	}
 	// 不存在则新增
-	ele := c.ll.PushFront(&entry{key, value, expire})
-	c.keyLink[key] = ele
+	e := &entry[V]{key: key, value: value, expire: expire}
+	c.insertFront(e)
+	c.keyLink[key] = e
 	// 如果键值对数量超过了设定的最大值maxEntries，则移除队尾节点直至不超
 	for c.maxEntries != 0 && c.Len() > c.maxEntries {
 		c.RemoveOldest()
 	}
 }
 
+// Peek 与 Get 相同，但不移动节点，也不删除已过期的节点
+func (c *Cache[V]) Peek(key string) (value V, ok bool) {
+	if e, exist := c.keyLink[key]; exist {
+		if !e.expire.IsZero() && e.expire.Before(c.Now()) {
+			return value, false
+		}
+		return e.value, true
+	}
+	return value, false
+}
+
+// Keys 返回全部 key，按最近访问时间从新到旧排列
+func (c *Cache[V]) Keys() []string {
+	if c.keyLink == nil {
+		return nil
+	}
+	keys := make([]string, 0, c.len)
+	for e := c.root.next; e != &c.root; e = e.next {
+		keys = append(keys, e.key)
+	}
+	return keys
+}
+
 // Remove 移除指定 key
-func (c *LRUCache) Remove(key string) {
+func (c *Cache[V]) Remove(key string) {
 	if c.keyLink == nil {
 		return
 	}
-	if ele := c.keyLink[key]; ele != nil {
-		c.removeElement(ele)
+	if e := c.keyLink[key]; e != nil {
+		c.removeElement(e)
+	}
+}
+
+// Oldest 返回最近最少访问的节点（队尾），不移动节点
+func (c *Cache[V]) Oldest() (key string, value V, ok bool) {
+	if c.len == 0 {
+		return "", value, false
 	}
+	e := c.root.prev
+	return e.key, e.value, true
 }
 
 // RemoveOldest 缓存淘汰。即移除最近最少访问的节点（队尾）
-func (c *LRUCache) RemoveOldest() {
-	if c.keyLink == nil {
+func (c *Cache[V]) RemoveOldest() {
+	if c.len == 0 {
 		return
 	}
-	if ele := c.ll.Back(); ele != nil {
-		c.removeElement(ele)
+	c.removeElement(c.root.prev)
+}
+
+func (c *Cache[V]) insertFront(e *entry[V]) {
+	e.prev, e.next = &c.root, c.root.next
+	c.root.next.prev = e
+	c.root.next = e
+	c.len++
+}
+
+func (c *Cache[V]) moveToFront(e *entry[V]) {
+	if c.root.next == e {
+		return
 	}
+	e.prev.next, e.next.prev = e.next, e.prev
+	e.prev, e.next = &c.root, c.root.next
+	c.root.next.prev = e
+	c.root.next = e
 }
 
-func (c *LRUCache) removeElement(ele *list.Element) {
-	kv := ele.Value.(*entry)
-	delete(c.keyLink, kv.key) // 删除字典中的key
-	c.ll.Remove(ele)          // 把元素从链表中删除
+func (c *Cache[V]) removeElement(e *entry[V]) {
+	delete(c.keyLink, e.key) // 删除字典中的key
+	e.prev.next, e.next.prev = e.next, e.prev
+	e.prev, e.next = nil, nil // 避免内存泄漏
+	c.len--
 
 	// 如果回调函数 OnEvicted 不为 nil，则调用回调函数。
 	if c.OnEvicted != nil {
-		c.OnEvicted(kv.key, kv.value)
+		c.OnEvicted(e.key, e.value)
 	}
 }
 
-func (c *LRUCache) Len() int {
-	return c.ll.Len()
+func (c *Cache[V]) Len() int {
+	return c.len
+}
+
+// EntryOverhead 返回每个条目除 key 与值引用的数据之外占用的内存：条目本身与 keyLink 中的一项。
+// map 的每一项另有一个字节的控制信息，且最多装满 7/8
+func (c *Cache[V]) EntryOverhead() int64 {
+	var e entry[V]
+	slot := int64(unsafe.Sizeof(e.key)) + int64(unsafe.Sizeof(&e))
+	return int64(unsafe.Sizeof(e)) + (slot+1)*8/7
 }
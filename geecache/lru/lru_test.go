@@ -2,6 +2,7 @@ package lru
 
 import (
 	//"geecache/lru"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -81,3 +82,83 @@ func TestExpire(t *testing.T) {
 		}
 	}
 }
+
+func TestKeysAndPeek(t *testing.T) {
+	lru := New(0, nil)
+	lru.Add("k1", 1, time.Time{})
+	lru.Add("k2", 2, time.Time{})
+	lru.Add("k3", 3, time.Now().Add(-time.Second)) // 已过期
+
+	if v, ok := lru.Peek("k1"); !ok || v != 1 {
+		t.Fatalf("Peek k1 = %v, %v", v, ok)
+	}
+	if _, ok := lru.Peek("k3"); ok {
+		t.Fatalf("Peek should not return expired k3")
+	}
+	// Peek 不改变顺序，也不删除过期节点
+	if keys := lru.Keys(); len(keys) != 3 || keys[0] != "k3" || keys[2] != "k1" {
+		t.Fatalf("Keys = %v, want [k3 k2 k1]", keys)
+	}
+}
+
+type view struct {
+	b []byte
+	e time.Time
+	v uint64
+}
+
+// 值不经过 interface{} 装箱：新增一个条目只分配条目本身，查找不分配内存
+func TestAllocs(t *testing.T) {
+	c := NewCache[view](0, nil)
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+	}
+	v := view{b: []byte("value")}
+	i := 0
+	adds := testing.AllocsPerRun(len(keys)-1, func() {
+		c.Add(keys[i], v, time.Time{})
+		i++
+	})
+	if adds > 1.1 { // map 扩容偶尔分配
+		t.Fatalf("Add allocated %.2f times per entry, want 1", adds)
+	}
+	if gets := testing.AllocsPerRun(100, func() { c.Get(keys[42]) }); gets != 0 {
+		t.Fatalf("Get allocated %.0f times, want 0", gets)
+	}
+}
+
+func BenchmarkAdd(b *testing.B) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+	}
+	b.Run("generic", func(b *testing.B) {
+		c := NewCache[view](512, nil)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			c.Add(keys[i&1023], view{v: uint64(i)}, time.Time{})
+		}
+	})
+	b.Run("any", func(b *testing.B) {
+		c := New(512, nil)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			c.Add(keys[i&1023], view{v: uint64(i)}, time.Time{})
+		}
+	})
+}
+
+func BenchmarkGet(b *testing.B) {
+	c := NewCache[view](0, nil)
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+		c.Add(keys[i], view{v: uint64(i)}, time.Time{})
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Get(keys[i&1023])
+	}
+}
@@ -20,6 +20,18 @@ type ProtoGetter interface {
 
 	Set(in *pb.SetRequest) error
 	Remove(in *pb.Request) error
+
+	// CompareAndSet 在 key 的主节点上比较版本号并写入，版本号不一致时返回 ErrVersionConflict
+	CompareAndSet(in *pb.CompareAndSetRequest, out *pb.CompareAndSetResponse) error
+
+	// Incr 在 key 的主节点上原子地增加计数器
+	Incr(in *pb.IncrRequest, out *pb.IncrResponse) error
+
+	// RemoveMatching 按标签或前缀移除节点缓存中的条目
+	RemoveMatching(in *pb.RemoveMatchingRequest, out *pb.RemoveMatchingResponse) error
+
+	// Purge 清空节点上 group 的全部缓存
+	Purge(in *pb.PurgeRequest) error
 }
 
 // PeerPicker 接口，实现根据传入的 key 选择相应节点 ProtoGetter 的功能
@@ -28,6 +40,10 @@ type PeerPicker interface {
 	// 如果密钥所有者是当前对等方，则返回 nil 和 false。
 	PickPeer(key string) (ProtoGetter, bool)
 
+	// PickPeers 返回负责 key 的全部副本节点，按优先级排序，首个为主节点。
+	// 如果当前对等方也是副本之一，则在对应位置返回 nil，由调用方在本地处理。
+	PickPeers(key string) []ProtoGetter
+
 	// GetAll returns all the peers in the group
 	GetAll() []ProtoGetter
 }
@@ -35,6 +51,7 @@ type PeerPicker interface {
 type NoPeer struct{}
 
 func (NoPeer) PickPeer(string) (peer ProtoGetter, ok bool) { return }
+func (NoPeer) PickPeers(string) []ProtoGetter              { return []ProtoGetter{nil} }
 func (NoPeer) GetAll() (peers []ProtoGetter)               { return }
 
 // 这部分做了简化，全局共用一个http池，即意味着 HTTPPool 只需注册一次
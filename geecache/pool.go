@@ -0,0 +1,49 @@
+package geecache
+
+import (
+	pb "geecache/geecachepb"
+	"sync"
+)
+
+/*
+	向远程节点发送请求时复用 pb 消息，减少热点路径上的内存分配。ProtoGetter 的调用返回后，
+	gRPC 已经完成序列化，不再引用请求；响应中的切片直接交给 ByteView，消息本身 Reset 后放回。
+	ProtoGetter 的实现不能在调用返回后继续持有请求或响应。
+	Server 溢出查询时转发的请求、Warmup 流中逐条发送的条目同样复用，stream.Send 返回时消息已经序列化。
+	Server.Get 等 RPC 的响应交给 gRPC 后才序列化，返回前无法放回，因此不复用。
+*/
+
+var (
+	requestPool    = sync.Pool{New: func() any { return new(pb.Request) }}
+	responsePool   = sync.Pool{New: func() any { return new(pb.Response) }}
+	setRequestPool = sync.Pool{New: func() any { return new(pb.SetRequest) }}
+)
+
+func getRequest(group, key string) *pb.Request {
+	req := requestPool.Get().(*pb.Request)
+	req.Group, req.Key = group, key
+	return req
+}
+
+func putRequest(req *pb.Request) {
+	req.Reset()
+	requestPool.Put(req)
+}
+
+func getResponse() *pb.Response {
+	return responsePool.Get().(*pb.Response)
+}
+
+func putResponse(res *pb.Response) {
+	res.Reset()
+	responsePool.Put(res)
+}
+
+func getSetRequest() *pb.SetRequest {
+	return setRequestPool.Get().(*pb.SetRequest)
+}
+
+func putSetRequest(req *pb.SetRequest) {
+	req.Reset()
+	setRequestPool.Put(req)
+}
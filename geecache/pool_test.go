@@ -0,0 +1,100 @@
+package geecache
+
+import (
+	"bytes"
+	"context"
+	pb "geecache/geecachepb"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestPooledMessages 放回池中的消息已清空，响应中的值仍由 ByteView 持有
+func TestPooledMessages(t *testing.T) {
+	gp := NewGroup("pooled", 2<<10, GetterFunc(notFound))
+	peer := newFakePeer(false)
+	peer.data["Tom"] = []byte("630")
+	peer.data["Jack"] = []byte("589")
+
+	tom, err := gp.getFromPeer(peer, "Tom")
+	if err != nil {
+		t.Fatalf("getFromPeer failed: %v", err)
+	}
+	jack, _ := gp.getFromPeer(peer, "Jack")
+	if tom.String() != "630" || jack.String() != "589" {
+		t.Fatalf("values = %s, %s; pooled responses must not share values", tom, jack)
+	}
+	if req := getRequest("", ""); req.Group != "" || req.Key != "" {
+		t.Fatalf("pooled request was not reset: %v", req)
+	}
+}
+
+// benchGroup 基准测试函数会被多次调用，已注册的 Group 直接复用
+func benchGroup(name string, getter Getter, o *GroupOptions) *Group {
+	if g := GetGroup(name); g != nil {
+		return g
+	}
+	return NewGroupOpts(name, 64<<20, getter, o)
+}
+
+func BenchmarkGetFromPeer(b *testing.B) {
+	gp := benchGroup("bench-peer", GetterFunc(notFound), nil)
+	peer := newFakePeer(false)
+	peer.data["Tom"] = bytes.Repeat([]byte("x"), 1<<10)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := gp.getFromPeer(peer, "Tom"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkQueryLocally(b *testing.B) {
+	value := bytes.Repeat([]byte("x"), 64<<10)
+	for _, owned := range []bool{false, true} {
+		name := "copy"
+		if owned {
+			name = "owned"
+		}
+		gp := benchGroup("bench-load-"+name, GetterFunc(func(key string) ([]byte, error) {
+			return value, nil
+		}), &GroupOptions{TransferOwnership: owned})
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := gp.queryLocally("key"+strconv.Itoa(i&255), 0); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkServerGet(b *testing.B) {
+	gp := benchGroup("bench-server", GetterFunc(notFound), nil)
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil}}
+	gp.localSet("Tom", ByteView{b: bytes.Repeat([]byte("x"), 64<<10)}, &gp.mainCache)
+	s := newServer("127.0.0.1:8001", nil)
+	in := &pb.Request{Group: gp.name, Key: "Tom"}
+	log.SetOutput(io.Discard) // Server 每次请求都记录日志
+	defer log.SetOutput(os.Stderr)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.Get(context.Background(), in); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCacheAdd(b *testing.B) {
+	var c cache
+	value := ByteView{b: []byte("630"), e: time.Now().Add(time.Hour)}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c.add("key"+strconv.Itoa(i&1023), value)
+	}
+}
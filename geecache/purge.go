@@ -0,0 +1,84 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	pb "geecache/geecachepb"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+/*
+	清空 Group：Purge 在 loadGroup.Lock 中清空本节点的 mainCache、hotCache，同时将 generation 加一，磁盘缓存在锁外清空。
+	load 开始时记录 generation，加载完成后在同一把锁中比较，不一致说明加载期间发生了 Purge，
+	加载到的值只返回给调用方，不存入缓存，避免 Purge 之前开始的加载把旧值重新放回缓存。
+	PurgeAll 在本节点 Purge 后通过 Purge RPC 通知其他全部节点，结果与失败重试同 Remove。
+	Purge 只清除缓存，不会调用 Deleter 删除数据源中的数据。
+*/
+
+// Purge 清空本节点上该 Group 的全部缓存
+func (g *Group) Purge() {
+	g.loadGroup.Lock(func() {
+		g.generation.Add(1)
+		g.mainCache.clear()
+		g.hotCache.clear()
+		if g.disk != nil {
+			g.cancelDemotions(func(string, ByteView) bool { return true })
+			g.beginDiskRemoval()
+		}
+	})
+	if g.disk != nil {
+		g.disk.DeletePrefix("") // 遍历磁盘缓存的索引，在锁外进行
+		g.endDiskRemoval()
+	}
+}
+
+// PurgeAll 清空全部节点上该 Group 的缓存
+func (g *Group) PurgeAll() error {
+	g.peersOnce.Do(g.initPeers)
+	g.Purge()
+
+	target := removeTarget{purge: true}
+	results := append([]PeerResult{{Peer: peerName(nil)}}, removeFromPeers(g.peers.GetAll(), false, func(peer ProtoGetter) error {
+		return g.purgePeer(peer)
+	})...)
+	g.removeRetry.add(target, results)
+	if !g.removeSucceeded(results) {
+		return &RemoveError{Key: target.String(), Policy: g.removePolicy, Results: results}
+	}
+	return nil
+}
+
+func (g *Group) purgePeer(peer ProtoGetter) error {
+	return peer.Purge(&pb.PurgeRequest{Group: g.name})
+}
+
+// populateLoaded 将加载到的值存入 cache，gen 为加载开始时的 generation，此后发生过 Purge 时丢弃
+func (g *Group) populateLoaded(key string, value ByteView, cache *cache, gen uint64) {
+	value = g.compress(value) // 在锁外压缩
+	g.loadGroup.Lock(func() {
+		if g.generation.Load() == gen {
+			g.populateCache(key, value, cache)
+		}
+	})
+}
+
+// Purge 清空本节点上 group 的全部缓存
+func (s *Server) Purge(ctx context.Context, in *pb.PurgeRequest) (*emptypb.Empty, error) {
+	group := GetGroup(in.GetGroup())
+	if group == nil {
+		return new(emptypb.Empty), fmt.Errorf("no such group: %s", in.GetGroup())
+	}
+	s.Log("执行Purge清空数据组group：%v", group.name)
+	group.Purge()
+	return new(emptypb.Empty), nil
+}
+
+// Purge 方法，实现 ProtoGetter 接口
+func (c *client) Purge(in *pb.PurgeRequest) error {
+	return c.call(func(ctx context.Context, grpcClient pb.GroupCacheClient) error {
+		if _, err := grpcClient.Purge(ctx, in); err != nil {
+			return fmt.Errorf("grpc client Purge() error: %w", err)
+		}
+		return nil
+	})
+}
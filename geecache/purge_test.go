@@ -0,0 +1,83 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	pb "geecache/geecachepb"
+	"testing"
+	"time"
+)
+
+func TestPurge(t *testing.T) {
+	gp := NewGroupOpts("purge", 2<<10, GetterFunc(notFound), &GroupOptions{DiskDir: t.TempDir(), DiskBytes: 1 << 20})
+	gp.localSet("Tom", ByteView{b: []byte("630"), t: []string{"people"}}, &gp.mainCache)
+	gp.localSet("Jack", ByteView{b: []byte("589")}, &gp.hotCache)
+	gp.disk.Put("Sam", []byte("567"), time.Time{})
+
+	gp.Purge()
+	if gp.mainCache.bytes() != 0 || gp.hotCache.bytes() != 0 || gp.disk.Len() != 0 {
+		t.Fatalf("Purge should clear mainCache, hotCache and disk")
+	}
+	if keys := gp.mainCache.matching("people", ""); len(keys) != 0 {
+		t.Fatalf("Purge should clear the tag index, got %v", keys)
+	}
+}
+
+func TestPurgeDropsInflightLoad(t *testing.T) {
+	loading, release := make(chan struct{}), make(chan struct{})
+	gp := NewGroup("purge-inflight", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		close(loading)
+		<-release
+		return []byte("stale"), nil
+	}))
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil}}
+
+	done := make(chan ByteView)
+	go func() {
+		view, _ := gp.Query("Tom")
+		done <- view
+	}()
+	<-loading
+	gp.Purge() // 加载开始后发生 Purge
+	close(release)
+
+	if view := <-done; view.String() != "stale" {
+		t.Fatalf("Query = %q, the caller should still get the loaded value", view)
+	}
+	if _, ok := gp.mainCache.peek("Tom"); ok {
+		t.Fatalf("a load started before Purge should not repopulate mainCache")
+	}
+}
+
+func TestPurgeAll(t *testing.T) {
+	up, down := newFakePeer(false), newFakePeer(true)
+	up.data["Tom"] = []byte("630")
+	gp := NewGroupOpts("purge-all", 2<<10, GetterFunc(notFound), &GroupOptions{RemoveRetry: RemoveRetryOptions{MaxAttempts: -1}})
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil}, all: []ProtoGetter{up, down}}
+	gp.localSet("Jack", ByteView{b: []byte("589")}, &gp.mainCache)
+
+	err := gp.PurgeAll()
+	var rerr *RemoveError
+	if !errors.As(err, &rerr) || rerr.Key != "purge" || len(rerr.Failed()) != 1 {
+		t.Fatalf("PurgeAll should report the down peer, got %v", err)
+	}
+	if len(up.data) != 0 || gp.mainCache.bytes() != 0 {
+		t.Fatalf("PurgeAll should clear local and reachable peers")
+	}
+}
+
+func TestServerPurge(t *testing.T) {
+	gp := NewGroup("purge-server", 2<<10, GetterFunc(notFound))
+	gp.localSet("Tom", ByteView{b: []byte("630")}, &gp.mainCache)
+	s := newServer("127.0.0.1:8001", nil)
+
+	if _, err := s.Purge(context.Background(), &pb.PurgeRequest{Group: gp.name}); err != nil {
+		t.Fatalf("Purge failed: %v", err)
+	}
+	if _, ok := gp.mainCache.peek("Tom"); ok {
+		t.Fatalf("Purge RPC should clear the group")
+	}
+	if _, err := s.Purge(context.Background(), &pb.PurgeRequest{Group: "no-such-group"}); err == nil {
+		t.Fatalf("Purge of an unknown group should fail")
+	}
+}
@@ -6,6 +6,9 @@ import (
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"google.golang.org/grpc"
 	"log"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -16,8 +19,45 @@ var (
 	}
 )
 
+// Metadata 与服务地址一起注册到 etcd 的节点信息
+type Metadata struct {
+	Weight int // 节点在一致性哈希中的权重，0 表示默认权重 1
+}
+
+// encodeValue 将地址与元数据编码为 etcd 中的值，格式：ip:port?weight=4。
+// 元数据均为默认值时只保存地址，与未携带元数据的旧版本节点兼容
+func encodeValue(addr string, md Metadata) string {
+	params := url.Values{}
+	if md.Weight > 0 {
+		params.Set("weight", strconv.Itoa(md.Weight))
+	}
+	if len(params) == 0 {
+		return addr
+	}
+	return addr + "?" + params.Encode()
+}
+
+// parseValue 是 encodeValue 的逆过程，无法识别的元数据被忽略
+func parseValue(value string) (addr string, md Metadata) {
+	addr, query, found := strings.Cut(value, "?")
+	if !found {
+		return addr, md
+	}
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return addr, md
+	}
+	md.Weight, _ = strconv.Atoi(params.Get("weight"))
+	return addr, md
+}
+
 // RegisterServiceToETCD 注册一个服务至etcd. 注意 Register将不会return 如果没有error的话
 func RegisterServiceToETCD(serviceName string, addr string, stop chan error) error {
+	return RegisterServiceWithMetadata(serviceName, addr, Metadata{}, stop)
+}
+
+// RegisterServiceWithMetadata 与 RegisterServiceToETCD 相同，同时注册节点的元数据
+func RegisterServiceWithMetadata(serviceName string, addr string, md Metadata, stop chan error) error {
 	cli, err := clientv3.New(defaultEtcdConfig)
 	if err != nil {
 		return fmt.Errorf("create etcd client failed: %v", err)
@@ -31,7 +71,7 @@ func RegisterServiceToETCD(serviceName string, addr string, stop chan error) err
 	}
 
 	// 注册至etcd
-	_, err = cli.Put(context.Background(), serviceName+"/"+addr, addr, clientv3.WithLease(resp.ID))
+	_, err = cli.Put(context.Background(), serviceName+"/"+addr, encodeValue(addr, md), clientv3.WithLease(resp.ID))
 	if err != nil {
 		return fmt.Errorf("add etcd record failed: %v", err)
 	}
@@ -76,9 +116,30 @@ func EtcdDial(c *clientv3.Client, service string) (*grpc.ClientConn, error) {
 	if err != nil {
 		return nil, err
 	}
+	if len(resp.Kvs) == 0 { // 服务未注册或租约已过期，即节点已下线
+		return nil, fmt.Errorf("service %s not found in etcd", service)
+	}
 
-	return grpc.Dial(string(resp.Kvs[0].Value),
+	// 节点地址已注册但进程不可达时，WithBlock 会一直阻塞，因此加上超时
+	ctx, cancel := context.WithTimeout(context.Background(), defaultEtcdConfig.DialTimeout)
+	defer cancel()
+	addr, _ := parseValue(string(resp.Kvs[0].Value))
+	return grpc.DialContext(ctx, addr,
 		grpc.WithInsecure(),
 		grpc.WithBlock(),
 	)
 }
+
+// Discover 返回 etcd 中 serviceName 下所有已注册节点的地址及其元数据
+func Discover(c *clientv3.Client, serviceName string) (map[string]Metadata, error) {
+	resp, err := c.Get(context.Background(), serviceName+"/", clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	services := make(map[string]Metadata, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		addr, md := parseValue(string(kv.Value))
+		services[addr] = md
+	}
+	return services, nil
+}
@@ -45,3 +45,22 @@ func TestRegisterServiceToETCD(t *testing.T) {
 	time.Sleep(time.Second * 2)
 	stop <- erro
 }
+
+func TestMetadataValue(t *testing.T) {
+	tests := []struct {
+		addr  string
+		md    Metadata
+		value string
+	}{
+		{"127.0.0.1:8001", Metadata{}, "127.0.0.1:8001"}, // 与旧版本节点兼容
+		{"127.0.0.1:8002", Metadata{Weight: 4}, "127.0.0.1:8002?weight=4"},
+	}
+	for _, tt := range tests {
+		if v := encodeValue(tt.addr, tt.md); v != tt.value {
+			t.Errorf("encodeValue(%s, %+v) = %s, want %s", tt.addr, tt.md, v, tt.value)
+		}
+		if addr, md := parseValue(tt.value); addr != tt.addr || md != tt.md {
+			t.Errorf("parseValue(%s) = %s, %+v", tt.value, addr, md)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package geecache
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+	Remove 的结果：Remove 先从 key 的副本中移除（需要满足 WriteQuorum），再清除其他节点中的副本。
+	每个节点的结果记录在 PeerResult 中，RemovePolicy 决定多少节点成功才算成功，不满足时返回 *RemoveError；
+	远程节点失败时（无论是否满足 RemovePolicy）放入后台重试队列，每隔 Interval 重试一次，直到成功或超过 MaxAttempts 次。
+*/
+
+const (
+	defaultRemoveRetryAttempts = 5
+	defaultRemoveRetryInterval = time.Second
+)
+
+// RemovePolicy 决定 Remove 在多少节点成功后才算成功。
+// 无论哪种策略，key 的副本都需要满足 WriteQuorum；主节点是当前节点、或开启写穿透时，主节点本身必须成功
+type RemovePolicy int
+
+const (
+	RemoveAll       RemovePolicy = iota // 全部节点成功，默认
+	RemoveMajority                      // 超过半数的节点成功
+	RemoveOwnerOnly                     // 只要求 key 的副本满足 WriteQuorum，其他节点失败时只在后台重试
+)
+
+func (p RemovePolicy) String() string {
+	switch p {
+	case RemoveAll:
+		return "all"
+	case RemoveMajority:
+		return "majority"
+	case RemoveOwnerOnly:
+		return "owner-only"
+	}
+	return fmt.Sprintf("RemovePolicy(%d)", int(p))
+}
+
+// RemoveRetryOptions 移除失败的节点在后台重试的配置，零值字段使用默认值
+type RemoveRetryOptions struct {
+	// MaxAttempts 每个节点最多重试的次数，默认 5，小于 0 时不重试
+	MaxAttempts int
+
+	// Interval 两次重试之间的间隔，默认 1s
+	Interval time.Duration
+}
+
+func (o RemoveRetryOptions) withDefaults() RemoveRetryOptions {
+	if o.MaxAttempts == 0 {
+		o.MaxAttempts = defaultRemoveRetryAttempts
+	}
+	if o.Interval <= 0 {
+		o.Interval = defaultRemoveRetryInterval
+	}
+	return o
+}
+
+// PeerResult 一个节点上的移除结果
+type PeerResult struct {
+	Peer  string // 节点名称，当前节点为 "self"
+	Owner bool   // 是否为 key 的副本
+	Err   error  // 为 nil 表示成功
+
+	peer ProtoGetter // 当前节点为 nil
+}
+
+// RemoveError Remove/RemoveByTag/RemoveByPrefix/PurgeAll 未满足 RemovePolicy 时返回，Results 包含每个节点的结果
+type RemoveError struct {
+	Key     string // 按标签或前缀移除时为 "tag=<tag>" 或 "prefix=<prefix>"，PurgeAll 时为 "purge"
+	Policy  RemovePolicy
+	Results []PeerResult
+}
+
+// Failed 返回失败的节点
+func (e *RemoveError) Failed() []PeerResult {
+	var failed []PeerResult
+	for _, r := range e.Results {
+		if r.Err != nil {
+			failed = append(failed, r)
+		}
+	}
+	return failed
+}
+
+func (e *RemoveError) Error() string {
+	failed := e.Failed()
+	msgs := make([]string, len(failed))
+	for i, r := range failed {
+		msgs[i] = fmt.Sprintf("%s: %v", r.Peer, r.Err)
+	}
+	return fmt.Sprintf("remove %s failed on %d/%d peers (policy %s): %s",
+		e.Key, len(failed), len(e.Results), e.Policy, strings.Join(msgs, "; "))
+}
+
+// Unwrap 返回每个失败节点的错误，供 errors.Is/As 使用
+func (e *RemoveError) Unwrap() []error {
+	var errs []error
+	for _, r := range e.Results {
+		if r.Err != nil {
+			errs = append(errs, r.Err)
+		}
+	}
+	return errs
+}
+
+// peerName 返回节点在 PeerResult 中的名称
+func peerName(peer ProtoGetter) string {
+	if peer == nil {
+		return "self"
+	}
+	if s, ok := peer.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T@%p", peer, peer)
+}
+
+// removeFromPeers 并发地对 peers 执行 remove，等待全部完成后按 peers 的顺序返回结果
+func removeFromPeers(peers []ProtoGetter, owner bool, remove func(peer ProtoGetter) error) []PeerResult {
+	results := make([]PeerResult, len(peers))
+	var wg sync.WaitGroup
+	for i, peer := range peers {
+		results[i] = PeerResult{Peer: peerName(peer), Owner: owner, peer: peer}
+		wg.Add(1)
+		go func(r *PeerResult) {
+			defer wg.Done()
+			r.Err = remove(r.peer)
+		}(&results[i])
+	}
+	wg.Wait()
+	return results
+}
+
+// ownersRemoved key 的副本是否满足 WriteQuorum。当前节点为主节点、或开启写穿透时，主节点本身必须成功，
+// 否则数据源可能没有删除，与 Set 相同
+func (g *Group) ownersRemoved(results []PeerResult) bool {
+	var acks int
+	for i, r := range results {
+		if r.Err == nil {
+			acks++
+		} else if i == 0 && (r.peer == nil || g.writer.writesThrough(true)) {
+			return false
+		}
+	}
+	return acks >= quorum(g.writeQuorum, len(results))
+}
+
+// removeSucceeded 全部节点的结果是否满足 RemovePolicy，key 的副本已满足 WriteQuorum
+func (g *Group) removeSucceeded(results []PeerResult) bool {
+	var acks int
+	for _, r := range results {
+		if r.Err == nil {
+			acks++
+		}
+	}
+	switch g.removePolicy {
+	case RemoveOwnerOnly:
+		return true
+	case RemoveMajority:
+		return acks*2 > len(results)
+	}
+	return acks == len(results)
+}
+
+// removeRetrier 后台重试移除失败的远程节点，同一节点上的同一个 key 只保留一个
+type removeRetrier struct {
+	g    *Group
+	opts RemoveRetryOptions
+
+	mu      sync.Mutex
+	pending map[removeTarget]*queuedRemove
+	running bool // 后台协程是否在运行，队列为空时退出
+}
+
+// removeTarget 需要重试的节点与 key，按标签或前缀移除、以及清空 Group 时 key 为空。
+// 节点按 peerName 区分：开启 BoundedLoad 时 PickPeers 每次返回新的包装，不能按 ProtoGetter 比较
+type removeTarget struct {
+	node        string
+	key         string
+	tag, prefix string
+	purge       bool
+}
+
+func (t removeTarget) String() string {
+	switch {
+	case t.purge:
+		return "purge"
+	case t.tag != "":
+		return "tag=" + t.tag
+	case t.key == "":
+		return "prefix=" + t.prefix
+	}
+	return t.key
+}
+
+// removeFrom 在 peer 上重试移除
+func (g *Group) removeFrom(t removeTarget, peer ProtoGetter) error {
+	if t.purge {
+		return g.purgePeer(peer)
+	}
+	if t.key == "" {
+		return g.removeMatchingFromPeer(peer, t.tag, t.prefix)
+	}
+	return g.removeFromPeer(t.key, peer)
+}
+
+type queuedRemove struct {
+	peer     ProtoGetter // 最近一次失败时使用的 ProtoGetter
+	attempts int
+}
+
+func newRemoveRetrier(g *Group, o RemoveRetryOptions) *removeRetrier {
+	return &removeRetrier{
+		g:       g,
+		opts:    o.withDefaults(),
+		pending: make(map[removeTarget]*queuedRemove),
+	}
+}
+
+// add 将失败的远程节点放入队列，当前节点的结果由调用方返回，不重试
+func (r *removeRetrier) add(target removeTarget, results []PeerResult) {
+	if r.opts.MaxAttempts < 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, res := range results {
+		if res.Err == nil || res.peer == nil {
+			continue
+		}
+		target.node = res.Peer
+		r.pending[target] = &queuedRemove{peer: res.peer}
+	}
+	if len(r.pending) > 0 && !r.running {
+		r.running = true
+		go r.loop()
+	}
+}
+
+// len 返回等待重试的数量
+func (r *removeRetrier) len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.pending)
+}
+
+// loop 每隔 Interval 重试队列中的全部条目，队列为空时退出
+func (r *removeRetrier) loop() {
+	for {
+		time.Sleep(r.opts.Interval)
+
+		r.mu.Lock()
+		batch := make(map[removeTarget]*queuedRemove, len(r.pending))
+		for t, q := range r.pending {
+			batch[t] = q
+		}
+		r.mu.Unlock()
+
+		for t, q := range batch {
+			err := r.g.removeFrom(t, q.peer)
+			r.mu.Lock()
+			if r.pending[t] != q { // 重试期间同一个 key 再次失败，以新的条目为准
+				r.mu.Unlock()
+				continue
+			}
+			if err == nil {
+				delete(r.pending, t)
+			} else if q.attempts++; q.attempts >= r.opts.MaxAttempts {
+				log.Printf("remove %s from %s failed after %d retries: %v", t, t.node, q.attempts, err)
+				delete(r.pending, t)
+			}
+			r.mu.Unlock()
+		}
+
+		r.mu.Lock()
+		if len(r.pending) == 0 {
+			r.running = false
+			r.mu.Unlock()
+			return
+		}
+		r.mu.Unlock()
+	}
+}
+
+// PendingRemoves 返回等待后台重试的移除操作数量（节点与 key 的组合）
+func (g *Group) PendingRemoves() int {
+	return g.removeRetry.len()
+}
@@ -0,0 +1,135 @@
+package geecache
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRemovePolicy(t *testing.T) {
+	tests := []struct {
+		policy  RemovePolicy
+		wantErr bool
+	}{
+		{RemoveAll, true},
+		{RemoveMajority, false}, // 5 个节点中 3 个成功
+		{RemoveOwnerOnly, false},
+	}
+	for _, tt := range tests {
+		owner, up, down1, down2 := newFakePeer(false), newFakePeer(false), newFakePeer(true), newFakePeer(true)
+		gp := NewGroupOpts("remove-"+tt.policy.String(), 2<<10, GetterFunc(notFound),
+			&GroupOptions{RemovePolicy: tt.policy, RemoveRetry: RemoveRetryOptions{MaxAttempts: -1}})
+		gp.peers = &fakePicker{replicas: []ProtoGetter{nil, owner}, all: []ProtoGetter{owner, up, down1, down2}}
+		up.data["Tom"] = []byte("630")
+
+		err := gp.Remove("Tom")
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: Remove error = %v, wantErr %v", tt.policy, err, tt.wantErr)
+		}
+		if _, ok := up.data["Tom"]; ok {
+			t.Fatalf("%s: Tom should be removed from reachable peers", tt.policy)
+		}
+		if err == nil {
+			continue
+		}
+		var rerr *RemoveError
+		if !errors.As(err, &rerr) || len(rerr.Results) != 5 {
+			t.Fatalf("%s: want *RemoveError with 5 results, got %v", tt.policy, err)
+		}
+		failed := rerr.Failed()
+		if len(failed) != 2 || failed[0].Owner || failed[0].Peer != peerName(down1) {
+			t.Fatalf("%s: failed peers = %+v, want down1 and down2", tt.policy, failed)
+		}
+	}
+}
+
+func TestRemoveOwnerQuorum(t *testing.T) {
+	owner, other := newFakePeer(true), newFakePeer(false)
+	other.data["Tom"] = []byte("630")
+	gp := NewGroupOpts("remove-owner-quorum", 2<<10, GetterFunc(notFound),
+		&GroupOptions{WriteQuorum: 2, RemovePolicy: RemoveOwnerOnly, RemoveRetry: RemoveRetryOptions{MaxAttempts: -1}})
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil, owner}, all: []ProtoGetter{owner, other}}
+
+	err := gp.Remove("Tom")
+	var rerr *RemoveError
+	if !errors.As(err, &rerr) || len(rerr.Results) != 2 || !rerr.Results[1].Owner {
+		t.Fatalf("Remove should report the owners when write quorum is not reached, got %v", err)
+	}
+	if _, ok := other.data["Tom"]; !ok {
+		t.Fatalf("other peers should not be contacted before owners succeed")
+	}
+}
+
+func TestRemoveRetry(t *testing.T) {
+	flaky, dead := newFakePeer(true), newFakePeer(true)
+	flaky.data["Tom"] = []byte("630")
+	dead.data["Tom"] = []byte("630")
+	gp := NewGroupOpts("remove-retry", 2<<10, GetterFunc(notFound),
+		&GroupOptions{RemoveRetry: RemoveRetryOptions{MaxAttempts: 3, Interval: 10 * time.Millisecond}})
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil}, all: []ProtoGetter{flaky, dead}}
+
+	if err := gp.Remove("Tom"); err == nil {
+		t.Fatalf("Remove should fail while peers are down")
+	}
+	if n := gp.PendingRemoves(); n != 2 {
+		t.Fatalf("PendingRemoves = %d, want 2", n)
+	}
+
+	flaky.mu.Lock()
+	flaky.down = false
+	flaky.mu.Unlock()
+	waitFor(t, "retries to finish", func() bool { return gp.PendingRemoves() == 0 })
+
+	flaky.mu.Lock()
+	defer flaky.mu.Unlock()
+	if _, ok := flaky.data["Tom"]; ok {
+		t.Fatalf("Tom should be removed from the recovered peer")
+	}
+	dead.mu.Lock()
+	defer dead.mu.Unlock()
+	if _, ok := dead.data["Tom"]; !ok {
+		t.Fatalf("dead peer should be given up after MaxAttempts")
+	}
+}
+
+// wrappedPeer 模拟 BoundedLoad 下 PickPeers 每次返回的新包装，节点名称不变
+type wrappedPeer struct {
+	*fakePeer
+}
+
+func (p wrappedPeer) String() string {
+	return "groupcache/127.0.0.1:8002"
+}
+
+// 同一节点上同一个 key 只保留一个重试，即使每次 Remove 得到的 ProtoGetter 不同
+func TestRemoveRetryDedup(t *testing.T) {
+	down := newFakePeer(true)
+	gp := NewGroupOpts("remove-retry-dedup", 2<<10, GetterFunc(notFound),
+		&GroupOptions{RemovePolicy: RemoveOwnerOnly, RemoveRetry: RemoveRetryOptions{Interval: time.Hour}})
+	for i := 0; i < 3; i++ {
+		gp.peers = &fakePicker{replicas: []ProtoGetter{nil}, all: []ProtoGetter{&wrappedPeer{down}}}
+		if err := gp.Remove("Tom"); err != nil {
+			t.Fatalf("Remove with RemoveOwnerOnly should succeed: %v", err)
+		}
+	}
+	if n := gp.PendingRemoves(); n != 1 {
+		t.Fatalf("PendingRemoves = %d, want 1", n)
+	}
+}
+
+func TestRemoveErrorMessage(t *testing.T) {
+	err := &RemoveError{Key: "Tom", Policy: RemoveMajority, Results: []PeerResult{
+		{Peer: "self", Owner: true},
+		{Peer: "groupcache/127.0.0.1:8002", Err: errUnavailable},
+		{Peer: "groupcache/127.0.0.1:8003", Err: fmt.Errorf("peer down")},
+	}}
+	want := "remove Tom failed on 2/3 peers (policy majority): groupcache/127.0.0.1:8002: " +
+		errUnavailable.Error() + "; groupcache/127.0.0.1:8003: peer down"
+	if err.Error() != want {
+		t.Fatalf("Error() = %q, want %q", err.Error(), want)
+	}
+	if !errors.Is(err, errUnavailable) {
+		t.Fatalf("RemoveError should unwrap to per-peer errors")
+	}
+}
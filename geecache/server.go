@@ -3,11 +3,14 @@ package geecache
 import (
 	"context"
 	"fmt"
+	"geecache/breaker"
 	"geecache/consistenthash"
 	pb "geecache/geecachepb"
 	"geecache/registry"
+	clientv3 "go.etcd.io/etcd/client/v3"
 	"google.golang.org/grpc"
-	"google.golang.org/protobuf/proto"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/protobuf/types/known/emptypb"
 	"log"
 	"net"
@@ -17,10 +20,68 @@ import (
 )
 
 const (
-	defaultAddr     = "127.0.0.1:8090"
-	defaultReplicas = 50
+	defaultAddr        = "127.0.0.1:8090"
+	defaultReplicas    = 50
+	defaultReplication = 1
+	defaultHealthCheck = 5 * time.Second
+	defaultCooldown    = 10 * time.Second
 )
 
+// serviceName 节点注册到 etcd 时使用的服务名
+const serviceName = "groupcache"
+
+// healthService 注册到标准 gRPC 健康检查服务中的服务名
+var healthService = pb.GroupCache_ServiceDesc.ServiceName
+
+// ServerOptions Server 的可选配置，零值字段使用默认值
+type ServerOptions struct {
+	// Replicas 一致性哈希时，key 翻倍的倍数。如果为空，则默认为 50
+	Replicas int
+
+	// HashFn 指定哈希函数。若不指定则，则默认 crc32.ChecksumIEEE.
+	HashFn consistenthash.HashFunc
+
+	// Placement 指定 key 到节点的放置算法，例如 consistenthash.NewRendezvous、NewJump、NewMaglev。
+	// 如果为空，则默认使用由 Replicas 和 HashFn 构造的一致性哈希环
+	Placement consistenthash.Placement
+
+	// Handoff 哈希环变化时，是否以及如何把不再属于当前节点的 key 交给新的所有者
+	Handoff HandoffOptions
+
+	// Warmup 节点启动时，在注册到 etcd 之前从其他节点或快照文件预热 mainCache
+	Warmup WarmupOptions
+
+	// Snapshot 定期将全部 group 的缓存保存到快照文件，配合 Warmup.SnapshotFile 使计划内的重启保持缓存热度
+	Snapshot SnapshotOptions
+
+	// Invalidation 失效总线：写入成功后通知其他节点丢弃 hotCache 中的旧副本，断线重连后补发错过的事件
+	Invalidation InvalidationOptions
+
+	// LoadBound 大于 0 时启用有界负载：统计发往每个节点的进行中请求，节点负载超过 (1+LoadBound)×平均负载时，
+	// Get 溢出到偏好列表中的下一个健康节点，该节点从副本读取并存入 hotCache，不会直接查询数据源。默认不启用
+	LoadBound float64
+
+	// ReplicationFactor 每个 key 保存在哈希环上多少个不同的后继节点中。如果为空，则默认为 1，即只有一个主节点
+	ReplicationFactor int
+
+	// Weight 当前节点在一致性哈希中的权重，随地址一起注册到 etcd，供 DiscoverPeers 使用。
+	// 如果为空，则默认为 1
+	Weight int
+
+	// Client 访问远程节点时的超时、重试与对冲请求配置
+	Client ClientOptions
+
+	// Breaker 每个远程节点的熔断器配置。熔断期间 PickPeers 改用哈希环上的下一个后继节点
+	Breaker breaker.Options
+
+	// FailoverCooldown 远程节点不可达一次后，在多长时间内被视为不健康，期间 PickPeers 同样改用下一个后继节点，
+	// 不必等待熔断器积累足够的失败次数。如果为空，则默认为 10s；小于 0 时只依赖熔断器
+	FailoverCooldown time.Duration
+
+	// HealthCheckInterval 主动健康检查的间隔，如果为空，则默认为 5s；小于 0 时不进行主动健康检查
+	HealthCheckInterval time.Duration
+}
+
 type Server struct {
 	pb.UnimplementedGroupCacheServer
 
@@ -28,34 +89,103 @@ type Server struct {
 	status     bool       // true: running false: stop
 	stopSignal chan error // 通知registry revoke服务
 
-	replicas int                     // 一致性哈希时，key 翻倍的倍数。如果为空，则默认为 50
-	hashFunc consistenthash.HashFunc // 指定哈希函数。若不指定则，则默认 crc32.ChecksumIEEE.
+	replicas     int                     // 一致性哈希时，key 翻倍的倍数。如果为空，则默认为 50
+	hashFunc     consistenthash.HashFunc // 指定哈希函数。若不指定则，则默认 crc32.ChecksumIEEE.
+	replication  int                     // 每个 key 的副本节点数
+	weight       int                     // 当前节点的权重
+	clientOpts   ClientOptions           // 访问远程节点时的超时、重试与对冲请求配置
+	breakerOpts  breaker.Options         // 每个远程节点的熔断器配置
+	cooldown     time.Duration           // 节点不可达后被标记为不健康的时长
+	healthCheck  time.Duration           // 主动健康检查的间隔
+	handoffOpts  HandoffOptions          // 哈希环变化时的 key 交接配置
+	warmupOpts   WarmupOptions           // 启动时的预热配置
+	snapshotOpts SnapshotOptions         // 定期保存快照的配置
+
+	invalidationOpts InvalidationOptions // 失效总线的配置
+	invalidations    *invalidationLog    // 本节点发布的失效事件，未开启失效总线时为 nil
+
+	updateMu sync.Mutex // 串行化哈希环的更新，WarmBeforeSwitch 交接期间不持有 mu
 
 	mu      sync.Mutex
-	peers   *consistenthash.ConsistHash
-	clients map[string]*client // keyed by e.g. "http://10.0.0.2:8008"
+	peers   consistenthash.Placement
+	bounded *consistenthash.Bounded // 启用有界负载时与 peers 相同，否则为 nil
+	clients map[string]*client      // keyed by e.g. "http://10.0.0.2:8008"
 }
 
 var serverMade bool
 
 func NewServer(addr string, replicas int, hashFunc consistenthash.HashFunc) *Server {
+	return NewServerOpts(addr, &ServerOptions{
+		Replicas: replicas,
+		HashFn:   hashFunc,
+	})
+}
+
+// NewServerOpts 与 NewServer 相同，但允许通过 ServerOptions 指定更多配置
+func NewServerOpts(addr string, o *ServerOptions) *Server {
 	if serverMade {
 		panic("groupcache: NewServer must be called only once")
 	}
+	s := newServer(addr, o)
+
+	RegisterPeerPicker(s) // 将新建的 Server 注册到全局，不同的 Group 共享相同的 Server 池。
+	return s
+}
+
+// newServer 只负责实例化 Server，不注册到全局
+func newServer(addr string, o *ServerOptions) *Server {
 	if addr == "" {
 		addr = defaultAddr
 	}
-	if replicas == 0 {
-		replicas = defaultReplicas
-	}
 	s := &Server{
-		addr:     addr,
-		replicas: replicas,
-		hashFunc: hashFunc,
-		// peers and clients 会在 SetPeers() 中初始化，此函数不负责初始化
+		addr:        addr,
+		replicas:    defaultReplicas,
+		replication: defaultReplication,
+		healthCheck: defaultHealthCheck,
+		cooldown:    defaultCooldown,
 	}
-
-	RegisterPeerPicker(s) // 将新建的 Server 注册到全局，不同的 Group 共享相同的 Server 池。
+	if o != nil {
+		if o.Replicas != 0 {
+			s.replicas = o.Replicas
+		}
+		if o.ReplicationFactor != 0 {
+			s.replication = o.ReplicationFactor
+		}
+		if o.HealthCheckInterval != 0 {
+			s.healthCheck = o.HealthCheckInterval
+		}
+		if o.FailoverCooldown > 0 {
+			s.cooldown = o.FailoverCooldown
+		} else if o.FailoverCooldown < 0 {
+			s.cooldown = 0
+		}
+		s.clientOpts = o.Client
+		s.breakerOpts = o.Breaker
+		s.handoffOpts = o.Handoff
+		s.warmupOpts = o.Warmup
+		s.snapshotOpts = o.Snapshot
+		s.invalidationOpts = o.Invalidation
+		s.hashFunc = o.HashFn
+		s.weight = o.Weight
+		s.peers = o.Placement
+	}
+	if s.peers == nil {
+		s.peers = consistenthash.New(s.replicas, s.hashFunc)
+	}
+	if o != nil && o.LoadBound > 0 {
+		s.bounded = consistenthash.NewBounded(s.peers, o.LoadBound)
+		s.peers = s.bounded
+	}
+	if s.invalidationOpts.Enabled {
+		if s.invalidationOpts.LogSize <= 0 {
+			s.invalidationOpts.LogSize = defaultInvalidationLogSize
+		}
+		if s.invalidationOpts.RetryInterval <= 0 {
+			s.invalidationOpts.RetryInterval = defaultInvalidationRetry
+		}
+		s.invalidations = newInvalidationLog(s.invalidationOpts.LogSize)
+	}
+	s.clients = make(map[string]*client)
 	return s
 }
 
@@ -67,24 +197,96 @@ func (s *Server) Log(formate string, v ...interface{}) {
 // SetPeers 更新 Server 中一致性哈希的节点，形成新的分布式节点
 // 每个peer的name，都必须是有效的groupcache/ip+port，例如：groupcache/127.0.0.1:8000
 func (s *Server) SetPeers(peers ...string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.peers = consistenthash.New(s.replicas, s.hashFunc)
-	s.peers.AddNode(peers...) // 添加节点
-
-	s.clients = make(map[string]*client, len(peers))
+	weights := make(map[string]int, len(peers))
 	for _, peer := range peers {
+		weights[peer] = 1
+	}
+	s.SetWeightedPeers(weights)
+}
+
+// SetWeightedPeers 与 SetPeers 相同，但为每个节点指定权重，节点分到的 key 的比例与权重成正比，
+// 适用于内存大小不同的机器混合部署的集群。
+// 哈希环只增删有变化的节点，未变化节点的客户端（及其连接、熔断状态）被保留。
+// 开启 HandoffOptions 时，不再属于当前节点的 key 会交给新的所有者
+func (s *Server) SetWeightedPeers(peers map[string]int) {
+	for peer := range peers {
 		if !validPeerAddr(peer) {
 			panic(fmt.Sprintf("[peer %s] invalid address format, it should be x.x.x.x:port", peer))
 		}
-		s.clients[peer] = &client{name: "groupcache/" + peer} // 生成每个客户端的请求路径，每个请求路径都对应一个节点
 	}
+	s.updatePeers(peers)
+}
+
+// newPeerClient 按 Server 的配置生成节点 peer 的客户端，请求路径与节点一一对应
+func (s *Server) newPeerClient(peer string) *client {
+	c := newClient("groupcache/"+peer, s.clientOpts, s.breakerOpts)
+	c.cooldown = s.cooldown
+	return c
+}
+
+// applyPeers 切换哈希环，并增删对应的客户端
+func (s *Server) applyPeers(peers map[string]int) (added, removed []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ring, isRing := s.peers.(*consistenthash.ConsistHash)
+	var old *consistenthash.ConsistHash
+	if isRing {
+		old = ring.Clone()
+	}
+	added, removed = s.peers.SetNodes(peers) // 增删节点
+
+	for _, peer := range removed {
+		delete(s.clients, peer)
+	}
+	for _, peer := range added {
+		if _, ok := s.clients[peer]; !ok {
+			s.clients[peer] = s.newPeerClient(peer)
+		}
+	}
+	if len(added) == 0 && len(removed) == 0 {
+		return added, removed
+	}
+	if isRing {
+		s.Log("peers updated: added %v, removed %v, %d key ranges moved",
+			added, removed, len(consistenthash.MovedRanges(old, ring)))
+	} else {
+		s.Log("peers updated: added %v, removed %v", added, removed)
+	}
+	return added, removed
+}
+
+// DiscoverPeers 从 etcd 中发现所有已注册的节点，按照节点注册时携带的权重更新哈希环
+func (s *Server) DiscoverPeers() error {
+	cli, err := clientv3.New(defaultEtcdConfig)
+	if err != nil {
+		return fmt.Errorf("create etcd client failed: %v", err)
+	}
+	defer cli.Close()
+
+	services, err := registry.Discover(cli, serviceName)
+	if err != nil {
+		return fmt.Errorf("discover peers failed: %v", err)
+	}
+	peers := make(map[string]int, len(services))
+	for addr, md := range services {
+		peers[addr] = md.Weight
+	}
+	s.SetWeightedPeers(peers)
+	return nil
 }
 
 // PickPeer 封装了一致性哈希算法的 FindNode() 方法，根据具体的 key，选择节点，返回节点对应的 HTTP 客户端。
+// 启用有界负载时返回的客户端按请求统计负载，见 boundedPeer
 func (s *Server) PickPeer(key string) (ProtoGetter, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if s.bounded != nil {
+		nodes := s.peers.FindNodes(key, len(s.clients))
+		if len(nodes) == 0 || nodes[0] == s.addr {
+			return nil, false
+		}
+		return s.newBoundedPeer(nodes[0], nodes), true
+	}
 	if peer := s.peers.FindNode(key); peer != "" && peer != s.addr { //如果节点是自己，则会陷入循环。
 		s.Log("Pick peer %s", peer)
 		return s.clients[peer], true
@@ -92,6 +294,135 @@ func (s *Server) PickPeer(key string) (ProtoGetter, bool) {
 	return nil, false
 }
 
+// PickPeers 封装了一致性哈希算法的 FindNodes() 方法，返回 key 对应的 replication 个副本节点的客户端，
+// 首个为主节点。若当前节点也是副本之一，则对应位置为 nil。
+// 不健康的远程副本会被哈希环上后续的健康节点顶替；当前节点只在本身就是副本时出现，从不作为顶替者，
+// 以免把不属于自己的 key 存入 mainCache。找不到顶替者时保留原副本，仍然尝试访问。
+// 启用有界负载时，远程副本被包装为 boundedPeer，副本的选择不受负载影响
+func (s *Server) PickPeers(key string) []ProtoGetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	nodes := s.peers.FindNodes(key, len(s.clients)) // 完整的偏好列表，前 replication 个为副本
+	if len(nodes) == 0 {
+		return []ProtoGetter{nil}
+	}
+	n := s.replication
+	if n > len(nodes) {
+		n = len(nodes)
+	}
+
+	peers := make([]ProtoGetter, n)
+	next := n // 下一个可作为顶替者的后继节点
+	for i, node := range nodes[:n] {
+		if node == s.addr {
+			continue
+		}
+		picked := node
+		if !s.clients[node].healthy() {
+			for ; next < len(nodes); next++ {
+				if nodes[next] != s.addr && s.clients[nodes[next]].healthy() {
+					s.Log("peer %s is unhealthy, failover to %s", node, nodes[next])
+					picked = nodes[next]
+					next++
+					break
+				}
+			}
+		}
+		if s.bounded != nil {
+			peers[i] = s.newBoundedPeer(picked, nodes)
+		} else {
+			peers[i] = s.clients[picked]
+		}
+	}
+	return peers
+}
+
+// newBoundedPeer 包装节点 node 的客户端，偏好列表 nodes 中其余健康的远程节点作为溢出的候选。调用方持有 s.mu
+func (s *Server) newBoundedPeer(node string, nodes []string) *boundedPeer {
+	spill := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		if n != node && n != s.addr && s.clients[n].healthy() {
+			spill = append(spill, n)
+		}
+	}
+	return &boundedPeer{client: s.clients[node], s: s, node: node, spill: spill}
+}
+
+// boundedPeer 包装 PickPeer、PickPeers 返回的客户端，每个请求期间计入节点的负载，请求结束后释放。
+// 节点的负载已满时，Get 溢出到 spill 中第一个未满的节点，并标记为 Spill，由接收方从副本读取；
+// 写入等其他请求必须由副本处理，只计入负载，不会溢出
+type boundedPeer struct {
+	*client
+	s     *Server
+	node  string
+	spill []string
+}
+
+// acquire 计入节点的负载，返回的函数在请求结束后释放
+func (p *boundedPeer) acquire() (release func()) {
+	node := p.s.bounded.AcquireFrom(p.node, nil)
+	return func() { p.s.bounded.Release(node) }
+}
+
+func (p *boundedPeer) Get(in *pb.Request, out *pb.Response) error {
+	node := p.s.bounded.AcquireFrom(p.node, p.spill)
+	defer p.s.bounded.Release(node)
+	if node == p.node {
+		return p.client.Get(in, out)
+	}
+	p.s.mu.Lock()
+	c := p.s.clients[node]
+	p.s.mu.Unlock()
+	if c == nil { // 节点已被移除
+		return p.client.Get(in, out)
+	}
+	p.s.Log("peer %s is overloaded, spill %s to %s", p.node, in.Key, node)
+	req := getRequest(in.Group, in.Key)
+	defer putRequest(req)
+	req.Spill = true
+	return c.Get(req, out)
+}
+
+// withoutSpill 去掉 boundedPeer 的包装，溢出的查询直接发给副本，不会再次溢出
+func withoutSpill(peers []ProtoGetter) []ProtoGetter {
+	for i, peer := range peers {
+		if p, ok := peer.(*boundedPeer); ok {
+			peers[i] = p.client
+		}
+	}
+	return peers
+}
+
+func (p *boundedPeer) Set(in *pb.SetRequest) error {
+	defer p.acquire()()
+	return p.client.Set(in)
+}
+
+func (p *boundedPeer) Remove(in *pb.Request) error {
+	defer p.acquire()()
+	return p.client.Remove(in)
+}
+
+func (p *boundedPeer) CompareAndSet(in *pb.CompareAndSetRequest, out *pb.CompareAndSetResponse) error {
+	defer p.acquire()()
+	return p.client.CompareAndSet(in, out)
+}
+
+func (p *boundedPeer) Incr(in *pb.IncrRequest, out *pb.IncrResponse) error {
+	defer p.acquire()()
+	return p.client.Incr(in, out)
+}
+
+func (p *boundedPeer) RemoveMatching(in *pb.RemoveMatchingRequest, out *pb.RemoveMatchingResponse) error {
+	defer p.acquire()()
+	return p.client.RemoveMatching(in, out)
+}
+
+func (p *boundedPeer) Purge(in *pb.PurgeRequest) error {
+	defer p.acquire()()
+	return p.client.Purge(in)
+}
+
 func (s *Server) GetAll() (peers []ProtoGetter) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -113,15 +444,15 @@ func (s *Server) Get(ctx context.Context, in *pb.Request) (*pb.Response, error)
 	}
 	s.Log("执行Get中找到数据组group：%v", group.name)
 
-	view, err := group.Query(key) // 查询数据组对应的缓存
+	view, err := group.getForPeer(key, in.Spill) // 查询数据组对应的缓存，只有溢出的查询才会再访问副本
 	if err != nil {
 		return out, fmt.Errorf(err.Error())
 	}
 
-	out.Value, err = proto.Marshal(&pb.Response{Value: view.ByteSlice()})
-	if err != nil {
-		return out, fmt.Errorf(err.Error())
-	}
+	out.Value = view.encoded() // 缓存值只读，直接发送不必拷贝；压缩的值原样发送，由接收方解压
+	out.Compressed = view.z
+	out.Version = view.v
+	out.Tags = view.t
 	return out, nil
 }
 
@@ -132,13 +463,21 @@ func (s *Server) Put(ctx context.Context, in *pb.SetRequest) (*emptypb.Empty, er
 	}
 	s.Log("执行Put中找到数据组group：%v", group.name)
 
-	var expire time.Time
-	if in.Expire != 0 {
-		expire = time.Unix(in.Expire/int64(time.Second), in.Expire%int64(time.Second))
-	}
+	view := ByteView{b: in.Value, e: fromUnixNano(in.Expire), v: in.Version, t: in.Tags, z: in.Compressed}
 
-	group.localSet(in.Key, in.Value, expire, &group.mainCache)
-	return new(emptypb.Empty), nil
+	// 副本全部不可用时，当前节点可能只是顶替者，此时只写入 hotCache，数据源按 substituteWrite 处理
+	group.peersOnce.Do(group.initPeers)
+	var err error
+	if replicas := group.peers.PickPeers(in.Key); isReplica(replicas) {
+		err = group.ownerSet(isPrimary(replicas), in.Key, view)
+	} else if b, rerr := view.raw(); rerr != nil {
+		err = rerr
+	} else {
+		err = group.substituteWrite(WriteOp{Key: in.Key, Value: b, Expire: view.e}, func() {
+			group.localSet(in.Key, view, &group.hotCache)
+		})
+	}
+	return new(emptypb.Empty), err
 }
 
 func (s *Server) Delete(ctx context.Context, in *pb.Request) (*emptypb.Empty, error) {
@@ -148,8 +487,16 @@ func (s *Server) Delete(ctx context.Context, in *pb.Request) (*emptypb.Empty, er
 	}
 	s.Log("执行Delete中找到数据组group：%v", group.name)
 
-	group.localRemove(in.GetKey())
-	return new(emptypb.Empty), nil
+	group.peersOnce.Do(group.initPeers)
+	var err error
+	if replicas := group.peers.PickPeers(in.GetKey()); isReplica(replicas) {
+		err = group.ownerRemove(isPrimary(replicas), in.GetKey())
+	} else {
+		err = group.substituteWrite(WriteOp{Key: in.GetKey(), Delete: true}, func() {
+			group.localRemove(in.GetKey())
+		})
+	}
+	return new(emptypb.Empty), err
 }
 
 // -----------------启动服务----------------------
@@ -184,13 +531,34 @@ func (s *Server) Start() error {
 	gs := grpc.NewServer()             // 创建gRPC服务器
 	pb.RegisterGroupCacheServer(gs, s) // 在gRPC服务端注册服务
 
-	// 将服务注册至 etcd
+	// 注册标准的 gRPC 健康检查服务，供其他节点主动探测
+	hs := health.NewServer()
+	hs.SetServingStatus(healthService, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(gs, hs)
+
+	stopBackground := make(chan struct{}) // 通知健康检查、定期快照与失效事件订阅退出
+	if s.healthCheck > 0 {
+		go s.probePeers(stopBackground)
+	}
+	if s.snapshotOpts.File != "" {
+		go s.snapshotLoop(stopBackground)
+	}
+	if s.invalidations != nil {
+		go s.invalidationLoop(stopBackground)
+	}
+
+	// 预热后将服务注册至 etcd
 	go func() {
+		if s.warmupOpts.FromPeers || s.warmupOpts.SnapshotFile != "" {
+			s.warmup()
+		}
 		// Register never return unless stop signal received
-		erro := registry.RegisterServiceToETCD("groupcache", s.addr, s.stopSignal)
+		erro := registry.RegisterServiceWithMetadata(serviceName, s.addr, registry.Metadata{Weight: s.weight}, s.stopSignal)
 		if erro != nil {
 			log.Fatalf(erro.Error())
 		}
+		hs.Shutdown() // 通知其他节点本节点不再提供服务
+		close(stopBackground)
 		close(s.stopSignal) // Close channel
 		if erro = lis.Close(); erro != nil {
 			log.Fatalf(erro.Error())
@@ -207,6 +575,55 @@ func (s *Server) Start() error {
 	return nil
 }
 
+// probePeers 每隔 healthCheck 对所有远程节点做一次健康检查，直到 stop 被关闭。
+// 健康检查失败的节点被熔断，无需调用 SetPeers 重建哈希环即可被 PickPeers 暂时排除
+func (s *Server) probePeers(stop chan struct{}) {
+	ticker := time.NewTicker(s.healthCheck)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		clients := make([]*client, 0, len(s.clients))
+		for addr, c := range s.clients {
+			if addr != s.addr {
+				clients = append(clients, c)
+			}
+		}
+		s.mu.Unlock()
+
+		var wg sync.WaitGroup
+		for _, c := range clients {
+			wg.Add(1)
+			go func(c *client) {
+				c.probe()
+				wg.Done()
+			}(c)
+		}
+		wg.Wait()
+	}
+}
+
+// toUnixNano 将过期时间转换为 SetRequest.Expire，零值表示永不过期
+func toUnixNano(expire time.Time) int64 {
+	if expire.IsZero() {
+		return 0
+	}
+	return expire.UnixNano()
+}
+
+// fromUnixNano 将 SetRequest.Expire 转换为过期时间
+func fromUnixNano(e int64) time.Time {
+	if e == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, e)
+}
+
 // 判断是否满足 x.x.x.x:port 的格式
 func validPeerAddr(addr string) bool {
 	ss := strings.Split(addr, ":")
@@ -1,8 +1,16 @@
 package geecache
 
 import (
+	"context"
+	"geecache/breaker"
+	"geecache/consistenthash"
+	pb "geecache/geecachepb"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestValidAddr(t *testing.T) {
@@ -56,3 +64,235 @@ func Test_PeerRelation(t *testing.T) {
 		}
 	}
 }
+
+func TestPickPeers(t *testing.T) {
+	addrs := []string{"127.0.0.1:8001", "127.0.0.1:8002", "127.0.0.1:8003"}
+	s := newServer("127.0.0.1:8001", &ServerOptions{ReplicationFactor: 2})
+	s.SetPeers(addrs...)
+
+	for _, key := range []string{"tom", "jack", "sam", "amy"} {
+		nodes := s.peers.FindNodes(key, 2)
+		peers := s.PickPeers(key)
+		if len(peers) != 2 {
+			t.Fatalf("PickPeers(%s) returned %d peers, want 2", key, len(peers))
+		}
+		for i, node := range nodes {
+			if node == s.addr {
+				if peers[i] != nil {
+					t.Errorf("PickPeers(%s)[%d] should be nil for self", key, i)
+				}
+				continue
+			}
+			if peers[i].(*client).name != "groupcache/"+node {
+				t.Errorf("PickPeers(%s)[%d] = %s, want %s", key, i, peers[i].(*client).name, node)
+			}
+		}
+	}
+}
+
+func TestPickPeersFailover(t *testing.T) {
+	addrs := []string{"127.0.0.1:8001", "127.0.0.1:8002", "127.0.0.1:8003"}
+	s := newServer("127.0.0.1:8001", nil)
+	s.SetPeers(addrs...)
+
+	// 找一个主节点为远程节点，且第二顺位也是远程节点的 key
+	var key string
+	var nodes []string
+	for _, k := range []string{"tom", "jack", "sam", "amy", "john", "lisa"} {
+		if nodes = s.peers.FindNodes(k, 3); nodes[0] != s.addr && nodes[1] != s.addr {
+			key = k
+			break
+		}
+	}
+	if key == "" {
+		t.Skip("no suitable key found")
+	}
+
+	s.clients[nodes[0]].markUnhealthy(time.Minute)
+	peers := s.PickPeers(key)
+	if len(peers) != 1 || peers[0].(*client).name != "groupcache/"+nodes[1] {
+		t.Fatalf("unhealthy owner %s should be replaced by %s", nodes[0], nodes[1])
+	}
+
+	// 后继节点也不健康（熔断）时，当前节点不会顶替，保留原主节点
+	s.clients[nodes[1]].breaker.Trip()
+	peers = s.PickPeers(key)
+	if len(peers) != 1 || peers[0] == nil || peers[0].(*client).name != "groupcache/"+nodes[0] {
+		t.Fatalf("should keep the original owner when no healthy successor exists")
+	}
+}
+
+func TestSetWeightedPeers(t *testing.T) {
+	s := newServer("127.0.0.1:8001", nil)
+	s.SetWeightedPeers(map[string]int{
+		"127.0.0.1:8001": 1,
+		"127.0.0.1:8002": 8,
+		"127.0.0.1:8003": 0, // 按权重 1 处理
+	})
+	if len(s.clients) != 3 {
+		t.Fatalf("SetWeightedPeers should create 3 clients, got %d", len(s.clients))
+	}
+	for addr, w := range map[string]int{"127.0.0.1:8001": 1, "127.0.0.1:8002": 8, "127.0.0.1:8003": 1} {
+		if got := s.peers.Weight(addr); got != w {
+			t.Errorf("weight of %s = %d, want %d", addr, got, w)
+		}
+	}
+}
+
+// 重新设置节点时，只增删有变化的节点，未变化节点的客户端被保留
+func TestSetPeersIncremental(t *testing.T) {
+	s := newServer("127.0.0.1:8001", nil)
+	s.SetPeers("127.0.0.1:8001", "127.0.0.1:8002", "127.0.0.1:8003")
+	kept := s.clients["127.0.0.1:8002"]
+
+	s.SetPeers("127.0.0.1:8001", "127.0.0.1:8002", "127.0.0.1:8004")
+	if s.clients["127.0.0.1:8002"] != kept {
+		t.Errorf("client of unchanged peer should be kept")
+	}
+	if _, ok := s.clients["127.0.0.1:8003"]; ok {
+		t.Errorf("client of removed peer should be dropped")
+	}
+	if _, ok := s.clients["127.0.0.1:8004"]; !ok {
+		t.Errorf("client of added peer should be created")
+	}
+	if nodes := s.peers.Nodes(); len(nodes) != 3 || nodes[2] != "127.0.0.1:8004" {
+		t.Errorf("ring nodes = %v", nodes)
+	}
+}
+
+func TestServerPlacement(t *testing.T) {
+	addrs := []string{"127.0.0.1:8001", "127.0.0.1:8002", "127.0.0.1:8003"}
+	s := newServer("127.0.0.1:8001", &ServerOptions{
+		Placement:         consistenthash.NewRendezvous(nil),
+		ReplicationFactor: 2,
+	})
+	if _, ok := s.PickPeer("tom"); ok {
+		t.Fatalf("PickPeer should find nothing before SetPeers")
+	}
+	s.SetPeers(addrs...)
+
+	for _, key := range []string{"tom", "jack", "sam", "amy"} {
+		nodes := s.peers.FindNodes(key, 2)
+		peer, ok := s.PickPeer(key)
+		if (nodes[0] != s.addr) != ok || ok && peer.(*client).name != "groupcache/"+nodes[0] {
+			t.Errorf("PickPeer(%s) should follow the rendezvous placement %v", key, nodes)
+		}
+		if peers := s.PickPeers(key); len(peers) != 2 {
+			t.Errorf("PickPeers(%s) returned %d peers, want 2", key, len(peers))
+		}
+	}
+}
+
+// 热点 key 的请求积压时，主节点的负载不超过上限，多余的查询溢出到其他节点，且不会查询数据源
+func TestPickPeersBoundedLoad(t *testing.T) {
+	addrs := []string{"127.0.0.1:8001", "127.0.0.1:8002", "127.0.0.1:8003", "127.0.0.1:8004"}
+	s := newServer("127.0.0.1:8001", &ServerOptions{LoadBound: 0.25})
+	s.SetPeers(addrs...)
+	hold := make(chan struct{})
+	fakes := make(map[string]*faultyGrpcClient)
+	for _, addr := range addrs[1:] {
+		fakes[addr] = &faultyGrpcClient{hold: hold, value: []byte("630")}
+		s.clients[addr] = newFakeClient(fakes[addr], ClientOptions{}, breaker.Options{})
+	}
+
+	// 找一个主节点不是自己的节点，以及 40 个属于它的 key
+	var owner string
+	var keys []string
+	for i := 0; len(keys) < 40; i++ {
+		key := "tom" + strconv.Itoa(i)
+		node := s.peers.FindNodes(key, 1)[0]
+		if owner == "" && node != s.addr {
+			owner = node
+		}
+		if node == owner {
+			keys = append(keys, key)
+		}
+	}
+
+	var loads atomic.Int32
+	gp := NewGroup("bounded-load", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads.Add(1)
+		return []byte("630"), nil
+	}))
+	gp.peers = s
+
+	var wg sync.WaitGroup
+	for _, key := range keys {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			if view, err := gp.Query(key); err != nil || view.String() != "630" {
+				t.Errorf("Query(%s) = %q, %v", key, view, err)
+			}
+		}(key)
+	}
+	// 全部查询都在进行中之后才返回
+	waitFor(t, "all queries in flight", func() bool {
+		var calls int
+		for _, f := range fakes {
+			calls += f.callCount()
+		}
+		return calls == len(keys)
+	})
+	close(hold)
+	wg.Wait()
+
+	var spills int
+	for addr, f := range fakes {
+		if addr != owner {
+			spills += f.spills
+		}
+	}
+	// 当前节点不接收自己的查询，三个远程节点的上限之和 3×ceil(1.25×40/4) 不足 40 个，超出的查询分给余量最大的节点
+	if n := fakes[owner].callCount(); n == 0 || n > 14 || n+spills != len(keys) {
+		t.Errorf("owner %s served %d of %d in-flight queries and %d spilled, want at most 14 on the owner", owner, n, len(keys), spills)
+	}
+	if loads.Load() != 0 {
+		t.Errorf("spilled queries should not load from the getter, loads = %d", loads.Load())
+	}
+
+	// 其他请求只计入负载，结束后同样释放
+	peer := s.PickPeers(keys[0])[0]
+	peer.Set(&pb.SetRequest{Key: keys[0]})
+	peer.Remove(&pb.Request{Key: keys[0]})
+	peer.CompareAndSet(&pb.CompareAndSetRequest{Key: keys[0]}, &pb.CompareAndSetResponse{})
+	peer.Incr(&pb.IncrRequest{Key: keys[0]}, &pb.IncrResponse{})
+	peer.RemoveMatching(&pb.RemoveMatchingRequest{}, &pb.RemoveMatchingResponse{})
+	peer.Purge(&pb.PurgeRequest{})
+	for _, addr := range addrs {
+		if load := s.bounded.Load(addr); load != 0 {
+			t.Errorf("load of %s = %d after all requests finished", addr, load)
+		}
+	}
+}
+
+// 溢出的查询到达非副本节点时，从副本读取并存入 hotCache，不查询数据源
+func TestGetSpilled(t *testing.T) {
+	addrs := []string{"127.0.0.1:8001", "127.0.0.1:8002", "127.0.0.1:8003"}
+	s := newServer("127.0.0.1:8001", &ServerOptions{LoadBound: 0.25})
+	s.SetPeers(addrs...)
+	key := "tom"
+	for i := 0; s.peers.FindNodes(key, 1)[0] == s.addr; i++ {
+		key = "tom" + strconv.Itoa(i)
+	}
+	owner := &faultyGrpcClient{value: []byte("from owner")}
+	s.clients[s.peers.FindNodes(key, 1)[0]] = newFakeClient(owner, ClientOptions{}, breaker.Options{})
+
+	var loads int
+	gp := NewGroup("get-spilled", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte("from getter"), nil
+	}))
+	gp.peers = s
+
+	out, err := s.Get(context.Background(), &pb.Request{Group: gp.name, Key: key, Spill: true})
+	if err != nil || string(out.Value) != "from owner" || loads != 0 {
+		t.Fatalf("spilled Get = %q, %v, getter loads = %d; want the value from the owner", out.GetValue(), err, loads)
+	}
+	if _, ok := gp.hotCache.get(key); !ok {
+		t.Fatalf("spilled value should be stored in hotCache")
+	}
+	if owner.spills != 0 {
+		t.Fatalf("spilled query must not spill again")
+	}
+}
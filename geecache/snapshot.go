@@ -0,0 +1,378 @@
+package geecache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	pb "geecache/geecachepb"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+/*
+	快照的二进制格式（整数均为大端序或 varint）：
+	+----------------------------------------------------------------------------------+
+	| magic "GCSN" | version uint16 | uvarint 长度 + group 名称                           |
+	| 条目 * N：tag byte(1 mainCache, 2 hotCache) | uvarint 长度 + key | uvarint 长度 + value |
+	|          varint 过期时间（UnixNano，0 表示永不过期） | uvarint 版本号                   |
+	|          uvarint 标签数 + 每个标签的 uvarint 长度 + 标签                              |
+	| tag byte 0 | uvarint 条目数 N | crc32(Castagnoli) uint32，校验此前的全部字节           |
+	+----------------------------------------------------------------------------------+
+	每个 cache 的条目按最近访问时间从旧到新排列，按顺序写回即可还原 LRU 顺序。
+	版本 1 的条目没有版本号与标签，仍然可以读取。
+	快照可以首尾相接地写入同一个文件，Server.SaveSnapshot 即将全部 group 的快照依次写入一个文件。
+*/
+
+const (
+	snapshotMagic   = "GCSN"
+	snapshotVersion = 2
+
+	snapshotEnd  byte = 0
+	snapshotMain byte = 1
+	snapshotHot  byte = 2
+
+	maxSnapshotField = 1 << 30 // 单个 key 或 value 的长度上限，防止损坏的快照申请过多内存
+)
+
+var (
+	castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+	// ErrSnapshotChecksum 快照的校验和不匹配，快照已损坏，不会写入任何条目
+	ErrSnapshotChecksum = errors.New("snapshot checksum mismatch")
+)
+
+// snapshotEntry 快照中的一个条目
+type snapshotEntry struct {
+	hot     bool
+	key     string
+	value   []byte
+	expire  time.Time
+	version uint64
+	tags    []string
+}
+
+// Snapshot 将 mainCache（开启 SnapshotHotCache 时还有 hotCache）中未过期的条目连同过期时间、版本号、标签与 LRU 顺序写入 w。
+// 快照期间缓存仍可读写，快照中的条目不保证属于同一时刻
+func (g *Group) Snapshot(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	sw := &snapshotWriter{w: bw, crc: crc32.New(castagnoli)}
+
+	sw.write([]byte(snapshotMagic))
+	sw.write(binary.BigEndian.AppendUint16(nil, snapshotVersion))
+	sw.writeBytes([]byte(g.name))
+
+	var count uint64
+	count += sw.writeCache(&g.mainCache, snapshotMain)
+	if g.snapshotHot {
+		count += sw.writeCache(&g.hotCache, snapshotHot)
+	}
+	sw.write([]byte{snapshotEnd})
+	sw.write(binary.AppendUvarint(nil, count))
+	if sw.err != nil {
+		return fmt.Errorf("write snapshot of group %s failed: %v", g.name, sw.err)
+	}
+	if _, err := bw.Write(binary.BigEndian.AppendUint32(nil, sw.crc.Sum32())); err != nil {
+		return fmt.Errorf("write snapshot of group %s failed: %v", g.name, err)
+	}
+	return bw.Flush()
+}
+
+// Restore 从 r 中读取 Snapshot 写入的快照，将未过期的条目按原来的 LRU 顺序写回对应的 cache。
+// 校验和通过后才写入；缓存中已存在的 key 可能是更新的值，不会被覆盖
+func (g *Group) Restore(r io.Reader) error {
+	name, entries, err := readGroupSnapshot(bufio.NewReader(r))
+	if err != nil {
+		return err
+	}
+	if name != g.name {
+		return fmt.Errorf("snapshot belongs to group %s, not %s", name, g.name)
+	}
+	now := time.Now()
+	for _, e := range entries {
+		if !e.expire.IsZero() && e.expire.Before(now) {
+			continue
+		}
+		c := &g.mainCache
+		if e.hot {
+			c = &g.hotCache
+		}
+		g.populateIfAbsent(e.key, ByteView{b: e.value, e: e.expire, v: e.version, t: e.tags}, c)
+	}
+	return nil
+}
+
+// snapshotWriter 写入的同时计算校验和，记录第一个错误
+type snapshotWriter struct {
+	w   io.Writer
+	crc hash.Hash32
+	err error
+}
+
+func (sw *snapshotWriter) write(p []byte) {
+	if sw.err != nil {
+		return
+	}
+	if _, sw.err = sw.w.Write(p); sw.err == nil {
+		sw.crc.Write(p)
+	}
+}
+
+func (sw *snapshotWriter) writeBytes(p []byte) {
+	sw.write(binary.AppendUvarint(nil, uint64(len(p))))
+	sw.write(p)
+}
+
+// writeCache 按最近访问时间从旧到新写入 c 中未过期的条目，返回写入的条目数
+func (sw *snapshotWriter) writeCache(c *cache, tag byte) (count uint64) {
+	keys := c.keys()
+	for i := len(keys) - 1; i >= 0; i-- {
+		view, ok := c.peek(keys[i])
+		if !ok {
+			continue
+		}
+		b, err := view.raw() // 快照中保存解压后的值，恢复时按当前配置重新压缩
+		if err != nil {
+			continue
+		}
+		sw.write([]byte{tag})
+		sw.writeBytes([]byte(keys[i]))
+		sw.writeBytes(b)
+		sw.write(binary.AppendVarint(nil, toUnixNano(view.e)))
+		sw.write(binary.AppendUvarint(nil, view.v))
+		sw.write(binary.AppendUvarint(nil, uint64(len(view.t))))
+		for _, t := range view.t {
+			sw.writeBytes([]byte(t))
+		}
+		count++
+	}
+	return count
+}
+
+// snapshotReader 读取的同时计算校验和
+type snapshotReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+}
+
+func (sr *snapshotReader) Read(p []byte) (int, error) {
+	n, err := sr.r.Read(p)
+	sr.crc.Write(p[:n])
+	return n, err
+}
+
+func (sr *snapshotReader) ReadByte() (byte, error) {
+	b, err := sr.r.ReadByte()
+	if err == nil {
+		sr.crc.Write([]byte{b})
+	}
+	return b, err
+}
+
+func (sr *snapshotReader) readBytes() ([]byte, error) {
+	n, err := binary.ReadUvarint(sr)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxSnapshotField {
+		return nil, fmt.Errorf("snapshot field too large: %d bytes", n)
+	}
+	p := make([]byte, n)
+	_, err = io.ReadFull(sr, p)
+	return p, err
+}
+
+// readMeta 读取条目的版本号与标签
+func (sr *snapshotReader) readMeta() (version uint64, tags []string, err error) {
+	if version, err = binary.ReadUvarint(sr); err != nil {
+		return 0, nil, err
+	}
+	n, err := binary.ReadUvarint(sr)
+	if err != nil {
+		return 0, nil, err
+	}
+	if n > maxSnapshotField {
+		return 0, nil, fmt.Errorf("snapshot field too large: %d tags", n)
+	}
+	for i := uint64(0); i < n; i++ {
+		t, err := sr.readBytes()
+		if err != nil {
+			return 0, nil, err
+		}
+		tags = append(tags, string(t))
+	}
+	return version, tags, nil
+}
+
+// readGroupSnapshot 从 r 中读取一个 group 的快照。r 中可以还有后续的快照
+func readGroupSnapshot(r *bufio.Reader) (name string, entries []snapshotEntry, err error) {
+	defer func() {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = errors.New("snapshot truncated")
+		}
+	}()
+	sr := &snapshotReader{r: r, crc: crc32.New(castagnoli)}
+
+	header := make([]byte, len(snapshotMagic)+2)
+	if _, err = io.ReadFull(sr, header); err != nil {
+		return "", nil, err
+	}
+	if string(header[:len(snapshotMagic)]) != snapshotMagic {
+		return "", nil, errors.New("not a geecache snapshot")
+	}
+	version := binary.BigEndian.Uint16(header[len(snapshotMagic):])
+	if version < 1 || version > snapshotVersion {
+		return "", nil, fmt.Errorf("unsupported snapshot version %d", version)
+	}
+	rawName, err := sr.readBytes()
+	if err != nil {
+		return "", nil, err
+	}
+
+	for {
+		tag, err := sr.ReadByte()
+		if err != nil {
+			return "", nil, err
+		}
+		if tag == snapshotEnd {
+			break
+		}
+		if tag != snapshotMain && tag != snapshotHot {
+			return "", nil, fmt.Errorf("invalid snapshot entry tag %d", tag)
+		}
+		key, err := sr.readBytes()
+		if err != nil {
+			return "", nil, err
+		}
+		value, err := sr.readBytes()
+		if err != nil {
+			return "", nil, err
+		}
+		expire, err := binary.ReadVarint(sr)
+		if err != nil {
+			return "", nil, err
+		}
+		e := snapshotEntry{
+			hot:    tag == snapshotHot,
+			key:    string(key),
+			value:  value,
+			expire: fromUnixNano(expire),
+		}
+		if version >= 2 {
+			if e.version, e.tags, err = sr.readMeta(); err != nil {
+				return "", nil, err
+			}
+		}
+		entries = append(entries, e)
+	}
+
+	count, err := binary.ReadUvarint(sr)
+	if err != nil {
+		return "", nil, err
+	}
+	sum := make([]byte, 4)
+	if _, err = io.ReadFull(r, sum); err != nil { // 校验和本身不参与计算
+		return "", nil, err
+	}
+	if binary.BigEndian.Uint32(sum) != sr.crc.Sum32() || count != uint64(len(entries)) {
+		return "", nil, ErrSnapshotChecksum
+	}
+	return string(rawName), entries, nil
+}
+
+// SnapshotOptions Server 定期保存快照的配置
+type SnapshotOptions struct {
+	// File 快照文件路径，为空时不保存。服务停止时也会保存一次
+	File string
+
+	// Interval 大于 0 时每隔 Interval 保存一次快照
+	Interval time.Duration
+}
+
+// SaveSnapshot 将全部 group 的快照依次写入文件，供下次启动时通过 WarmupOptions.SnapshotFile 预热。
+// 先写入临时文件再重命名，写入失败不会破坏已有的快照
+func (s *Server) SaveSnapshot(path string) error {
+	mu.RLock()
+	gs := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		gs = append(gs, g)
+	}
+	mu.RUnlock()
+	sort.Slice(gs, func(i, j int) bool { return gs[i].name < gs[j].name })
+
+	f, err := os.CreateTemp(filepath.Dir(path), ".snapshot-*")
+	if err != nil {
+		return fmt.Errorf("create snapshot failed: %v", err)
+	}
+	defer os.Remove(f.Name()) // 重命名成功后删除会失败，忽略
+
+	bw := bufio.NewWriter(f)
+	for _, g := range gs {
+		if err = g.Snapshot(bw); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("write snapshot failed: %v", err)
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// snapshotLoop 每隔 Interval 保存一次快照，stop 被关闭时再保存一次后返回
+func (s *Server) snapshotLoop(stop chan struct{}) {
+	var tick <-chan time.Time
+	if s.snapshotOpts.Interval > 0 {
+		ticker := time.NewTicker(s.snapshotOpts.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-stop:
+			if err := s.SaveSnapshot(s.snapshotOpts.File); err != nil {
+				s.Log("%v", err)
+			}
+			return
+		case <-tick:
+			if err := s.SaveSnapshot(s.snapshotOpts.File); err != nil {
+				s.Log("%v", err)
+			}
+		}
+	}
+}
+
+// readSnapshot 依次读取 SaveSnapshot 写入的文件中每个 group 的 mainCache 条目，按最近访问时间从新到旧排列
+func readSnapshot(path string, fn func(*pb.SetRequest)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	for {
+		if _, err := br.Peek(1); err == io.EOF {
+			return nil
+		}
+		name, entries, err := readGroupSnapshot(br)
+		if err != nil {
+			return fmt.Errorf("read snapshot %s failed: %w", path, err)
+		}
+		for i := len(entries) - 1; i >= 0; i-- {
+			if e := entries[i]; !e.hot {
+				fn(&pb.SetRequest{Group: name, Key: e.key, Value: e.value, Expire: toUnixNano(e.expire), Version: e.version, Tags: e.tags})
+			}
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package geecache
+
+import (
+	"bytes"
+	pb "geecache/geecachepb"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte("db-" + key), nil })
+	src := NewGroupOpts("snapshot-src", 1<<20, getter, &GroupOptions{SnapshotHotCache: true})
+	expire := time.Now().Add(time.Hour).Round(0)
+	src.localSet("k1", ByteView{b: []byte("v1")}, &src.mainCache)
+	src.localSet("k2", ByteView{b: []byte("v2"), e: expire}, &src.mainCache)
+	src.localSet("k3", ByteView{b: []byte("v3")}, &src.mainCache)
+	src.localSet("gone", ByteView{b: []byte("x"), e: time.Now().Add(-time.Second)}, &src.mainCache)
+	src.localSet("h1", ByteView{b: []byte("hot")}, &src.hotCache)
+	src.mainCache.get("k1") // LRU 顺序：k1 最新，其次 k3、k2
+
+	var buf bytes.Buffer
+	if err := src.Snapshot(&buf); err != nil {
+		t.Fatalf("Snapshot error: %v", err)
+	}
+
+	// 快照属于另一个 group
+	if err := NewGroup("snapshot-other", 1<<20, getter).Restore(bytes.NewReader(buf.Bytes())); err == nil {
+		t.Fatalf("Restore should reject a snapshot of another group")
+	}
+
+	// 清空后恢复
+	for _, key := range []string{"k1", "k2", "k3", "gone", "h1"} {
+		src.localRemove(key)
+	}
+	if err := src.Restore(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("Restore error: %v", err)
+	}
+	if keys := src.mainCache.keys(); strings.Join(keys, ",") != "k1,k3,k2" {
+		t.Errorf("restored mainCache order = %v, want [k1 k3 k2]", keys)
+	}
+	if v, ok := src.mainCache.peek("k2"); !ok || v.String() != "v2" || !v.e.Equal(expire) {
+		t.Errorf("k2 = %q expire %v, want v2 expire %v", v, v.e, expire)
+	}
+	if v, ok := src.hotCache.peek("h1"); !ok || v.String() != "hot" {
+		t.Errorf("hotCache entry should be restored, got %q", v)
+	}
+}
+
+// 快照保存版本号与标签，恢复后 CompareAndSet 的版本号不变，RemoveByTag 仍能找到恢复的条目
+func TestSnapshotRestoreTags(t *testing.T) {
+	g := NewGroup("snapshot-tags", 1<<20, GetterFunc(notFound))
+	g.peers = &fakePicker{replicas: []ProtoGetter{nil}}
+	g.localSet("u1", ByteView{b: []byte("v1"), t: []string{"user", "vip"}}, &g.mainCache)
+	g.localSet("u2", ByteView{b: []byte("v2"), t: []string{"user"}}, &g.mainCache)
+	g.localSet("p1", ByteView{b: []byte("v3"), t: []string{"product"}}, &g.mainCache)
+	versions := make(map[string]uint64)
+	for _, key := range []string{"u1", "u2", "p1"} {
+		v, _ := g.mainCache.peek(key)
+		versions[key] = v.v
+	}
+
+	var buf bytes.Buffer
+	if err := g.Snapshot(&buf); err != nil {
+		t.Fatalf("Snapshot error: %v", err)
+	}
+	for key := range versions {
+		g.localRemove(key)
+	}
+	if err := g.Restore(&buf); err != nil {
+		t.Fatalf("Restore error: %v", err)
+	}
+	for key, version := range versions {
+		if v, ok := g.mainCache.peek(key); !ok || v.v != version {
+			t.Errorf("restored %s version = %d, want %d", key, v.v, version)
+		}
+	}
+	if v, _ := g.mainCache.peek("u1"); strings.Join(v.Tags(), ",") != "user,vip" {
+		t.Errorf("restored u1 tags = %v, want [user vip]", v.Tags())
+	}
+
+	if err := g.RemoveByTag("user"); err != nil {
+		t.Fatalf("RemoveByTag error: %v", err)
+	}
+	for key, want := range map[string]bool{"u1": false, "u2": false, "p1": true} {
+		if _, ok := g.mainCache.peek(key); ok != want {
+			t.Errorf("after RemoveByTag(user), %s in mainCache = %v, want %v", key, ok, want)
+		}
+	}
+}
+
+func TestSnapshotCorrupt(t *testing.T) {
+	g := newHandoffGroup("snapshot-corrupt", 5, time.Time{})
+	var buf bytes.Buffer
+	if err := g.Snapshot(&buf); err != nil {
+		t.Fatalf("Snapshot error: %v", err)
+	}
+	for _, key := range g.mainCache.keys() {
+		g.mainCache.remove(key)
+	}
+
+	tests := []struct {
+		name string
+		data func(b []byte) []byte
+		want string
+	}{
+		{"flipped", func(b []byte) []byte { b[len(b)-10] ^= 0xff; return b }, ""},
+		{"truncated", func(b []byte) []byte { return b[:len(b)-3] }, "truncated"},
+		{"version", func(b []byte) []byte { b[5] = 9; return b }, "version"},
+		{"magic", func(b []byte) []byte { b[0] = 'X'; return b }, "not a geecache snapshot"},
+	}
+	for _, tt := range tests {
+		data := tt.data(append([]byte(nil), buf.Bytes()...))
+		err := g.Restore(bytes.NewReader(data))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Restore error = %v, want %q", tt.name, err, tt.want)
+		}
+		if keys := g.mainCache.keys(); len(keys) != 0 {
+			t.Errorf("%s: corrupt snapshot should not restore any entry, got %v", tt.name, keys)
+		}
+	}
+}
+
+func TestSnapshotLoop(t *testing.T) {
+	newHandoffGroup("snapshot-loop", 3, time.Time{})
+	path := filepath.Join(t.TempDir(), "geecache.snapshot")
+	s := newServer("127.0.0.1:8001", &ServerOptions{Snapshot: SnapshotOptions{File: path, Interval: 10 * time.Millisecond}})
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		s.snapshotLoop(stop)
+		close(done)
+	}()
+	time.Sleep(30 * time.Millisecond)
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("snapshot should be saved periodically: %v", err)
+	}
+	os.Remove(path)
+	close(stop)
+	<-done
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("snapshot should be saved on stop: %v", err)
+	}
+
+	var keys []string
+	if err := readSnapshot(path, func(in *pb.SetRequest) {
+		if in.Group == "snapshot-loop" {
+			keys = append(keys, in.Key)
+		}
+	}); err != nil || strings.Join(keys, ",") != "key2,key1,key0" {
+		t.Fatalf("readSnapshot = %v, %v; want the most recently used key first", keys, err)
+	}
+}
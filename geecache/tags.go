@@ -0,0 +1,113 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "geecache/geecachepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strings"
+)
+
+/*
+	按标签或前缀批量移除：Set 的 tags 参数、或 TaggedGetter 加载时返回的标签随值一起保存，
+	并随 Get/Put/Handoff/Warmup 传给其他节点。每个节点的 mainCache 与 hotCache 各自维护一个二级索引（index.Index），
+	RemoveByTag/RemoveByPrefix 在本节点移除后，通过 RemoveMatching 通知其他全部节点各自查找并移除，不需要扫描全部 key。
+	批量移除只清除缓存，不会调用 Deleter 删除数据源中的数据。磁盘上的第二级缓存同样保存标签并维护按标签的索引，
+	按前缀移除时需要遍历磁盘缓存的索引，两者都在 loadGroup.Lock 之外进行。
+*/
+
+// RemoveByTag 从全部节点的缓存中移除带有 tag 标签的 key，结果与失败重试同 Remove
+func (g *Group) RemoveByTag(tag string) error {
+	if tag == "" {
+		return errors.New("empty RemoveByTag() tag not allowed")
+	}
+	return g.removeMatching(removeTarget{tag: tag})
+}
+
+// RemoveByPrefix 从全部节点的缓存中移除以 prefix 开头的 key，结果与失败重试同 Remove
+func (g *Group) RemoveByPrefix(prefix string) error {
+	if prefix == "" {
+		return errors.New("empty RemoveByPrefix() prefix not allowed")
+	}
+	return g.removeMatching(removeTarget{prefix: prefix})
+}
+
+// removeMatching 先在本节点移除，再并发通知其他全部节点，失败的节点在后台重试
+func (g *Group) removeMatching(target removeTarget) error {
+	g.peersOnce.Do(g.initPeers)
+	g.localRemoveMatching(target.tag, target.prefix)
+
+	results := append([]PeerResult{{Peer: peerName(nil)}}, removeFromPeers(g.peers.GetAll(), false, func(peer ProtoGetter) error {
+		return g.removeMatchingFromPeer(peer, target.tag, target.prefix)
+	})...)
+	g.removeRetry.add(target, results)
+	if !g.removeSucceeded(results) {
+		return &RemoveError{Key: target.String(), Policy: g.removePolicy, Results: results}
+	}
+	return nil
+}
+
+func (g *Group) removeMatchingFromPeer(peer ProtoGetter, tag, prefix string) error {
+	req := &pb.RemoveMatchingRequest{
+		Group:  g.name,
+		Tag:    tag,
+		Prefix: prefix,
+	}
+	return peer.RemoveMatching(req, &pb.RemoveMatchingResponse{})
+}
+
+// localRemoveMatching 从本节点的 mainCache 与 hotCache 中移除带有 tag 标签、或以 prefix 开头的 key，返回移除的条目数
+func (g *Group) localRemoveMatching(tag, prefix string) (removed int) {
+	if g.cacheBytes.Load() <= 0 {
+		return 0
+	}
+	g.loadGroup.Lock(func() {
+		for _, c := range []*cache{&g.mainCache, &g.hotCache} {
+			for _, key := range c.matching(tag, prefix) {
+				c.remove(key)
+				removed++
+			}
+		}
+		if g.disk != nil {
+			g.cancelDemotions(func(key string, value ByteView) bool {
+				return tag != "" && contains(value.t, tag) || tag == "" && strings.HasPrefix(key, prefix)
+			})
+			g.beginDiskRemoval()
+		}
+	})
+	if g.disk == nil {
+		return removed
+	}
+	defer g.endDiskRemoval()
+	if tag != "" { // 磁盘的删除在锁外进行，不阻塞其他 key
+		return removed + g.disk.DeleteTag(tag)
+	}
+	return removed + g.disk.DeletePrefix(prefix)
+}
+
+// RemoveMatching 按标签或前缀移除本节点缓存中的条目，tag 与 prefix 需要且只能指定一个
+func (s *Server) RemoveMatching(ctx context.Context, in *pb.RemoveMatchingRequest) (*pb.RemoveMatchingResponse, error) {
+	group := GetGroup(in.GetGroup())
+	if group == nil {
+		return nil, fmt.Errorf("no such group: %s", in.GetGroup())
+	}
+	if (in.Tag == "") == (in.Prefix == "") {
+		return nil, status.Error(codes.InvalidArgument, "exactly one of tag and prefix is required")
+	}
+	s.Log("RemoveMatching group %s tag %q prefix %q", group.name, in.Tag, in.Prefix)
+	return &pb.RemoveMatchingResponse{Removed: int64(group.localRemoveMatching(in.Tag, in.Prefix))}, nil
+}
+
+// RemoveMatching 方法，实现 ProtoGetter 接口
+func (c *client) RemoveMatching(in *pb.RemoveMatchingRequest, out *pb.RemoveMatchingResponse) error {
+	return c.call(func(ctx context.Context, grpcClient pb.GroupCacheClient) error {
+		resp, err := grpcClient.RemoveMatching(ctx, in)
+		if err != nil {
+			return fmt.Errorf("grpc client RemoveMatching() error: %w", err)
+		}
+		out.Removed = resp.GetRemoved()
+		return nil
+	})
+}
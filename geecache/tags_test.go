@@ -0,0 +1,138 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	pb "geecache/geecachepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strings"
+	"testing"
+	"time"
+)
+
+// taggedGetter 以 key 中第二个冒号之前的部分（例如 user:42）作为标签
+type taggedGetter struct{}
+
+func (taggedGetter) Get(key string) ([]byte, error) {
+	return []byte("v-" + key), nil
+}
+
+func (taggedGetter) GetTagged(key string) ([]byte, []string, error) {
+	parts := strings.SplitN(key, ":", 3)
+	return []byte("v-" + key), []string{parts[0] + ":" + parts[1]}, nil
+}
+
+func TestRemoveByTag(t *testing.T) {
+	owner, other, down := newFakePeer(false), newFakePeer(false), newFakePeer(true)
+	owner.Set(&pb.SetRequest{Key: "user:42:avatar", Value: []byte("png"), Tags: []string{"user:42"}})
+	other.Set(&pb.SetRequest{Key: "user:42:cart", Value: []byte("[]"), Tags: []string{"user:42"}})
+	other.Set(&pb.SetRequest{Key: "user:7:cart", Value: []byte("[]"), Tags: []string{"user:7"}})
+
+	gp := NewGroupOpts("tags", 2<<10, taggedGetter{}, &GroupOptions{RemoveRetry: RemoveRetryOptions{MaxAttempts: -1}})
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil}, all: []ProtoGetter{other, down}}
+	gp.Query("user:42:orders")                                              // 加载时由 TaggedGetter 打上标签
+	gp.Set("user:42:profile", []byte("Tom"), time.Time{}, false, "user:42") // Set 时指定标签
+	gp.Query("user:7:orders")
+
+	// 其他节点负责的 key 进入 hotCache 时保留标签
+	gp.peers = &fakePicker{replicas: []ProtoGetter{owner}, all: []ProtoGetter{other, down}}
+	if view, err := gp.Query("user:42:avatar"); err != nil || strings.Join(view.Tags(), ",") != "user:42" {
+		t.Fatalf("Query = %v, %v; want value tagged user:42", view.Tags(), err)
+	}
+
+	err := gp.RemoveByTag("user:42")
+	var rerr *RemoveError
+	if !errors.As(err, &rerr) || rerr.Key != "tag=user:42" || len(rerr.Failed()) != 1 {
+		t.Fatalf("RemoveByTag should report the down peer, got %v", err)
+	}
+	for _, key := range []string{"user:42:orders", "user:42:profile"} {
+		if _, ok := gp.mainCache.peek(key); ok {
+			t.Fatalf("%s should be removed from mainCache", key)
+		}
+	}
+	if _, ok := gp.hotCache.peek("user:42:avatar"); ok {
+		t.Fatalf("user:42:avatar should be removed from hotCache")
+	}
+	if _, ok := gp.mainCache.peek("user:7:orders"); !ok {
+		t.Fatalf("user:7:orders should be kept")
+	}
+	if _, ok := other.data["user:42:cart"]; ok {
+		t.Fatalf("RemoveByTag should fan out to other peers")
+	}
+	if _, ok := other.data["user:7:cart"]; !ok {
+		t.Fatalf("other tags should be kept on peers")
+	}
+}
+
+func TestRemoveByPrefix(t *testing.T) {
+	gp := NewGroupOpts("tags-prefix", 2<<10, GetterFunc(notFound), &GroupOptions{DiskDir: t.TempDir(), DiskBytes: 1 << 20})
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil}}
+	for _, key := range []string{"user:42", "user:42:cart", "user:420", "user:7"} {
+		gp.Set(key, []byte("v"), time.Time{}, false)
+	}
+	gp.localSet("user:42:avatar", ByteView{b: []byte("png")}, &gp.hotCache)
+	gp.disk.Put("user:42:orders", []byte("[]"), time.Time{})
+
+	if err := gp.RemoveByPrefix("user:42"); err != nil {
+		t.Fatalf("RemoveByPrefix failed: %v", err)
+	}
+	if got := gp.mainCache.keys(); len(got) != 1 || got[0] != "user:7" {
+		t.Fatalf("mainCache keys = %v, want only user:7", got)
+	}
+	if _, ok := gp.hotCache.peek("user:42:avatar"); ok {
+		t.Fatalf("hotCache entry should be removed")
+	}
+	if _, _, ok := gp.disk.Get("user:42:orders"); ok {
+		t.Fatalf("disk entry should be removed")
+	}
+	if err := gp.RemoveByPrefix(""); err == nil {
+		t.Fatalf("empty prefix should be rejected")
+	}
+}
+
+// 带标签的条目同样降级到磁盘，移回后保留标签；RemoveByTag 通过磁盘的标签索引删除
+func TestRemoveByTagOnDisk(t *testing.T) {
+	gp := NewGroupOpts("tags-disk", 2<<10, GetterFunc(notFound), &GroupOptions{MaxEntries: 1, DiskDir: t.TempDir(), DiskBytes: 1 << 20})
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil}}
+	gp.localSet("u1", ByteView{b: []byte("v1"), t: []string{"user"}}, &gp.mainCache)
+	gp.localSet("u2", ByteView{b: []byte("v2"), t: []string{"user"}}, &gp.mainCache)
+	gp.localSet("p1", ByteView{b: []byte("v3"), t: []string{"product"}}, &gp.mainCache)
+	gp.flushDemoted()
+	if gp.disk.Len() != 2 {
+		t.Fatalf("tagged entries should be demoted to disk, got %d", gp.disk.Len())
+	}
+
+	if view, err := gp.Query("u1"); err != nil || view.String() != "v1" || len(view.Tags()) != 1 || view.Tags()[0] != "user" {
+		t.Fatalf("promoted u1 = %q with tags %v, %v; want v1 [user]", view, view.Tags(), err)
+	}
+	gp.flushDemoted() // p1 被 u1 挤到磁盘
+
+	if err := gp.RemoveByTag("user"); err != nil {
+		t.Fatalf("RemoveByTag failed: %v", err)
+	}
+	for _, key := range []string{"u1", "u2"} {
+		_, inMemory := gp.mainCache.peek(key)
+		if _, _, onDisk := gp.disk.Get(key); inMemory || onDisk {
+			t.Errorf("%s should be removed from memory and disk", key)
+		}
+	}
+	if _, _, ok := gp.disk.Get("p1"); !ok {
+		t.Errorf("p1 with another tag should stay on disk")
+	}
+}
+
+func TestServerRemoveMatching(t *testing.T) {
+	gp := NewGroup("tags-server", 2<<10, GetterFunc(notFound))
+	gp.localSet("Tom", ByteView{b: []byte("630"), t: []string{"people"}}, &gp.mainCache)
+	s := newServer("127.0.0.1:8001", nil)
+
+	_, err := s.RemoveMatching(context.Background(), &pb.RemoveMatchingRequest{Group: gp.name, Tag: "people", Prefix: "T"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("tag and prefix together should be rejected, got %v", err)
+	}
+	out, err := s.RemoveMatching(context.Background(), &pb.RemoveMatchingRequest{Group: gp.name, Tag: "people"})
+	if err != nil || out.Removed != 1 {
+		t.Fatalf("RemoveMatching = %v, %v; want 1 removed", out, err)
+	}
+}
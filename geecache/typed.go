@@ -0,0 +1,160 @@
+package geecache
+
+import (
+	"fmt"
+	"geecache/codec"
+	"geecache/lru"
+	"sync"
+	"time"
+)
+
+/*
+	TypedGroup 在 Group 之上按 codec.Codec[T] 编码与解码，调用方直接读写 T 类型的值，不需要自己处理 []byte。
+	缓存与节点之间传输的仍是编码后的字节，因此同一个 Group 的全部节点需要使用相同的 Codec。
+	开启 DecodedEntries 后，最近命中的值解码后按 key 缓存，缓存值的版本号不变时直接返回，省去重复解码；
+	此时多个调用方得到的是同一个对象，不能修改。
+*/
+
+// TypedGetter 缓存不存在时，调用它得到 T 类型的源数据
+type TypedGetter[T any] interface {
+	Get(key string) (T, error)
+}
+
+// TypedGetterFunc 函数类型，实现 TypedGetter 接口
+type TypedGetterFunc[T any] func(key string) (T, error)
+
+func (f TypedGetterFunc[T]) Get(key string) (T, error) {
+	return f(key)
+}
+
+// TypedOptions TypedGroup 的可选配置。Codec 的 Encode 每次都返回新的切片、不会再修改时，
+// 可以设置 GroupOptions.TransferOwnership，省去加载时的拷贝
+type TypedOptions struct {
+	GroupOptions
+
+	// DecodedEntries 大于 0 时，缓存至多 DecodedEntries 个解码后的值
+	DecodedEntries int
+}
+
+// TypedGroup 值为 T 类型的 Group
+type TypedGroup[T any] struct {
+	g     *Group
+	codec codec.Codec[T]
+
+	mu      sync.Mutex
+	decoded *lru.Cache[decodedValue[T]] // 未开启时为 nil
+}
+
+// decodedValue 解码后的值及其对应的版本号
+type decodedValue[T any] struct {
+	version uint64
+	value   T
+}
+
+// encodingGetter 将 TypedGetter 的结果编码后交给 Group
+type encodingGetter[T any] struct {
+	getter TypedGetter[T]
+	codec  codec.Codec[T]
+}
+
+func (e encodingGetter[T]) Get(key string) ([]byte, error) {
+	v, err := e.getter.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return e.codec.Encode(v)
+}
+
+// NewTypedGroup 实例化 TypedGroup，底层的 Group 同样注册在 groups 中，可以通过 GetGroup 找到
+func NewTypedGroup[T any](name string, cacheBytes int64, getter TypedGetter[T], c codec.Codec[T], o *TypedOptions) *TypedGroup[T] {
+	if getter == nil {
+		panic("nil TypedGetter")
+	}
+	var gopts GroupOptions
+	if o != nil {
+		gopts = o.GroupOptions
+	}
+	tg := &TypedGroup[T]{
+		g:     NewGroupOpts(name, cacheBytes, encodingGetter[T]{getter, c}, &gopts),
+		codec: c,
+	}
+	if o != nil && o.DecodedEntries > 0 {
+		tg.decoded = lru.NewCache[decodedValue[T]](o.DecodedEntries, nil)
+	}
+	return tg
+}
+
+// Group 返回底层的 Group
+func (tg *TypedGroup[T]) Group() *Group {
+	return tg.g
+}
+
+// Query 查询 key 并解码为 T
+func (tg *TypedGroup[T]) Query(key string) (T, error) {
+	var zero T
+	view, err := tg.g.Query(key)
+	if err != nil {
+		return zero, err
+	}
+	if v, ok := tg.lookupDecoded(key, view.v); ok {
+		return v, nil
+	}
+	b, err := view.raw()
+	if err != nil {
+		return zero, fmt.Errorf("decode %s: %w", key, err)
+	}
+	v, err := tg.codec.Decode(b)
+	if err != nil {
+		return zero, fmt.Errorf("decode %s: %w", key, err)
+	}
+	tg.addDecoded(key, view.v, v)
+	return v, nil
+}
+
+// Set 编码后写入 key，参数同 Group.Set
+func (tg *TypedGroup[T]) Set(key string, value T, expire time.Time, isHotCache bool, tags ...string) error {
+	b, err := tg.codec.Encode(value)
+	if err != nil {
+		return fmt.Errorf("encode %s: %w", key, err)
+	}
+	tg.removeDecoded(key)
+	return tg.g.Set(key, b, expire, isHotCache, tags...)
+}
+
+// Remove 移除 key，参数同 Group.Remove
+func (tg *TypedGroup[T]) Remove(key string) error {
+	tg.removeDecoded(key)
+	return tg.g.Remove(key)
+}
+
+// lookupDecoded 查找已解码的值。版本号为 0 的值（例如代为查询的结果）无法判断是否改变，不使用缓存
+func (tg *TypedGroup[T]) lookupDecoded(key string, version uint64) (T, bool) {
+	var zero T
+	if tg.decoded == nil || version == 0 {
+		return zero, false
+	}
+	tg.mu.Lock()
+	defer tg.mu.Unlock()
+	if d, ok := tg.decoded.Get(key); ok && d.version == version {
+		return d.value, true
+	}
+	return zero, false
+}
+
+func (tg *TypedGroup[T]) addDecoded(key string, version uint64, v T) {
+	if tg.decoded == nil || version == 0 {
+		return
+	}
+	tg.mu.Lock()
+	defer tg.mu.Unlock()
+	tg.decoded.Add(key, decodedValue[T]{version: version, value: v}, time.Time{})
+}
+
+func (tg *TypedGroup[T]) removeDecoded(key string) {
+	if tg.decoded == nil {
+		return
+	}
+	tg.mu.Lock()
+	defer tg.mu.Unlock()
+	tg.decoded.Remove(key)
+}
@@ -0,0 +1,87 @@
+package geecache
+
+import (
+	"geecache/codec"
+	"testing"
+	"time"
+)
+
+type score struct {
+	Name  string
+	Score int
+}
+
+// countingCodec 记录 Decode 的调用次数
+type countingCodec struct {
+	codec.JSON[score]
+	decodes int
+}
+
+func (c *countingCodec) Decode(data []byte) (score, error) {
+	c.decodes++
+	return c.JSON.Decode(data)
+}
+
+func TestTypedGroup(t *testing.T) {
+	var loads int
+	c := &countingCodec{}
+	tg := NewTypedGroup[score]("typed", 2<<10, TypedGetterFunc[score](func(key string) (score, error) {
+		loads++
+		return score{Name: key, Score: len(db[key])}, nil
+	}), c, &TypedOptions{DecodedEntries: 8})
+	tg.Group().peers = &fakePicker{replicas: []ProtoGetter{nil}}
+
+	for i := 0; i < 3; i++ {
+		if s, err := tg.Query("Tom"); err != nil || s != (score{"Tom", 3}) {
+			t.Fatalf("Query = %+v, %v; want Tom 3", s, err)
+		}
+	}
+	if loads != 1 || c.decodes != 1 {
+		t.Fatalf("got %d loads and %d decodes, want 1 each", loads, c.decodes)
+	}
+	if view, _ := tg.Group().Query("Tom"); view.String() != `{"Name":"Tom","Score":3}` {
+		t.Fatalf("stored value = %s, want JSON", view)
+	}
+
+	// 写入新值后重新解码
+	if err := tg.Set("Tom", score{"Tom", 700}, time.Time{}, false); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if s, _ := tg.Query("Tom"); s.Score != 700 || c.decodes != 2 {
+		t.Fatalf("Query = %+v after %d decodes, want Score 700 after 2", s, c.decodes)
+	}
+
+	tg.Group().Set("Tom", []byte("not json"), time.Time{}, false)
+	if _, err := tg.Query("Tom"); err == nil {
+		t.Fatalf("Query should fail on malformed value")
+	}
+}
+
+// bufferCodec 每次 Encode 都写入同一个缓冲区
+type bufferCodec struct {
+	codec.JSON[score]
+	buf []byte
+}
+
+func (c *bufferCodec) Encode(v score) ([]byte, error) {
+	b, err := c.JSON.Encode(v)
+	c.buf = append(c.buf[:0], b...)
+	return c.buf, err
+}
+
+// 未设置 TransferOwnership 时，复用缓冲区的 Codec 不会改写已经缓存的值
+func TestTypedGroupReusedBuffer(t *testing.T) {
+	tg := NewTypedGroup[score]("typed-buffer", 2<<10, TypedGetterFunc[score](func(key string) (score, error) {
+		return score{Name: key, Score: len(key)}, nil
+	}), &bufferCodec{}, nil)
+	tg.Group().peers = &fakePicker{replicas: []ProtoGetter{nil}}
+
+	for _, key := range []string{"Jack", "Tom"} {
+		if _, err := tg.Query(key); err != nil {
+			t.Fatalf("Query(%s) failed: %v", key, err)
+		}
+	}
+	if s, err := tg.Query("Jack"); err != nil || s != (score{"Jack", 4}) {
+		t.Fatalf("Query(Jack) = %+v, %v; the cached value was overwritten by a later Encode", s, err)
+	}
+}
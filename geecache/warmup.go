@@ -0,0 +1,239 @@
+package geecache
+
+import (
+	"errors"
+	"fmt"
+	"geecache/consistenthash"
+	pb "geecache/geecachepb"
+	"os"
+	"sync"
+	"time"
+)
+
+/*
+	预热：新启动的节点缓存为空，滚动重启时命中率会骤降。开启预热后，Server.Start 在注册到 etcd 之前：
+	1. 通过 Warmup 流式 RPC 向其他节点请求它们最近访问的 key。请求携带自己的地址与哈希环，
+	   对方在 mainCache 与 hotCache 中只挑选属于请求方的 key，再按 Limit 截断；
+	2. 再从快照文件（SaveSnapshot 写入）中补充其他节点没有的 key；
+	写入 mainCache 时不覆盖已有的值，并通过 WarmupOptions.Progress 报告进度。
+*/
+
+const (
+	defaultWarmupLimit   = 1000
+	defaultWarmupTimeout = 30 * time.Second
+	warmupProgressEvery  = 1000 // 每接收多少条报告一次进度
+)
+
+// WarmupOptions 节点启动时的预热配置
+type WarmupOptions struct {
+	// FromPeers 是否向其他节点请求最近访问的 key
+	FromPeers bool
+
+	// SnapshotFile 不为空时，从该文件中加载属于当前节点的 key，文件不存在时跳过
+	SnapshotFile string
+
+	// Limit 每个 group 向每个节点最多请求的条目数，默认 1000
+	Limit int
+
+	// Timeout 向每个节点请求的超时时间，默认 30s
+	Timeout time.Duration
+
+	// Progress 不为空时，用于报告预热进度
+	Progress func(WarmupProgress)
+}
+
+// WarmupProgress 某个预热来源的进度
+type WarmupProgress struct {
+	Source   string // 节点地址，或快照文件路径
+	Received int    // 已接收的条目数
+	Loaded   int    // 属于当前节点并写入 mainCache 的条目数
+	Done     bool   // 该来源是否已经结束
+	Err      error  // 该来源失败的原因
+}
+
+// warmup 按照 WarmupOptions 预热 mainCache，返回写入的条目数
+func (s *Server) warmup() int {
+	o := s.warmupOpts
+	if o.Limit <= 0 {
+		o.Limit = defaultWarmupLimit
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = defaultWarmupTimeout
+	}
+	report := func(p WarmupProgress) {
+		if o.Progress != nil {
+			o.Progress(p)
+		}
+	}
+
+	var loaded int
+	if o.FromPeers {
+		s.mu.Lock()
+		peers := make(map[string]*client, len(s.clients))
+		for addr, c := range s.clients {
+			if addr != s.addr {
+				peers[addr] = c
+			}
+		}
+		ring := make(map[string]int64, len(s.clients))
+		for _, addr := range s.peers.Nodes() {
+			ring[addr] = int64(s.peers.Weight(addr))
+		}
+		s.mu.Unlock()
+
+		var wg sync.WaitGroup
+		var resMu sync.Mutex
+		for addr, c := range peers {
+			wg.Add(1)
+			go func(addr string, c *client) {
+				defer wg.Done()
+				w := s.newWarmer(addr, report)
+				in := &pb.WarmupRequest{Limit: int64(o.Limit), Requester: s.addr, Peers: ring}
+				err := c.warmup(in, o.Timeout, w.receive)
+				n := w.finish(err)
+				resMu.Lock()
+				loaded += n
+				resMu.Unlock()
+			}(addr, c)
+		}
+		wg.Wait()
+	}
+
+	if o.SnapshotFile != "" {
+		w := s.newWarmer(o.SnapshotFile, report)
+		err := readSnapshot(o.SnapshotFile, w.receive)
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+		loaded += w.finish(err)
+	}
+	s.Log("warm-up finished, %d keys loaded", loaded)
+	return loaded
+}
+
+// warmer 处理来自同一来源的预热条目
+type warmer struct {
+	s        *Server
+	progress WarmupProgress
+	report   func(WarmupProgress)
+	entries  []*pb.SetRequest // 属于当前节点的条目，按最近访问时间从新到旧排列
+}
+
+func (s *Server) newWarmer(source string, report func(WarmupProgress)) *warmer {
+	return &warmer{s: s, progress: WarmupProgress{Source: source}, report: report}
+}
+
+func (w *warmer) receive(in *pb.SetRequest) {
+	if w.progress.Received++; w.progress.Received%warmupProgressEvery == 0 {
+		w.report(w.progress)
+	}
+	if e := fromUnixNano(in.Expire); !e.IsZero() && e.Before(time.Now()) {
+		return
+	}
+	if contains(w.s.owners(in.Key), w.s.addr) {
+		w.entries = append(w.entries, in)
+	}
+}
+
+// finish 从旧到新写入条目，使 mainCache 中的 LRU 顺序与来源一致，返回写入的条目数
+func (w *warmer) finish(err error) int {
+	for i := len(w.entries) - 1; i >= 0; i-- {
+		in := w.entries[i]
+		if g := GetGroup(in.Group); g != nil && g.populateIfAbsent(in.Key, ByteView{b: in.Value, e: fromUnixNano(in.Expire), v: in.Version, t: in.Tags, z: in.Compressed}, &g.mainCache) {
+			w.progress.Loaded++
+		}
+	}
+	w.progress.Done, w.progress.Err = true, err
+	if err != nil {
+		w.s.Log("warm-up from %s failed after %d entries: %v", w.progress.Source, w.progress.Received, err)
+	}
+	w.report(w.progress)
+	return w.progress.Loaded
+}
+
+// Warmup 按最近访问时间从新到旧返回 mainCache 与 hotCache 中属于请求方的条目，供新启动的节点预热
+func (s *Server) Warmup(in *pb.WarmupRequest, stream pb.GroupCache_WarmupServer) error {
+	return eachEntry(in.GetGroup(), int(in.GetLimit()), s.ownedBy(in.GetRequester(), in.GetPeers()), stream.Send)
+}
+
+// ownedBy 返回判断 key 是否属于 requester 的函数。请求方尚未注册，不在当前的哈希环上，
+// 因此按它给出的 peers 重建哈希环；peers 为空时使用当前的哈希环。
+// requester 为空或哈希环无法复制时返回 nil，不做过滤，由请求方自行过滤
+func (s *Server) ownedBy(requester string, peers map[string]int64) func(key string) bool {
+	if requester == "" {
+		return nil
+	}
+	owners := s.owners
+	if len(peers) > 0 {
+		s.mu.Lock()
+		ring, ok := consistenthash.ClonePlacement(s.peers)
+		s.mu.Unlock()
+		if !ok {
+			return nil
+		}
+		weights := make(map[string]int, len(peers))
+		for addr, w := range peers {
+			weights[addr] = int(w)
+		}
+		ring.SetNodes(weights)
+		owners = func(key string) []string {
+			return ring.FindNodes(key, s.replication)
+		}
+	}
+	return func(key string) bool {
+		return contains(owners(key), requester)
+	}
+}
+
+// eachEntry 依次对 group（为空时为全部 group）中 owned 返回 true 的至多 limit 个条目调用 fn，owned 为 nil 时不过滤。
+// 先按最近访问时间从新到旧发送 mainCache 中的条目，再发送 hotCache 中 mainCache 没有的条目
+// fn 的参数在各次调用之间复用，fn 返回后不能再持有
+func eachEntry(group string, limit int, owned func(key string) bool, fn func(*pb.SetRequest) error) error {
+	var gs []*Group
+	if group != "" {
+		g := GetGroup(group)
+		if g == nil {
+			return fmt.Errorf("no such group: %s", group)
+		}
+		gs = append(gs, g)
+	} else {
+		mu.RLock()
+		for _, g := range groups {
+			gs = append(gs, g)
+		}
+		mu.RUnlock()
+	}
+
+	req := getSetRequest()
+	defer putSetRequest(req)
+	for _, g := range gs {
+		var sent int
+		for _, c := range []*cache{&g.mainCache, &g.hotCache} {
+			for _, key := range c.keys() {
+				if limit > 0 && sent >= limit {
+					break
+				}
+				if owned != nil && !owned(key) {
+					continue
+				}
+				if c == &g.hotCache {
+					if _, ok := g.mainCache.peek(key); ok {
+						continue
+					}
+				}
+				view, ok := c.peek(key)
+				if !ok {
+					continue
+				}
+				req.Reset()
+				req.Group, req.Key, req.Value, req.Expire = g.name, key, view.encoded(), toUnixNano(view.e)
+				req.Version, req.Tags, req.Compressed = view.v, view.t, view.z
+				if err := fn(req); err != nil {
+					return err
+				}
+				sent++
+			}
+		}
+	}
+	return nil
+}
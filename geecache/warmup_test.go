@@ -0,0 +1,200 @@
+package geecache
+
+import (
+	"geecache/breaker"
+	"geecache/consistenthash"
+	pb "geecache/geecachepb"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWarmupFromPeers(t *testing.T) {
+	const n = 30
+	g := NewGroup("warmup-peers", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("db-" + key), nil
+	}))
+
+	var mu sync.Mutex
+	var progress []WarmupProgress
+	s := newServer("127.0.0.1:8001", &ServerOptions{Warmup: WarmupOptions{
+		FromPeers: true,
+		Progress: func(p WarmupProgress) {
+			mu.Lock()
+			progress = append(progress, p)
+			mu.Unlock()
+		},
+	}})
+	up := &faultyGrpcClient{}
+	for i := 0; i < n; i++ { // 最近访问的在前
+		key := "key" + strconv.Itoa(i)
+		up.warmups = append(up.warmups, &pb.SetRequest{Group: g.name, Key: key, Value: []byte("v-" + key)})
+	}
+	up.warmups = append(up.warmups,
+		&pb.SetRequest{Group: g.name, Key: "expired", Value: []byte("x"), Expire: time.Now().Add(-time.Second).UnixNano()},
+		&pb.SetRequest{Group: "no-such-group", Key: "key0", Value: []byte("x")},
+	)
+	s.clients["127.0.0.1:8002"] = newFakeClient(up, ClientOptions{}, breaker.Options{})
+	s.clients["127.0.0.1:8003"] = newFakeClient(&faultyGrpcClient{err: errUnavailable}, ClientOptions{}, breaker.Options{})
+	s.SetPeers("127.0.0.1:8001", "127.0.0.1:8002", "127.0.0.1:8003")
+
+	loaded := s.warmup()
+	if in := up.warmupIn; in.GetRequester() != s.addr || len(in.GetPeers()) != 3 {
+		t.Errorf("warm-up request should carry the requester and its ring, got %v", in)
+	}
+
+	var owned []string // 属于当前节点的 key，最近访问的在前
+	for i := 0; i < n; i++ {
+		key := "key" + strconv.Itoa(i)
+		view, ok := g.mainCache.peek(key)
+		if contains(s.owners(key), s.addr) {
+			owned = append(owned, key)
+			if !ok || view.String() != "v-"+key {
+				t.Errorf("owned %s should be warmed up, got %q", key, view)
+			}
+		} else if ok {
+			t.Errorf("%s is not owned by this node and should not be loaded", key)
+		}
+	}
+	if _, ok := g.mainCache.peek("expired"); ok {
+		t.Errorf("expired entry should not be loaded")
+	}
+	if loaded != len(owned) || len(owned) == 0 {
+		t.Fatalf("warmup loaded %d keys, want %d", loaded, len(owned))
+	}
+	if keys := g.mainCache.keys(); keys[0] != owned[0] || keys[len(keys)-1] != owned[len(owned)-1] {
+		t.Errorf("mainCache order %v should follow the peer's LRU order %v", keys, owned)
+	}
+
+	var done, failed int
+	for _, p := range progress {
+		if p.Done {
+			done++
+			if p.Err != nil {
+				failed++
+			} else if p.Source != "127.0.0.1:8002" || p.Received != n+2 || p.Loaded != len(owned) {
+				t.Errorf("unexpected progress %+v", p)
+			}
+		}
+	}
+	if done != 2 || failed != 1 {
+		t.Errorf("want 2 finished sources with 1 failure, got %+v", progress)
+	}
+}
+
+func TestWarmupSnapshot(t *testing.T) {
+	g := newHandoffGroup("warmup-snapshot", 20, time.Now().Add(time.Hour))
+	path := filepath.Join(t.TempDir(), "geecache.snapshot")
+	s := newServer("127.0.0.1:8001", &ServerOptions{Warmup: WarmupOptions{SnapshotFile: path}})
+	s.SetPeers("127.0.0.1:8001")
+
+	// 快照文件不存在时跳过
+	if n := s.warmup(); n != 0 {
+		t.Fatalf("warmup without snapshot loaded %d keys", n)
+	}
+	if err := s.SaveSnapshot(path); err != nil {
+		t.Fatalf("SaveSnapshot error: %v", err)
+	}
+	want := g.mainCache.keys()
+	for _, key := range want {
+		g.mainCache.remove(key)
+	}
+
+	if n := s.warmup(); n < len(want) { // 快照中还有其他测试的 group
+		t.Fatalf("warmup loaded %d keys, want at least %d", n, len(want))
+	}
+	got := g.mainCache.keys()
+	if len(got) != len(want) {
+		t.Fatalf("restored %d keys, want %d", len(got), len(want))
+	}
+	for i := range want {
+		view, _ := g.mainCache.peek(got[i])
+		if got[i] != want[i] || view.String() != "v-"+want[i] || view.e.IsZero() {
+			t.Fatalf("restored entry %d = %s %q, want %s in the same LRU order", i, got[i], view, want[i])
+		}
+	}
+}
+
+// fakeWarmupServer 记录 Warmup 发送的条目
+type fakeWarmupServer struct {
+	grpc.ServerStream
+	sent []*pb.SetRequest
+}
+
+func (f *fakeWarmupServer) Send(in *pb.SetRequest) error {
+	f.sent = append(f.sent, proto.Clone(in).(*pb.SetRequest)) // eachEntry 复用 in，与 gRPC 一样在发送时拷贝
+	return nil
+}
+
+func TestServerWarmup(t *testing.T) {
+	g := newHandoffGroup("warmup-serve", 10, time.Time{})
+	g.mainCache.get("key3") // key3 成为最近访问的 key
+	s := newServer("127.0.0.1:8001", nil)
+
+	stream := &fakeWarmupServer{}
+	if err := s.Warmup(&pb.WarmupRequest{Group: g.name, Limit: 4}, stream); err != nil {
+		t.Fatalf("Warmup error: %v", err)
+	}
+	if len(stream.sent) != 4 || stream.sent[0].Key != "key3" || stream.sent[1].Key != "key9" {
+		t.Fatalf("Warmup should send the 4 most recently used keys, got %v", stream.sent)
+	}
+	if v, _ := g.mainCache.peek("key3"); stream.sent[0].Version != v.v {
+		t.Fatalf("Warmup should send the version %d, got %d", v.v, stream.sent[0].Version)
+	}
+	if err := s.Warmup(&pb.WarmupRequest{Group: "no-such-group"}, stream); err == nil {
+		t.Fatalf("Warmup of unknown group should fail")
+	}
+}
+
+// 服务端按请求方的哈希环挑选属于它的条目后再截断，hotCache 中的条目同样发送
+func TestServerWarmupOwned(t *testing.T) {
+	g := newHandoffGroup("warmup-serve-owned", 40, time.Time{})
+	s := newServer("127.0.0.1:8001", &ServerOptions{Replicas: 50})
+	s.SetPeers("127.0.0.1:8001", "127.0.0.1:8002", "127.0.0.1:8003")
+
+	// 请求方尚未加入服务端的哈希环
+	const requester = "127.0.0.1:8004"
+	peers := map[string]int64{"127.0.0.1:8001": 1, "127.0.0.1:8002": 1, "127.0.0.1:8003": 1, requester: 1}
+	ring := consistenthash.New(50, nil)
+	ring.SetNodes(map[string]int{"127.0.0.1:8001": 1, "127.0.0.1:8002": 1, "127.0.0.1:8003": 1, requester: 1})
+	owned := func(key string) bool { return ring.FindNode(key) == requester }
+	var want int
+	for i := 0; i < 40; i++ {
+		if owned("key" + strconv.Itoa(i)) {
+			want++
+		}
+	}
+	if want < 2 {
+		t.Skip("too few keys owned by the requester")
+	}
+	hot := "hot"
+	for i := 0; !owned(hot); i++ {
+		hot = "hot" + strconv.Itoa(i)
+	}
+	g.localSet(hot, ByteView{b: []byte("v-" + hot)}, &g.hotCache)
+
+	stream := &fakeWarmupServer{}
+	in := &pb.WarmupRequest{Group: g.name, Limit: int64(want + 1), Requester: requester, Peers: peers}
+	if err := s.Warmup(in, stream); err != nil {
+		t.Fatalf("Warmup error: %v", err)
+	}
+	if len(stream.sent) != want+1 || stream.sent[want].Key != hot {
+		t.Fatalf("Warmup sent %d entries, want %d owned keys from mainCache followed by %s from hotCache", len(stream.sent), want, hot)
+	}
+	for _, e := range stream.sent {
+		if !owned(e.Key) {
+			t.Fatalf("Warmup sent %s which is not owned by the requester", e.Key)
+		}
+	}
+
+	// Limit 在过滤之后生效
+	stream = &fakeWarmupServer{}
+	in.Limit = 2
+	if err := s.Warmup(in, stream); err != nil || len(stream.sent) != 2 || !owned(stream.sent[1].Key) {
+		t.Fatalf("Warmup with limit 2 sent %d entries, %v", len(stream.sent), err)
+	}
+}
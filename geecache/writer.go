@@ -0,0 +1,313 @@
+package geecache
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+/*
+	写回数据源：Getter 背后的数据源（例如数据库）默认不知道 Group.Set/Remove 的修改。
+	Group 配置了 Setter/Deleter 后，由 key 的主节点（PickPeers 返回的第一个副本）在 Put/Delete 时写回数据源：
+	1. WriteThrough：先同步写数据源，成功后再更新缓存，写数据源失败时 Set/Remove 返回错误，缓存不变；
+	2. WriteBehind：先更新缓存，再放入队列由后台批量写回，失败时重试。
+	WriteThrough 模式下 Group.Set/Remove 必须得到主节点的确认，不能只凭其他副本凑满 WriteQuorum 或满足 RemovePolicy；
+	主节点不可用、由其他节点顶替时，WriteThrough 的写入失败，WriteBehind 的写入放入顶替节点的写回队列。
+	同一个 key 的写操作持有 Group 的同一把分段锁（keyLock），缓存与数据源的更新顺序一致；
+	写回队列中每个 key 只保留最新的操作，后台按顺序逐批写回，新的操作不会先于旧的操作到达数据源。
+*/
+
+// Setter 将 key 的新值写回数据源
+type Setter interface {
+	Set(key string, value []byte, expire time.Time) error
+}
+
+// SetterFunc 函数类型，实现 Setter 接口
+type SetterFunc func(key string, value []byte, expire time.Time) error
+
+func (f SetterFunc) Set(key string, value []byte, expire time.Time) error {
+	return f(key, value, expire)
+}
+
+// Deleter 从数据源中删除 key
+type Deleter interface {
+	Delete(key string) error
+}
+
+// DeleterFunc 函数类型，实现 Deleter 接口
+type DeleterFunc func(key string) error
+
+func (f DeleterFunc) Delete(key string) error {
+	return f(key)
+}
+
+// WriteOp 一次写回数据源的操作
+type WriteOp struct {
+	Key    string
+	Value  []byte
+	Expire time.Time
+	Delete bool // true 表示删除 key，忽略 Value 与 Expire
+}
+
+// BatchWriter Setter 实现了该接口时，WriteBehind 模式下一批操作通过一次 WriteBatch 写回，
+// 例如放在同一个数据库事务中。返回错误时整批重试
+type BatchWriter interface {
+	WriteBatch(ops []WriteOp) error
+}
+
+// WriteMode 写回数据源的方式
+type WriteMode int
+
+const (
+	WriteThrough WriteMode = iota // 同步写回，成功后才更新缓存
+	WriteBehind                   // 先更新缓存，后台批量写回
+)
+
+// WriteBehindOptions 后台写回队列的配置，零值字段使用默认值
+type WriteBehindOptions struct {
+	// BatchSize 每批最多写回的操作数，默认 100
+	BatchSize int
+
+	// FlushInterval 队列不足一批时，等待多长时间再写回，以便积累更多操作，默认 100ms
+	FlushInterval time.Duration
+
+	// MaxAttempts 每个操作最多尝试的次数，默认 3；超过后丢弃该操作并调用 OnError
+	MaxAttempts int
+
+	// RetryBackoff 写回失败后，等待多长时间再重试，默认 100ms
+	RetryBackoff time.Duration
+
+	// OnError 不为空时，操作最终写回失败后调用
+	OnError func(op WriteOp, err error)
+}
+
+// originWriter 负责将 Group 的写操作写回数据源
+type originWriter struct {
+	setter  Setter
+	deleter Deleter
+	mode    WriteMode
+	opts    WriteBehindOptions
+
+	mu       sync.Mutex
+	work     *sync.Cond                // 队列中有新的操作
+	idle     *sync.Cond                // 队列已清空，且没有正在写回的操作
+	pending  map[string]*queuedWriteOp // 每个 key 最新的待写回操作
+	queue    []string                  // 待写回的 key，按进入队列的顺序排列
+	inflight bool
+	started  bool
+}
+
+type queuedWriteOp struct {
+	op       WriteOp
+	attempts int
+}
+
+func newOriginWriter(setter Setter, deleter Deleter, mode WriteMode, o WriteBehindOptions) *originWriter {
+	if o.BatchSize <= 0 {
+		o.BatchSize = 100
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = 100 * time.Millisecond
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 3
+	}
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = 100 * time.Millisecond
+	}
+	w := &originWriter{
+		setter:  setter,
+		deleter: deleter,
+		mode:    mode,
+		opts:    o,
+		pending: make(map[string]*queuedWriteOp),
+	}
+	w.work = sync.NewCond(&w.mu)
+	w.idle = sync.NewCond(&w.mu)
+	return w
+}
+
+// write 按写回方式执行 op，apply 用于更新本地缓存。调用方需持有 op.Key 的 keyLock
+func (w *originWriter) write(op WriteOp, apply func()) error {
+	if w.mode == WriteThrough {
+		if err := w.do(op); err != nil {
+			return err
+		}
+		apply()
+		return nil
+	}
+	apply()
+	w.enqueue(op)
+	return nil
+}
+
+// writesThrough 是否同步写回 del 对应的操作（删除或写入）：WriteThrough 模式，且配置了对应的 Deleter/Setter
+func (w *originWriter) writesThrough(del bool) bool {
+	return w != nil && w.mode == WriteThrough && w.handles(del)
+}
+
+// handles 是否配置了 del 对应的 Deleter/Setter
+func (w *originWriter) handles(del bool) bool {
+	if del {
+		return w.deleter != nil
+	}
+	return w.setter != nil
+}
+
+// do 将一个操作写回数据源，没有对应的 Setter/Deleter 时忽略
+func (w *originWriter) do(op WriteOp) error {
+	if op.Delete {
+		if w.deleter == nil {
+			return nil
+		}
+		return w.deleter.Delete(op.Key)
+	}
+	if w.setter == nil {
+		return nil
+	}
+	return w.setter.Set(op.Key, op.Value, op.Expire)
+}
+
+// enqueue 将操作放入写回队列。key 已有待写回的操作时，新的操作取代旧的操作，位置不变
+func (w *originWriter) enqueue(op WriteOp) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.started {
+		w.started = true
+		go w.loop()
+	}
+	if q, ok := w.pending[op.Key]; ok {
+		q.op, q.attempts = op, 0
+		return
+	}
+	w.pending[op.Key] = &queuedWriteOp{op: op}
+	w.queue = append(w.queue, op.Key)
+	w.work.Signal()
+}
+
+// flush 等待队列中的操作全部写回（或最终失败）
+func (w *originWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for len(w.queue) > 0 || w.inflight {
+		w.idle.Wait()
+	}
+}
+
+// loop 后台写回协程，每次取出至多 BatchSize 个操作写回
+func (w *originWriter) loop() {
+	for {
+		w.mu.Lock()
+		for len(w.queue) == 0 {
+			w.inflight = false
+			w.idle.Broadcast()
+			w.work.Wait()
+		}
+		w.inflight = true
+		if len(w.queue) < w.opts.BatchSize { // 不足一批时稍等片刻，积累更多操作
+			w.mu.Unlock()
+			time.Sleep(w.opts.FlushInterval)
+			w.mu.Lock()
+		}
+		n := len(w.queue)
+		if n > w.opts.BatchSize {
+			n = w.opts.BatchSize
+		}
+		batch := make([]*queuedWriteOp, n)
+		for i, key := range w.queue[:n] {
+			batch[i] = w.pending[key]
+			delete(w.pending, key)
+		}
+		w.queue = w.queue[n:]
+		w.mu.Unlock()
+
+		if failed := w.writeBatch(batch); len(failed) > 0 {
+			w.retry(failed)
+			time.Sleep(w.opts.RetryBackoff)
+		}
+	}
+}
+
+// writeBatch 写回一批操作，返回写回失败的操作及其错误
+func (w *originWriter) writeBatch(batch []*queuedWriteOp) (failed map[*queuedWriteOp]error) {
+	failed = make(map[*queuedWriteOp]error)
+	if bw, ok := w.setter.(BatchWriter); ok {
+		ops := make([]WriteOp, len(batch))
+		for i, q := range batch {
+			ops[i] = q.op
+		}
+		if err := bw.WriteBatch(ops); err != nil {
+			for _, q := range batch {
+				failed[q] = err
+			}
+		}
+		return failed
+	}
+	for _, q := range batch {
+		if err := w.do(q.op); err != nil {
+			failed[q] = err
+		}
+	}
+	return failed
+}
+
+// retry 将失败的操作放回队首重试。key 已有更新的操作时，旧的操作被取代，不再重试
+func (w *originWriter) retry(failed map[*queuedWriteOp]error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var requeue []string
+	for q, err := range failed {
+		if _, ok := w.pending[q.op.Key]; ok {
+			continue
+		}
+		if q.attempts++; q.attempts >= w.opts.MaxAttempts {
+			log.Printf("write %s back to origin failed after %d attempts: %v", q.op.Key, q.attempts, err)
+			if w.opts.OnError != nil {
+				w.opts.OnError(q.op, err)
+			}
+			continue
+		}
+		w.pending[q.op.Key] = q
+		requeue = append(requeue, q.op.Key)
+	}
+	w.queue = append(requeue, w.queue...)
+}
+
+// writeOrigin 在写回数据源的同时通过 apply 更新本地缓存，未配置 Setter/Deleter 时只更新缓存
+func (g *Group) writeOrigin(op WriteOp, apply func()) error {
+	lock := g.keyLock(op.Key)
+	lock.Lock()
+	defer lock.Unlock()
+	return g.writeOriginLocked(op, apply)
+}
+
+// writeOriginLocked 与 writeOrigin 相同，调用方已持有 op.Key 的 keyLock
+func (g *Group) writeOriginLocked(op WriteOp, apply func()) error {
+	if g.writer == nil {
+		apply()
+		return nil
+	}
+	return g.writer.write(op, apply)
+}
+
+// substituteWrite 在顶替不可用副本的节点上执行写操作，apply 只更新 hotCache 等非所有者的缓存。
+// 主节点不可用，数据源仍然需要写回：WriteBehind 模式下放入当前节点的写回队列；
+// WriteThrough 模式下无法与主节点的写入串行，返回错误，由调用方稍后重试
+func (g *Group) substituteWrite(op WriteOp, apply func()) error {
+	if g.writer == nil || !g.writer.handles(op.Delete) {
+		apply()
+		return nil
+	}
+	if g.writer.mode == WriteThrough {
+		return fmt.Errorf("primary of %s is unavailable, cannot write through to origin", op.Key)
+	}
+	return g.writeOrigin(op, apply)
+}
+
+// FlushWrites 等待 WriteBehind 队列中的操作全部写回数据源，例如在进程退出前调用
+func (g *Group) FlushWrites() {
+	if g.writer != nil {
+		g.writer.flush()
+	}
+}
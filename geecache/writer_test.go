@@ -0,0 +1,336 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	pb "geecache/geecachepb"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeOrigin 是保存在内存中的数据源，记录每次写回；fail 大于 0 时接下来的 fail 次写回失败
+type fakeOrigin struct {
+	mu      sync.Mutex
+	data    map[string]string
+	log     []string // 按到达顺序记录的写回操作
+	batches int
+	fail    int
+}
+
+func newFakeOrigin() *fakeOrigin {
+	return &fakeOrigin{data: make(map[string]string)}
+}
+
+func (o *fakeOrigin) apply(op WriteOp) error {
+	if o.fail > 0 {
+		o.fail--
+		return errors.New("origin unavailable")
+	}
+	if op.Delete {
+		delete(o.data, op.Key)
+		o.log = append(o.log, "del "+op.Key)
+	} else {
+		o.data[op.Key] = string(op.Value)
+		o.log = append(o.log, "set "+op.Key+"="+string(op.Value))
+	}
+	return nil
+}
+
+func (o *fakeOrigin) Set(key string, value []byte, expire time.Time) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.apply(WriteOp{Key: key, Value: value, Expire: expire})
+}
+
+func (o *fakeOrigin) Delete(key string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.apply(WriteOp{Key: key, Delete: true})
+}
+
+func (o *fakeOrigin) get(key string) (string, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	v, ok := o.data[key]
+	return v, ok
+}
+
+// fakeBatchOrigin 额外实现 BatchWriter
+type fakeBatchOrigin struct {
+	*fakeOrigin
+}
+
+func (o fakeBatchOrigin) WriteBatch(ops []WriteOp) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.batches++
+	if o.fail > 0 {
+		o.fail--
+		return errors.New("origin unavailable")
+	}
+	for _, op := range ops {
+		o.apply(op)
+	}
+	return nil
+}
+
+func notFound(key string) ([]byte, error) {
+	return nil, errors.New(key + " not exist")
+}
+
+func TestWriteThrough(t *testing.T) {
+	origin := newFakeOrigin()
+	gp := NewGroupOpts("write-through", 2<<10, GetterFunc(notFound), &GroupOptions{Setter: origin, Deleter: origin})
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil}}
+
+	if err := gp.Set("Tom", []byte("630"), time.Time{}, false); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if v, ok := origin.get("Tom"); !ok || v != "630" {
+		t.Fatalf("origin not written, got %q", v)
+	}
+
+	// 写回失败时缓存保持不变
+	origin.fail = 1
+	if err := gp.Set("Tom", []byte("631"), time.Time{}, false); err == nil {
+		t.Fatalf("Set should fail when origin fails")
+	}
+	if view, ok := gp.mainCache.get("Tom"); !ok || view.String() != "630" {
+		t.Fatalf("cache should keep 630 after failed write, got %q", view)
+	}
+
+	if err := gp.Remove("Tom"); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if _, ok := origin.get("Tom"); ok {
+		t.Fatalf("Deleter not called on Remove")
+	}
+}
+
+func TestWriteThroughOnlyPrimary(t *testing.T) {
+	origin := newFakeOrigin()
+	p1 := newFakePeer(false)
+
+	// 当前节点是第二个副本，只写缓存，由主节点 p1 写回数据源
+	gp := NewGroupOpts("write-through-replica", 2<<10, GetterFunc(notFound), &GroupOptions{Setter: origin})
+	gp.peers = &fakePicker{replicas: []ProtoGetter{p1, nil}, all: []ProtoGetter{p1}}
+	if err := gp.Set("Tom", []byte("630"), time.Time{}, false); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, ok := origin.get("Tom"); ok {
+		t.Fatalf("non-primary replica should not write origin")
+	}
+
+	// 主节点写回失败，即使 p1 已确认，Set 也失败
+	gp = NewGroupOpts("write-through-primary", 2<<10, GetterFunc(notFound), &GroupOptions{Setter: origin})
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil, p1}, all: []ProtoGetter{p1}}
+	origin.fail = 1
+	if err := gp.Set("Tom", []byte("630"), time.Time{}, false); err == nil {
+		t.Fatalf("Set should fail when primary fails to write origin")
+	}
+}
+
+// 主节点是远程节点时，写穿透同样必须等到它的确认，当前节点作为第二个副本的确认不够
+func TestWriteThroughRemotePrimary(t *testing.T) {
+	origin := newFakeOrigin()
+	p1 := newFakePeer(true)
+	gp := NewGroupOpts("write-through-remote-primary", 2<<10, GetterFunc(notFound), &GroupOptions{Setter: origin})
+	gp.peers = &fakePicker{replicas: []ProtoGetter{p1, nil}, all: []ProtoGetter{p1}}
+	if err := gp.Set("Tom", []byte("630"), time.Time{}, false); err == nil {
+		t.Fatalf("Set should fail when the remote primary is down")
+	}
+
+	// Remove 同样需要主节点的确认，RemovePolicy 不能放宽这一点
+	gp = NewGroupOpts("write-through-remote-primary-remove", 2<<10, GetterFunc(notFound), &GroupOptions{
+		Deleter:      origin,
+		RemovePolicy: RemoveOwnerOnly,
+		RemoveRetry:  RemoveRetryOptions{MaxAttempts: -1},
+	})
+	gp.peers = &fakePicker{replicas: []ProtoGetter{p1, nil}, all: []ProtoGetter{p1}}
+	if err := gp.Remove("Tom"); err == nil {
+		t.Fatalf("Remove should fail when the remote primary is down")
+	}
+
+	// 未配置 Setter 时仍然只需要 WriteQuorum 个确认
+	gp = NewGroup("no-write-through-remote-primary", 2<<10, GetterFunc(notFound))
+	gp.peers = &fakePicker{replicas: []ProtoGetter{p1, nil}, all: []ProtoGetter{p1}}
+	if err := gp.Set("Tom", []byte("630"), time.Time{}, false); err != nil {
+		t.Fatalf("Set without Setter should succeed with one ack: %v", err)
+	}
+	gp = NewGroupOpts("no-write-through-remote-primary-remove", 2<<10, GetterFunc(notFound), &GroupOptions{
+		RemovePolicy: RemoveOwnerOnly,
+		RemoveRetry:  RemoveRetryOptions{MaxAttempts: -1},
+	})
+	gp.peers = &fakePicker{replicas: []ProtoGetter{p1, nil}, all: []ProtoGetter{p1}}
+	if err := gp.Remove("Tom"); err != nil {
+		t.Fatalf("Remove without Deleter should succeed with one ack: %v", err)
+	}
+}
+
+// 顶替不可用主节点的节点收到写入：WriteThrough 返回错误，WriteBehind 由顶替节点写回数据源
+func TestSubstitutePut(t *testing.T) {
+	s := newServer("127.0.0.1:8001", nil)
+	s.SetPeers("127.0.0.1:8001", "127.0.0.1:8002", "127.0.0.1:8003")
+	key := "tom"
+	for i := 0; s.peers.FindNodes(key, 1)[0] == s.addr; i++ {
+		key = "tom" + strconv.Itoa(i)
+	}
+
+	origin := newFakeOrigin()
+	through := NewGroupOpts("substitute-write-through", 2<<10, GetterFunc(notFound), &GroupOptions{Setter: origin, Deleter: origin})
+	through.peers = s
+	if _, err := s.Put(context.Background(), &pb.SetRequest{Group: through.name, Key: key, Value: []byte("630")}); err == nil {
+		t.Fatalf("substitute should refuse a write-through Put")
+	}
+	if _, err := s.Delete(context.Background(), &pb.Request{Group: through.name, Key: key}); err == nil {
+		t.Fatalf("substitute should refuse a write-through Delete")
+	}
+
+	behind := NewGroupOpts("substitute-write-behind", 2<<10, GetterFunc(notFound), &GroupOptions{
+		Setter:      origin,
+		WriteMode:   WriteBehind,
+		WriteBehind: WriteBehindOptions{FlushInterval: time.Millisecond},
+	})
+	behind.peers = s
+	if _, err := s.Put(context.Background(), &pb.SetRequest{Group: behind.name, Key: key, Value: []byte("630")}); err != nil {
+		t.Fatalf("substitute Put failed: %v", err)
+	}
+	behind.FlushWrites()
+	if v, ok := origin.get(key); !ok || v != "630" {
+		t.Fatalf("substitute should write the origin behind, got %q", v)
+	}
+	if _, ok := behind.hotCache.get(key); !ok {
+		t.Fatalf("substitute should keep the value in hotCache")
+	}
+	if _, ok := behind.mainCache.get(key); ok {
+		t.Fatalf("substitute must not store the value in mainCache")
+	}
+}
+
+func TestWriteBehind(t *testing.T) {
+	origin := newFakeOrigin()
+	var failed []WriteOp
+	gp := NewGroupOpts("write-behind", 1<<20, GetterFunc(notFound), &GroupOptions{
+		Setter:    fakeBatchOrigin{origin},
+		Deleter:   origin,
+		WriteMode: WriteBehind,
+		WriteBehind: WriteBehindOptions{
+			BatchSize:     10,
+			FlushInterval: 20 * time.Millisecond,
+			MaxAttempts:   2,
+			RetryBackoff:  time.Millisecond,
+			OnError:       func(op WriteOp, err error) { failed = append(failed, op) },
+		},
+	})
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil}}
+
+	// 同一个 key 的多次写入合并为最新的一次，先于数据源进入缓存
+	for i := 0; i < 5; i++ {
+		if err := gp.Set("Tom", []byte(strconv.Itoa(i)), time.Time{}, false); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	for i := 0; i < 25; i++ {
+		gp.Set("key"+strconv.Itoa(i), []byte("v"), time.Time{}, false)
+	}
+	if view, ok := gp.mainCache.get("Tom"); !ok || view.String() != "4" {
+		t.Fatalf("cache should be updated before origin, got %q", view)
+	}
+	gp.FlushWrites()
+
+	if v, _ := origin.get("Tom"); v != "4" {
+		t.Fatalf("origin got Tom=%q, want 4", v)
+	}
+	var toms int
+	for _, entry := range origin.log {
+		if entry[:7] == "set Tom" {
+			toms++
+		}
+	}
+	if toms != 1 {
+		t.Fatalf("writes of Tom should be coalesced, got %d", toms)
+	}
+	if origin.batches != 3 {
+		t.Fatalf("26 ops should be written in 3 batches, got %d", origin.batches)
+	}
+
+	// 第一次失败后重试成功
+	origin.fail = 1
+	gp.Set("Sam", []byte("567"), time.Time{}, false)
+	gp.FlushWrites()
+	if v, _ := origin.get("Sam"); v != "567" || len(failed) != 0 {
+		t.Fatalf("write should succeed on retry, got %q, failed %v", v, failed)
+	}
+
+	// 超过最大尝试次数后放弃，并调用 OnError
+	origin.fail = 2
+	gp.Set("Jack", []byte("589"), time.Time{}, false)
+	gp.FlushWrites()
+	if _, ok := origin.get("Jack"); ok || len(failed) != 1 || failed[0].Key != "Jack" {
+		t.Fatalf("Jack should be given up after 2 attempts, failed %v", failed)
+	}
+}
+
+func TestWriteBehindOrdering(t *testing.T) {
+	origin := newFakeOrigin()
+	gp := NewGroupOpts("write-behind-order", 2<<10, GetterFunc(notFound), &GroupOptions{
+		Setter:      origin,
+		Deleter:     origin,
+		WriteMode:   WriteBehind,
+		WriteBehind: WriteBehindOptions{FlushInterval: time.Millisecond},
+	})
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil}}
+
+	// 写入与删除交替进行，数据源最终与缓存一致
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				key := "k" + strconv.Itoa(i%5)
+				if (i+w)%3 == 0 {
+					gp.Remove(key)
+				} else {
+					gp.Set(key, []byte(strconv.Itoa(w*100+i)), time.Time{}, false)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	gp.FlushWrites()
+
+	for i := 0; i < 5; i++ {
+		key := "k" + strconv.Itoa(i)
+		view, cached := gp.mainCache.get(key)
+		v, stored := origin.get(key)
+		if cached != stored || cached && view.String() != v {
+			t.Fatalf("%s: cache %q(%v) differs from origin %q(%v)", key, view, cached, v, stored)
+		}
+	}
+}
+
+func TestServerPutWritesOrigin(t *testing.T) {
+	origin := newFakeOrigin()
+	gp := NewGroupOpts("server-put-origin", 2<<10, GetterFunc(notFound), &GroupOptions{Setter: origin, Deleter: origin})
+	s := newServer("127.0.0.1:8001", nil)
+	p1 := newFakePeer(false)
+
+	gp.peers = &fakePicker{replicas: []ProtoGetter{p1, nil}}
+	s.Put(context.Background(), &pb.SetRequest{Group: gp.name, Key: "Tom", Value: []byte("630")})
+	if _, ok := origin.get("Tom"); ok {
+		t.Fatalf("non-primary Put should not write origin")
+	}
+
+	gp.peers = &fakePicker{replicas: []ProtoGetter{nil, p1}}
+	s.Put(context.Background(), &pb.SetRequest{Group: gp.name, Key: "Tom", Value: []byte("630")})
+	if v, _ := origin.get("Tom"); v != "630" {
+		t.Fatalf("primary Put should write origin, got %q", v)
+	}
+	s.Delete(context.Background(), &pb.Request{Group: gp.name, Key: "Tom"})
+	if _, ok := origin.get("Tom"); ok {
+		t.Fatalf("primary Delete should delete from origin")
+	}
+}
@@ -53,7 +53,7 @@ func startAPIServer(apiAddr string, gp *geecache.Group) {
 			ctx.String(http.StatusInternalServerError, err.Error())
 			return
 		}
-		ctx.Writer.Write(view.ByteSlice())
+		view.WriteTo(ctx.Writer) // 直接写出缓存中的数据，不拷贝
 	})
 	r.GET("/remove", func(ctx *gin.Context) {
 		key := ctx.Query("key") //获取请求携带的参数数据
@@ -87,11 +87,13 @@ func startAPIServer(apiAddr string, gp *geecache.Group) {
 func main() {
 
 	var (
-		port int
-		api  bool
+		port     int
+		api      bool
+		snapshot string
 	)
 	flag.IntVar(&port, "port", 8001, "Geecache server port")
 	flag.BoolVar(&api, "api", false, "Start a api server?")
+	flag.StringVar(&snapshot, "snapshot", "", "Save snapshots to this file and warm up from it on start")
 	flag.Parse()
 
 	fmt.Println(port, api)
@@ -110,7 +112,21 @@ func main() {
 		addrs = append(addrs, v)
 	}
 	group := creatGroup()
-	s := geecache.NewServer(addrMap[port], 0, nil)
+	s := geecache.NewServerOpts(addrMap[port], &geecache.ServerOptions{
+		// 启动时先从其他节点（及快照文件）预热，避免滚动重启时命中率骤降
+		Warmup: geecache.WarmupOptions{
+			FromPeers:    true,
+			SnapshotFile: snapshot,
+			Progress: func(p geecache.WarmupProgress) {
+				log.Printf("warm-up from %s: received %d, loaded %d, done %v, err %v",
+					p.Source, p.Received, p.Loaded, p.Done, p.Err)
+			},
+		},
+		// 定期保存快照，计划内的重启后可从快照预热
+		Snapshot: geecache.SnapshotOptions{File: snapshot, Interval: time.Minute},
+		// Set/Remove 后通知其他节点丢弃 hotCache 中的旧副本
+		Invalidation: geecache.InvalidationOptions{Enabled: true},
+	})
 	s.SetPeers(addrs...)
 
 	var wg sync.WaitGroup